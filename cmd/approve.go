@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/approval"
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/output"
+	"github.com/yahao333/gort/internal/state"
+)
+
+type approveOptions struct {
+	user    string
+	keyFile string
+	yes     bool
+}
+
+var approveOpts = &approveOptions{}
+
+var approveCmd = &cobra.Command{
+	Use:   "approve [plan]",
+	Short: "Approve a saved plan for deployment",
+	Long: `Approve a plan saved with 'gort plan --out'.
+
+The approval is signed with your ed25519 key and recorded with the state of
+the environment. Environments with require_approval can only be deployed
+with 'gort deploy --plan' once enough distinct users have approved.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, hash, err := readPlan(args[0])
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.LoadConfig(globalOpts.configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		env, exists := cfg.Environments[plan.Environment]
+		if !exists {
+			return fmt.Errorf("environment '%s' not found in configuration", plan.Environment)
+		}
+
+		name := approveOpts.user
+		if name == "" {
+			name = currentUser()
+		}
+
+		key, created, err := approval.LoadKey(approveOpts.keyFile)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Fprintf(os.Stderr, "Created approval key %s with public key %s\n", approveOpts.keyFile, approval.PublicKey(key))
+		}
+
+		if !approveOpts.yes {
+			fmt.Fprintf(os.Stderr, "\nPlan %s for environment %s:\n\n", hash, plan.Environment)
+			printer := &diffPrinter{w: os.Stderr, color: output.ColorEnabled(os.Stderr)}
+			printer.printPlan(plan)
+			fmt.Fprintf(os.Stderr, "\nApprove this plan as %s? (yes/no)\n", name)
+
+			var response string
+			fmt.Scanln(&response)
+			if response != "yes" {
+				return fmt.Errorf("approval cancelled by user")
+			}
+		}
+
+		stateManager := state.NewStateManager(globalOpts.stateDir)
+		if err := stateManager.AddApproval(approval.Sign(key, plan.Environment, hash, name, time.Now())); err != nil {
+			return fmt.Errorf("failed to record approval: %w", err)
+		}
+
+		approvals, err := stateManager.Approvals(plan.Environment)
+		if err != nil {
+			return err
+		}
+		return render(approval.Check(approvals, plan.Environment, hash, env.RequireApproval, env.Approvers))
+	},
+}
+
+func init() {
+	approveCmd.Flags().StringVar(&approveOpts.user, "user", "", "Name to approve as (default $GORT_USER or the login name)")
+	approveCmd.Flags().StringVar(&approveOpts.keyFile, "key", approval.DefaultKeyPath(), "Private key used to sign approvals, created if missing")
+	approveCmd.Flags().BoolVarP(&approveOpts.yes, "yes", "y", false, "Approve without showing the plan and asking for confirmation")
+	rootCmd.AddCommand(approveCmd)
+}
+
+// currentUser names the user recording an approval
+func currentUser() string {
+	if name := os.Getenv("GORT_USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yahao333/gort/internal/approval"
+)
+
+// writeApprovalKey writes a new approval key for user to the project and
+// returns its path and public key
+func writeApprovalKey(t *testing.T, p *testProject, user string) (string, string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(p.dir, user+".key")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key.Seed())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, approval.PublicKey(key)
+}
+
+func TestDeployApprovedPlan(t *testing.T) {
+	p := newTestProject(t, `
+version: "1"
+providers:
+  fake:
+    type: mock
+    properties:
+      state_file: $DIR/mock.json
+environments:
+  prod:
+    provider: fake
+    require_approval: 2
+    approvers:
+      alice: $ALICE
+      bob: $BOB
+    resources:
+      db:
+        type: database
+        properties: {size: small}
+      cache:
+        type: cache
+`)
+	t.Setenv(approval.KeyEnv, "")
+	keys := make(map[string]string)
+	config, _ := os.ReadFile(filepath.Join(p.dir, "gort.yaml"))
+	for _, user := range []string{"alice", "bob"} {
+		path, pub := writeApprovalKey(t, p, user)
+		keys[user] = path
+		config = []byte(strings.ReplaceAll(string(config), "$"+strings.ToUpper(user), pub))
+	}
+	if err := os.WriteFile(filepath.Join(p.dir, "gort.yaml"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two plans are made against the same state
+	first, second := filepath.Join(p.dir, "first.plan"), filepath.Join(p.dir, "second.plan")
+	for _, plan := range []string{first, second} {
+		if _, err := p.run(t, "plan", "prod", "--out", plan, "--output", "json"); err != nil {
+			t.Fatalf("plan: %v", err)
+		}
+	}
+	t.Cleanup(func() { planOut, deployOpts.planFile = "", "" })
+
+	approve := func(plan, user string) {
+		t.Helper()
+		if _, err := p.run(t, "approve", plan, "--user", user, "--key", keys[user], "--yes", "--output", "json"); err != nil {
+			t.Fatalf("approve as %s: %v", user, err)
+		}
+	}
+	deploy := func(plan string) error {
+		t.Helper()
+		_, err := p.run(t, "deploy", "prod", "--plan", plan, "--force", "--output", "json")
+		return err
+	}
+
+	approve(first, "alice")
+	approve(first, "alice")
+	if err := deploy(first); err == nil || !strings.Contains(err.Error(), "has 1 of 2 required approval(s)") {
+		t.Fatalf("deploy with one approver: %v", err)
+	}
+
+	approve(first, "bob")
+	if err := deploy(first); err != nil {
+		t.Fatalf("deploy approved plan: %v", err)
+	}
+	assertNames(t, "resources in state", p.resources(t, "prod"), "cache", "db")
+
+	// The second plan is approved too, but the state it was made against
+	// has changed since
+	approve(second, "alice")
+	approve(second, "bob")
+	if err := deploy(second); err == nil || !strings.Contains(err.Error(), "plan is stale") {
+		t.Errorf("deploy of a stale plan: %v", err)
+	}
+}
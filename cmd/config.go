@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/output"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the gort configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [environment]",
+	Short: "Show the effective configuration of an environment",
+	Long: `Show the effective configuration of an environment after merging
+included files, environments/<name>.yaml and the defaults -> provider ->
+environment layers, along with the file each value was read from.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(globalOpts.configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		values, err := cfg.Explain(args[0])
+		if err != nil {
+			return err
+		}
+
+		return render(values)
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for gort.yaml",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// A schema has no tabular form, so it defaults to JSON
+		format := output.OutputFormatJSON
+		if globalOpts.output == string(output.OutputFormatYAML) {
+			format = output.OutputFormatYAML
+		}
+		return output.NewFormatter(format).Format(config.JSONSchema())
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd, configSchemaCmd)
+	rootCmd.AddCommand(configCmd)
+}
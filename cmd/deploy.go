@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/approval"
 	"github.com/yahao333/gort/internal/config"
 	"github.com/yahao333/gort/internal/core"
 	"github.com/yahao333/gort/internal/logging"
-	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/output"
+	"github.com/yahao333/gort/internal/secrets"
 	"github.com/yahao333/gort/internal/state"
 )
 
@@ -19,10 +22,9 @@ type deployOptions struct {
 	force       bool
 	parallel    int
 	timeout     time.Duration
-	configFile  string
-	stateDir    string
-	pluginDir   string
+	secretsDir  string
 	backupState bool
+	planFile    string
 }
 
 var deployOpts = &deployOptions{}
@@ -44,13 +46,18 @@ This command will:
 func init() {
 	// Add flags
 	deployCmd.Flags().StringVarP(&deployOpts.version, "version", "v", "", "Version to deploy")
-	deployCmd.Flags().BoolVarP(&deployOpts.force, "force", "f", false, "Force deployment without confirmation")
-	deployCmd.Flags().IntVarP(&deployOpts.parallel, "parallel", "p", 1, "Number of parallel deployments")
-	deployCmd.Flags().DurationVar(&deployOpts.timeout, "timeout", 30*time.Minute, "Deployment timeout")
-	deployCmd.Flags().StringVar(&deployOpts.configFile, "config", "gort.yaml", "Path to config file")
-	deployCmd.Flags().StringVar(&deployOpts.stateDir, "state-dir", ".gort/state", "Directory for state files")
-	deployCmd.Flags().StringVar(&deployOpts.pluginDir, "plugin-dir", ".gort/plugins", "Directory for plugins")
-	deployCmd.Flags().BoolVar(&deployOpts.backupState, "backup-state", true, "Backup state before deployment")
+	addApplyFlags(deployCmd)
+	deployCmd.Flags().StringVar(&deployOpts.planFile, "plan", "", "Deploy a plan saved with `gort plan --out` instead of planning again")
+}
+
+// addApplyFlags adds the flags controlling how changes are applied, shared
+// by the commands that deploy
+func addApplyFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&deployOpts.force, "force", "f", false, "Force deployment without confirmation")
+	cmd.Flags().IntVarP(&deployOpts.parallel, "parallel", "p", 1, "Number of parallel deployments")
+	cmd.Flags().DurationVar(&deployOpts.timeout, "timeout", 30*time.Minute, "Deployment timeout")
+	cmd.Flags().StringVar(&deployOpts.secretsDir, "secrets-dir", secrets.DefaultDir, "Directory for the encrypted secrets store")
+	cmd.Flags().BoolVar(&deployOpts.backupState, "backup-state", true, "Backup state before deployment")
 }
 
 func runDeploy(cmd *cobra.Command, args []string) error {
@@ -58,77 +65,181 @@ func runDeploy(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(cmd.Context(), deployOpts.timeout)
 	defer cancel()
 
+	// Get environment name
+	envName := args[0]
+
+	d, err := prepareDeployment(ctx, envName, core.DeployerOptions{Version: deployOpts.version})
+	if err != nil {
+		return err
+	}
+
+	// Create deployment plan, or use the saved one
+	var plan *core.DeploymentPlan
+	if deployOpts.planFile != "" {
+		plan, err = savedPlan(d.stateManager, d.cfg, envName, deployOpts.planFile)
+	} else {
+		if required := d.cfg.Environments[envName].RequireApproval; required > 0 {
+			return fmt.Errorf("environment %s requires %d approval(s): save a plan with `gort plan --out`, "+
+				"have it approved with `gort approve` and deploy it with --plan", envName, required)
+		}
+		plan, err = d.deployer.Plan(ctx, envName, d.cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create deployment plan: %w", err)
+	}
+
+	result, err := d.apply(ctx, plan)
+	if err != nil || result == nil {
+		return err
+	}
+
+	// Show deployment results
+	return render(result)
+}
+
+// deployment holds what is needed to plan and apply changes to an
+// environment
+type deployment struct {
+	logger       *logging.Logger
+	stateManager *state.StateManager
+	cfg          *config.Config
+	secrets      secrets.Values
+	deployer     *core.Deployer
+}
+
+// prepareDeployment loads the configuration and secrets of an environment,
+// backs up its state and creates a deployer. Parallelism, force and secrets
+// are taken from the deploy flags.
+func prepareDeployment(ctx context.Context, envName string, opts core.DeployerOptions) (*deployment, error) {
 	// Initialize logger
-	logger := logging.NewLogger(os.Getenv("DEBUG") == "true")
+	logger := runLogger
+	logger.SetField("environment", envName)
 	logger.Info("Starting deployment process")
 
-	// Get environment name
-	envName := args[0]
+	// Initialize state manager
+	stateManager := state.NewStateManager(globalOpts.stateDir)
 
 	// Load configuration
-	cfg, err := loadConfig(deployOpts.configFile, envName)
+	cfg, err := loadConfig(globalOpts.configFile, envName, opts.Version, stateManager)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Initialize state manager
-	stateManager := state.NewStateManager(deployOpts.stateDir)
+	// Resolve secrets; they are only held in memory and masked in logs and state
+	envSecrets, err := secrets.NewResolver(secrets.NewStore(deployOpts.secretsDir)).
+		Resolve(envName, cfg.Environments[envName].Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+	logger.Mask(envSecrets.Plaintext()...)
+	stateManager.Mask(envSecrets.Plaintext()...)
 
 	// Backup state if enabled
 	if deployOpts.backupState {
 		if err := backupState(stateManager, envName); err != nil {
-			return fmt.Errorf("failed to backup state: %w", err)
+			return nil, fmt.Errorf("failed to backup state: %w", err)
 		}
 	}
 
 	// Initialize plugin manager
-	pluginManager := plugin.NewPluginManager(deployOpts.pluginDir, logger)
+	pluginManager, err := newPluginManager(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
 	if err := pluginManager.Initialize(ctx); err != nil {
-		return fmt.Errorf("failed to initialize plugin manager: %w", err)
+		return nil, fmt.Errorf("failed to initialize plugin manager: %w", err)
 	}
 
 	// Create deployer
-	deployer := core.NewDeployer(
-		stateManager,
-		pluginManager,
-		logger,
-		core.DeployerOptions{
-			Parallel: deployOpts.parallel,
-			Force:    deployOpts.force,
-		},
-	)
-
-	// Create deployment plan
-	plan, err := deployer.Plan(ctx, envName, cfg)
-	if err != nil {
-		return fmt.Errorf("failed to create deployment plan: %w", err)
+	opts.Parallel = deployOpts.parallel
+	opts.Force = deployOpts.force
+	opts.Secrets = envSecrets
+	opts.RunID = logger.RunID()
+	opts.Progress = progressReporter(output.NewProgress(os.Stderr, output.ColorEnabled(os.Stderr)), envSecrets.Plaintext())
+	deployer := core.NewDeployer(stateManager, pluginManager, logger, opts)
+
+	return &deployment{
+		logger:       logger,
+		stateManager: stateManager,
+		cfg:          cfg,
+		secrets:      envSecrets,
+		deployer:     deployer,
+	}, nil
+}
+
+// progressReporter prints the progress of resources as they are applied,
+// masking secret values in provider messages
+func progressReporter(p *output.Progress, secretValues []string) func(core.ProgressEvent) {
+	return func(ev core.ProgressEvent) {
+		msg := ev.Message
+		if ev.Err != nil {
+			msg = "failed: " + ev.Err.Error()
+		} else if ev.Done {
+			msg = progressDone[ev.Action]
+		}
+		for _, s := range secretValues {
+			if s != "" {
+				msg = strings.ReplaceAll(msg, s, logging.Masked)
+			}
+		}
+
+		if ev.Done {
+			p.Done(ev.Resource, msg, ev.Elapsed, ev.Err != nil)
+			return
+		}
+		p.Update(ev.Resource, msg, ev.Elapsed)
+	}
+}
+
+var progressDone = map[string]string{
+	core.ChangeAdd:    "created",
+	core.ChangeUpdate: "updated",
+	core.ChangeDelete: "deleted",
+}
+
+// apply checks policies, asks for confirmation unless forced and deploys
+// the plan, rolling back on failure. The result is nil when there was
+// nothing to change and no version to record.
+func (d *deployment) apply(ctx context.Context, plan *core.DeploymentPlan) (*core.DeploymentResult, error) {
+	if !plan.HasChanges() {
+		d.logger.Info("No changes. Infrastructure is up-to-date.")
+		if plan.Version == "" {
+			return nil, nil
+		}
+		// The version is still recorded in state and history so it can be
+		// promoted
+		return d.deployer.Deploy(ctx, plan)
+	}
+
+	if _, err := checkPolicies(d.cfg, plan); err != nil {
+		return nil, err
 	}
 
 	// Show plan and confirm if not forced
 	if !deployOpts.force {
-		if err := confirmDeployment(plan); err != nil {
-			return err
+		if err := confirmDeployment(plan, d.secrets.Plaintext()); err != nil {
+			return nil, err
 		}
 	}
 
 	// Execute deployment
-	result, err := deployer.Deploy(ctx, plan)
+	result, err := d.deployer.Deploy(ctx, plan)
 	if err != nil {
-		logger.Errorf("Deployment failed: %v", err)
-		if err := handleDeploymentFailure(ctx, deployer, plan); err != nil {
-			logger.Errorf("Failed to handle deployment failure: %v", err)
+		d.logger.Errorf("Deployment failed: %v", err)
+		if err := handleDeploymentFailure(ctx, d.deployer, plan); err != nil {
+			d.logger.Errorf("Failed to handle deployment failure: %v", err)
 		}
-		return fmt.Errorf("deployment failed: %w", err)
+		return nil, fmt.Errorf("deployment failed: %w", err)
 	}
 
-	// Show deployment results
-	showDeploymentResults(result)
-
-	logger.Info("Deployment completed successfully")
-	return nil
+	d.logger.Info("Deployment completed successfully")
+	return result, nil
 }
 
-func loadConfig(configFile, envName string) (*config.Config, error) {
+// loadConfig loads the configuration and resolves the references of the
+// environment against saved state. The version being deployed, if any, is
+// available to the configuration as ${var.version}.
+func loadConfig(configFile, envName, version string, sm *state.StateManager) (*config.Config, error) {
 	cfg, err := config.LoadConfig(configFile)
 	if err != nil {
 		return nil, err
@@ -138,8 +249,13 @@ func loadConfig(configFile, envName string) (*config.Config, error) {
 	if _, exists := cfg.Environments[envName]; !exists {
 		return nil, fmt.Errorf("environment '%s' not found in configuration", envName)
 	}
+	if version != "" {
+		if err := cfg.SetVariable(envName, "version", version); err != nil {
+			return nil, err
+		}
+	}
 
-	return cfg, nil
+	return cfg.Resolve(envName, state.NewResolver(sm))
 }
 
 func backupState(sm *state.StateManager, envName string) error {
@@ -147,14 +263,47 @@ func backupState(sm *state.StateManager, envName string) error {
 	return sm.BackupState(envName, backupPath)
 }
 
-func confirmDeployment(plan *core.DeploymentPlan) error {
-	fmt.Println("\nDeployment Plan:")
-	fmt.Println("================")
-	fmt.Printf("Environment: %s\n", plan.Environment)
-	fmt.Printf("Resources to Add: %d\n", len(plan.AddResources))
-	fmt.Printf("Resources to Update: %d\n", len(plan.UpdateResources))
-	fmt.Printf("Resources to Delete: %d\n", len(plan.DeleteResources))
-	fmt.Println("\nDo you want to proceed? (yes/no)")
+// savedPlan loads a saved plan for env, checking it has been approved by
+// enough users when the environment requires it
+func savedPlan(sm *state.StateManager, cfg *config.Config, envName, path string) (*core.DeploymentPlan, error) {
+	plan, hash, err := readPlan(path)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Environment != envName {
+		return nil, fmt.Errorf("plan %s is for environment %s, not %s", path, plan.Environment, envName)
+	}
+
+	env := cfg.Environments[envName]
+	if env.RequireApproval == 0 {
+		return plan, nil
+	}
+
+	approvals, err := sm.Approvals(envName)
+	if err != nil {
+		return nil, err
+	}
+	status := approval.Check(approvals, envName, hash, env.RequireApproval, env.Approvers)
+	for _, r := range status.Rejected {
+		fmt.Fprintf(os.Stderr, "Ignoring approval by %s\n", r)
+	}
+	if !status.Approved() {
+		return nil, fmt.Errorf("plan %s has %d of %d required approval(s)", path, len(status.Approvers), status.Required)
+	}
+	return plan, nil
+}
+
+// confirmDeployment shows the plan as a diff, with secret values masked,
+// and asks the user to confirm it
+func confirmDeployment(plan *core.DeploymentPlan, secretValues []string) error {
+	fmt.Fprintf(os.Stderr, "\nDeployment plan for environment %s:\n\n", plan.Environment)
+	printer := &diffPrinter{
+		w:       os.Stderr,
+		color:   output.ColorEnabled(os.Stderr),
+		secrets: secretValues,
+	}
+	printer.printPlan(plan)
+	fmt.Fprintln(os.Stderr, "\nDo you want to proceed? (yes/no)")
 
 	var response string
 	fmt.Scanln(&response)
@@ -166,29 +315,12 @@ func confirmDeployment(plan *core.DeploymentPlan) error {
 }
 
 func handleDeploymentFailure(ctx context.Context, deployer *core.Deployer, plan *core.DeploymentPlan) error {
-	fmt.Println("\nDeployment failed. Attempting rollback...")
+	fmt.Fprintln(os.Stderr, "\nDeployment failed. Attempting rollback...")
 
 	if err := deployer.Rollback(ctx, plan); err != nil {
 		return fmt.Errorf("rollback failed: %w", err)
 	}
 
-	fmt.Println("Rollback completed successfully")
+	fmt.Fprintln(os.Stderr, "Rollback completed successfully")
 	return nil
 }
-
-func showDeploymentResults(result *core.DeploymentResult) {
-	fmt.Println("\nDeployment Results:")
-	fmt.Println("===================")
-	fmt.Printf("Environment: %s\n", result.Environment)
-	fmt.Printf("Duration: %s\n", result.Duration)
-	fmt.Printf("Resources Created: %d\n", len(result.CreatedResources))
-	fmt.Printf("Resources Updated: %d\n", len(result.UpdatedResources))
-	fmt.Printf("Resources Deleted: %d\n", len(result.DeletedResources))
-
-	if len(result.Outputs) > 0 {
-		fmt.Println("\nOutputs:")
-		for k, v := range result.Outputs {
-			fmt.Printf("%s: %v\n", k, v)
-		}
-	}
-}
@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/state"
+)
+
+// testProject is a configuration in a temporary directory using only the
+// built-in local and mock providers
+type testProject struct {
+	dir string
+}
+
+func newTestProject(t *testing.T, config string) *testProject {
+	t.Helper()
+	dir := t.TempDir()
+	config = strings.ReplaceAll(config, "$DIR", dir)
+	if err := os.WriteFile(filepath.Join(dir, "gort.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &testProject{dir: dir}
+}
+
+// run executes gort with the project's config, state and plugin
+// directories and returns what it printed on stdout
+func (p *testProject) run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	args = append(args,
+		"--config", filepath.Join(p.dir, "gort.yaml"),
+		"--state-dir", filepath.Join(p.dir, ".gort", "state"),
+		"--plugin-dir", filepath.Join(p.dir, ".gort", "plugins"),
+		"--log-level", "error",
+	)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+
+	rootCmd.SetArgs(args)
+	err = rootCmd.Execute()
+
+	w.Close()
+	os.Stdout = stdout
+	return <-done, err
+}
+
+// deploy runs gort deploy without confirmation and decodes its result
+func (p *testProject) deploy(t *testing.T, env string) (*core.DeploymentResult, error) {
+	t.Helper()
+	out, err := p.run(t, "deploy", env, "--force", "--output", "json")
+	if err != nil {
+		return nil, err
+	}
+	var result core.DeploymentResult
+	if strings.TrimSpace(out) == "" {
+		return &result, nil
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("failed to decode deploy output %q: %v", out, err)
+	}
+	return &result, nil
+}
+
+// resources returns the names of the resources in the state of env
+func (p *testProject) resources(t *testing.T, env string) []string {
+	t.Helper()
+	st, err := state.NewStateManager(filepath.Join(p.dir, ".gort", "state")).LoadState(env)
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	names := make([]string, 0, len(st.Resources))
+	for name := range st.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedCopy(names []string) []string {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	return names
+}
+
+func assertNames(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(sortedCopy(got)) != fmt.Sprint(sortedCopy(want)) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func TestDeployLocalAndMock(t *testing.T) {
+	p := newTestProject(t, `
+version: "1"
+providers:
+  files:
+    type: local
+    properties:
+      root: $DIR/out
+  fake:
+    type: mock
+    properties:
+      state_file: $DIR/mock.json
+environments:
+  dev:
+    provider: files
+    resources:
+      conf:
+        type: directory
+        properties: {path: conf}
+      app:
+        type: template
+        depends_on: [conf]
+        properties:
+          path: conf/app.ini
+          template: "replicas={{ .Variables.replicas }}\n"
+          vars: {replicas: 3}
+      db:
+        type: database
+        provider: fake
+        depends_on: [app]
+        properties: {size: small}
+`)
+
+	result, err := p.deploy(t, "dev")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	assertNames(t, "created resources", result.CreatedResources, "app", "conf", "db")
+	assertNames(t, "resources in state", p.resources(t, "dev"), "app", "conf", "db")
+
+	data, err := os.ReadFile(filepath.Join(p.dir, "out", "conf", "app.ini"))
+	if err != nil || string(data) != "replicas=3\n" {
+		t.Errorf("rendered template = %q, %v", data, err)
+	}
+
+	// A second deploy has nothing to do
+	result, err = p.deploy(t, "dev")
+	if err != nil {
+		t.Fatalf("second deploy: %v", err)
+	}
+	if len(result.CreatedResources)+len(result.UpdatedResources)+len(result.DeletedResources) != 0 {
+		t.Errorf("second deploy changed resources: %+v", result)
+	}
+}
+
+func TestDeployRollsBackFailure(t *testing.T) {
+	p := newTestProject(t, `
+version: "1"
+providers:
+  files:
+    type: local
+    properties:
+      root: $DIR/out
+  fake:
+    type: mock
+    properties:
+      state_file: $DIR/mock.json
+      failures:
+        - {operation: create, resource: db, times: 1, message: quota exceeded}
+environments:
+  dev:
+    provider: files
+    resources:
+      conf:
+        type: directory
+        properties: {path: conf}
+      db:
+        type: database
+        provider: fake
+        depends_on: [conf]
+        properties: {size: small}
+`)
+
+	_, err := p.deploy(t, "dev")
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("deploy error = %v, want the scripted failure", err)
+	}
+	assertNames(t, "resources in state after rollback", p.resources(t, "dev"))
+	if _, err := os.Stat(filepath.Join(p.dir, "out", "conf")); !os.IsNotExist(err) {
+		t.Errorf("directory created before the failure was not rolled back: %v", err)
+	}
+
+	// The failure only happens once, so deploying again succeeds
+	result, err := p.deploy(t, "dev")
+	if err != nil {
+		t.Fatalf("deploy after rollback: %v", err)
+	}
+	assertNames(t, "created resources", result.CreatedResources, "conf", "db")
+	assertNames(t, "resources in state", p.resources(t, "dev"), "conf", "db")
+}
+
+func TestDeployResumesAfterFailedRollback(t *testing.T) {
+	p := newTestProject(t, `
+version: "1"
+providers:
+  fake:
+    type: mock
+    properties:
+      state_file: $DIR/mock.json
+      failures:
+        - {operation: create, resource: c, times: 1, message: quota exceeded}
+        - {operation: delete, resource: b, times: 1, message: still in use}
+environments:
+  dev:
+    provider: fake
+    resources:
+      a:
+        type: network
+      b:
+        type: instance
+        depends_on: [a]
+      c:
+        type: instance
+        depends_on: [b]
+`)
+
+	_, err := p.deploy(t, "dev")
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("deploy error = %v, want the scripted failure", err)
+	}
+	// Rolling back b failed, so it is kept in state while a was removed
+	assertNames(t, "resources in state after rollback", p.resources(t, "dev"), "b")
+
+	// The next deploy resumes from state: b is not created again
+	result, err := p.deploy(t, "dev")
+	if err != nil {
+		t.Fatalf("resumed deploy: %v", err)
+	}
+	assertNames(t, "created resources", result.CreatedResources, "a", "c")
+	assertNames(t, "resources in state", p.resources(t, "dev"), "a", "b", "c")
+}
+
+func TestPromoteVersionDeployedWithoutChanges(t *testing.T) {
+	p := newTestProject(t, `
+version: "1"
+providers:
+  files:
+    type: local
+    properties:
+      root: $DIR/out
+environments:
+  staging:
+    provider: files
+    resources:
+      conf:
+        type: directory
+        properties: {path: staging}
+  prod:
+    provider: files
+    resources:
+      conf:
+        type: directory
+        properties: {path: prod}
+      app:
+        type: file
+        depends_on: [conf]
+        properties:
+          path: prod/version
+          content: "${var.version}"
+`)
+	t.Cleanup(func() { deployOpts.version = "" })
+
+	if _, err := p.deploy(t, "staging"); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	// The configuration is unchanged, the version is still recorded
+	if _, err := p.run(t, "deploy", "staging", "-v", "1.4.3", "--force", "--output", "json"); err != nil {
+		t.Fatalf("deploy -v 1.4.3: %v", err)
+	}
+	history, err := state.NewStateManager(filepath.Join(p.dir, ".gort", "state")).History("staging")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if n := len(history); n != 2 || history[n-1].Version != "1.4.3" {
+		t.Fatalf("history = %+v, want the unchanged deployment of 1.4.3 last", history)
+	}
+
+	if _, err := p.run(t, "promote", "1.4.3", "--from", "staging", "--to", "prod", "--force", "--output", "json"); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(p.dir, "out", "prod", "version"))
+	if err != nil || string(data) != "1.4.3" {
+		t.Errorf("${var.version} rendered as %q, %v", data, err)
+	}
+}
+
+func TestDeployCorrectsDrift(t *testing.T) {
+	p := newTestProject(t, `
+version: "1"
+providers:
+  fake:
+    type: mock
+    properties:
+      state_file: $DIR/mock.json
+      drift:
+        db: {size: large}
+environments:
+  dev:
+    provider: fake
+    resources:
+      db:
+        type: database
+        properties: {size: small, engine: postgres}
+`)
+
+	if _, err := p.deploy(t, "dev"); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+
+	// The size reported by the provider differs from the applied one
+	out, err := p.run(t, "plan", "dev", "--output", "json")
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	var plan struct {
+		Changes []struct {
+			Action     string `json:"action"`
+			Resource   string `json:"resource"`
+			Attributes []struct {
+				Attribute string      `json:"attribute"`
+				Before    interface{} `json:"before"`
+				After     interface{} `json:"after"`
+			} `json:"attributes"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(out), &plan); err != nil {
+		t.Fatalf("failed to decode plan %q: %v", out, err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != "update" || len(plan.Changes[0].Attributes) != 1 {
+		t.Fatalf("plan changes = %+v, want the drifted size updated", plan.Changes)
+	}
+	if a := plan.Changes[0].Attributes[0]; a.Attribute != "size" || a.Before != "large" || a.After != "small" {
+		t.Errorf("drifted attribute = %+v, want size from large to small", a)
+	}
+
+	result, err := p.deploy(t, "dev")
+	if err != nil {
+		t.Fatalf("second deploy: %v", err)
+	}
+	assertNames(t, "updated resources", result.UpdatedResources, "db")
+}
@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/output"
+)
+
+const sensitiveValue = "(sensitive value)"
+
+// sensitiveKey matches property names whose values are never shown
+var sensitiveKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|private_?key|api_?key|credential)`)
+
+// diffPrinter renders a plan as a terraform-style diff
+type diffPrinter struct {
+	w     io.Writer
+	color bool
+	// secrets are plaintext values masked wherever they appear
+	secrets []string
+}
+
+var diffMarkers = map[string]string{
+	core.ChangeAdd:     "+",
+	core.ChangeUpdate:  "~",
+	core.ChangeDelete:  "-",
+	core.ChangeReplace: "-/+",
+}
+
+var diffVerbs = map[string]string{
+	core.ChangeAdd:     "will be created",
+	core.ChangeUpdate:  "will be updated in-place",
+	core.ChangeDelete:  "will be destroyed",
+	core.ChangeReplace: "must be replaced",
+}
+
+func (p *diffPrinter) printPlan(plan *core.DeploymentPlan) {
+	doc := plan.Document()
+	for _, c := range doc.Changes {
+		p.printChange(c)
+	}
+
+	fmt.Fprintf(p.w, "Plan: %d to add, %d to change, %d to destroy.\n",
+		doc.Summary.Add+doc.Summary.Replace, doc.Summary.Update, doc.Summary.Delete+doc.Summary.Replace)
+}
+
+func (p *diffPrinter) printChange(c core.ChangeDocument) {
+	marker := diffMarkers[c.Action]
+	fmt.Fprintf(p.w, "  %s\n", p.paint(fmt.Sprintf("# %s %s", c.Resource, diffVerbs[c.Action]), output.ColorBold))
+	fmt.Fprintf(p.w, "%s resource %q %q {\n", p.marker(marker), c.Type, c.Resource)
+
+	var before, after core.ResourceSpec
+	if c.Before != nil {
+		before = *c.Before
+	}
+	if c.After != nil {
+		after = *c.After
+	}
+
+	// Plans saved before schemas were planned do not list the attributes
+	// forcing a replacement
+	replaced := c.ForcesReplacement
+	if replaced == nil && c.Before != nil && c.After != nil {
+		replaced = core.ForcesReplacement(before, after)
+	}
+	forced := make(map[string]bool)
+	for _, attr := range replaced {
+		forced[attr] = true
+	}
+	sensitive := make(map[string]bool)
+	for _, attr := range c.Sensitive {
+		sensitive[attr] = true
+	}
+
+	top := []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"type", string(before.Type), string(after.Type)},
+		{"provider", before.Provider, after.Provider},
+		{"depends_on", stringsValue(before.Dependencies), stringsValue(after.Dependencies)},
+	}
+
+	var lines []diffLine
+	for _, attr := range top {
+		b, a := attr.before, attr.after
+		if c.Before == nil {
+			b = nil
+		}
+		if c.After == nil {
+			a = nil
+		}
+		lines = append(lines, p.diff(attr.name, b, a, 1, forced[attr.name], false)...)
+	}
+	lines = append(lines, p.diffMaps(mapValue(before.Properties, c.Before != nil), mapValue(after.Properties, c.After != nil), 1, forced, sensitive)...)
+	// Providers may report changes of attributes that are not configured,
+	// such as the content of a rendered file
+	for _, attr := range c.Attributes {
+		_, inBefore := before.Properties[attr.Attribute]
+		_, inAfter := after.Properties[attr.Attribute]
+		if !inBefore && !inAfter {
+			lines = append(lines, p.diff(attr.Attribute, attr.Before, attr.After, 1, attr.RequiresReplace, sensitive[attr.Attribute])...)
+		}
+	}
+
+	// Keys are aligned per nesting level
+	width := make(map[int]int)
+	for _, l := range lines {
+		if !l.unchanged && len(l.key) > width[l.depth] {
+			width[l.depth] = len(l.key)
+		}
+	}
+	hidden := 0
+	for _, l := range lines {
+		if l.unchanged {
+			hidden++
+			continue
+		}
+		p.printLine(l, width[l.depth])
+	}
+	if hidden > 0 {
+		fmt.Fprintf(p.w, "        # (%d unchanged attribute(s) hidden)\n", hidden)
+	}
+	fmt.Fprint(p.w, "    }\n\n")
+}
+
+// diffLine is one line of a resource diff; nested maps produce an opening
+// line, their entries and a closing line
+type diffLine struct {
+	depth     int
+	marker    string
+	key       string
+	text      string
+	unchanged bool
+	// open and close mark the lines of a nested block, which are aligned
+	// on their own
+	open, close bool
+}
+
+func (p *diffPrinter) diff(key string, before, after interface{}, depth int, forcesReplacement, sensitive bool) []diffLine {
+	sensitive = sensitive || sensitiveKey.MatchString(key)
+
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		if m, ok := after.(map[string]interface{}); ok && !sensitive {
+			return p.block("+", key, nil, m, depth)
+		}
+		return []diffLine{{depth: depth, marker: "+", key: key, text: p.forces(p.format(after, sensitive), forcesReplacement)}}
+	case after == nil:
+		if m, ok := before.(map[string]interface{}); ok && !sensitive {
+			return p.block("-", key, m, nil, depth)
+		}
+		return []diffLine{{depth: depth, marker: "-", key: key, text: p.forces(p.format(before, sensitive)+" -> null", forcesReplacement)}}
+	case reflect.DeepEqual(before, after):
+		return []diffLine{{depth: depth, key: key, text: p.format(after, sensitive), unchanged: true}}
+	}
+
+	bm, bok := before.(map[string]interface{})
+	am, aok := after.(map[string]interface{})
+	if bok && aok && !sensitive {
+		return p.block("~", key, bm, am, depth)
+	}
+
+	text := p.format(before, sensitive) + " -> " + p.format(after, sensitive)
+	return []diffLine{{depth: depth, marker: "~", key: key, text: p.forces(text, forcesReplacement)}}
+}
+
+// forces annotates the change of an attribute that forces a replacement
+func (p *diffPrinter) forces(text string, forcesReplacement bool) string {
+	if forcesReplacement {
+		text += p.paint(" # forces replacement", output.ColorRed)
+	}
+	return text
+}
+
+func (p *diffPrinter) block(marker, key string, before, after map[string]interface{}, depth int) []diffLine {
+	lines := []diffLine{{depth: depth, marker: marker, key: key, text: "{", open: true}}
+	lines = append(lines, p.diffMaps(before, after, depth+1, nil, nil)...)
+	return append(lines, diffLine{depth: depth, text: "}", close: true})
+}
+
+// diffMaps diffs the entries of two maps; forced and sensitive mark keys
+// that force a replacement or must not be shown
+func (p *diffPrinter) diffMaps(before, after map[string]interface{}, depth int, forced, sensitive map[string]bool) []diffLine {
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var lines []diffLine
+	for _, k := range sorted {
+		lines = append(lines, p.diff(k, before[k], after[k], depth, forced[k], sensitive[k])...)
+	}
+	return lines
+}
+
+func (p *diffPrinter) printLine(l diffLine, width int) {
+	indent := strings.Repeat("    ", l.depth)
+	if l.close {
+		fmt.Fprintf(p.w, "%s  %s\n", indent, l.text)
+		return
+	}
+
+	marker := " "
+	if l.marker != "" {
+		marker = p.marker(l.marker)
+	}
+	if l.open {
+		fmt.Fprintf(p.w, "%s%s %s = %s\n", indent, marker, l.key, l.text)
+		return
+	}
+	fmt.Fprintf(p.w, "%s%s %-*s = %s\n", indent, marker, width, l.key, l.text)
+}
+
+// format renders a value for the diff, masking secrets
+func (p *diffPrinter) format(v interface{}, sensitive bool) string {
+	if v == nil {
+		return "null"
+	}
+	if sensitive || p.isSecret(v) {
+		return sensitiveValue
+	}
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// isSecret reports whether v holds a secret reference or a resolved secret
+func (p *diffPrinter) isSecret(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	text := string(data)
+	if strings.Contains(text, "${secret.") {
+		return true
+	}
+	for _, s := range p.secrets {
+		if strings.Contains(text, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *diffPrinter) marker(m string) string {
+	switch m {
+	case "+":
+		return p.paint(m, output.ColorGreen)
+	case "-":
+		return p.paint(m, output.ColorRed)
+	case "~":
+		return p.paint(m, output.ColorYellow)
+	case "-/+":
+		return p.paint("-", output.ColorRed) + "/" + p.paint("+", output.ColorGreen)
+	}
+	return m
+}
+
+func (p *diffPrinter) paint(s string, c output.Color) string {
+	if !p.color {
+		return s
+	}
+	return output.Colorize(s, c)
+}
+
+// mapValue converts properties for diffing; a missing side is nil, while an
+// existing resource without properties is an empty map
+func mapValue(props map[string]interface{}, exists bool) map[string]interface{} {
+	if !exists {
+		return nil
+	}
+	if props == nil {
+		return map[string]interface{}{}
+	}
+	return props
+}
+
+// stringsValue converts a list for diffing, so nil and empty compare equal
+func stringsValue(values []string) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/provider"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func testDiffPlan() *core.DeploymentPlan {
+	web := core.ResourceSpec{
+		Name:     "web",
+		Type:     "instance",
+		Provider: "cloud",
+		Properties: map[string]interface{}{
+			"size":     "small",
+			"image":    "app:1.0",
+			"tags":     map[string]interface{}{"team": "web", "tier": "frontend"},
+			"password": "hunter2",
+		},
+	}
+	webAfter := core.ResourceSpec{
+		Name:     "web",
+		Type:     "instance",
+		Provider: "cloud",
+		Properties: map[string]interface{}{
+			"size":     "large",
+			"image":    "app:1.0",
+			"tags":     map[string]interface{}{"team": "web", "owner": "ops"},
+			"password": "correct horse",
+		},
+		Dependencies: []string{"db"},
+	}
+	db := core.ResourceSpec{
+		Name:       "db",
+		Type:       "database",
+		Provider:   "cloud",
+		Properties: map[string]interface{}{"engine": "postgres", "version": 14, "dsn": "postgres://app:s3cret@db"},
+	}
+	dbAfter := db
+	dbAfter.Properties = map[string]interface{}{"engine": "postgres", "version": 15, "dsn": "postgres://app:n3w@db"}
+	cache := core.ResourceSpec{
+		Name:       "cache",
+		Type:       "cache",
+		Provider:   "cloud",
+		Properties: map[string]interface{}{"nodes": 2},
+	}
+	queue := core.ResourceSpec{
+		Name:       "queue",
+		Type:       "queue",
+		Provider:   "cloud",
+		Properties: map[string]interface{}{"fifo": true, "token": "${secret.queue_token}"},
+	}
+
+	return &core.DeploymentPlan{
+		Environment: "prod",
+		Changes: []provider.Change{
+			{Type: core.ChangeAdd, Resource: "queue", After: queue},
+			{
+				Type: core.ChangeUpdate, Resource: "web", Before: web, After: webAfter,
+				// The provider reports a rendered attribute that is not configured
+				Attributes: []plugin.AttributeChange{{Attribute: "user_data", Before: "#!/bin/sh", After: "#!/bin/bash"}},
+			},
+			{
+				Type: core.ChangeReplace, Resource: "db", Before: db, After: dbAfter,
+				ForcesReplacement: []string{"version"},
+				Sensitive:         []string{"dsn"},
+			},
+			{Type: core.ChangeDelete, Resource: "cache", Before: cache},
+		},
+		AddResources:     []core.ResourceSpec{queue},
+		UpdateResources:  []core.ResourceSpec{webAfter},
+		ReplaceResources: []core.ResourceSpec{dbAfter},
+		DeleteResources:  []core.ResourceSpec{cache},
+	}
+}
+
+func TestDiffPrinter(t *testing.T) {
+	tests := []struct {
+		name  string
+		color bool
+	}{
+		{name: "plan_diff"},
+		{name: "plan_diff_color", color: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &diffPrinter{w: &out, color: tt.color, secrets: []string{"correct horse"}}
+			p.printPlan(testDiffPlan())
+
+			path := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", path, out.Bytes(), want)
+			}
+		})
+	}
+}
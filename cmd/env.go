@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/state"
+	"gopkg.in/yaml.v3"
+)
+
+type envOptions struct {
+	from   string
+	set    []string
+	ttl    time.Duration
+	dryRun bool
+}
+
+var envOpts = &envOptions{}
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Create and clean up environments",
+}
+
+var envCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create an environment from an existing one",
+	Long: `Create an environment from the effective settings of an existing one,
+written to environments/<name>.yaml.
+
+Settings are overridden with --set path=value, where the value is parsed as
+YAML. With --ttl the environment is ephemeral, e.g. a preview stack for a
+pull request, and is destroyed by 'gort env gc' once expired.`,
+	Example: `  gort env create pr-123 --from staging --ttl 72h --set variables.branch=pr-123`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		overrides := make(map[string]interface{}, len(envOpts.set))
+		for _, s := range envOpts.set {
+			path, raw, ok := strings.Cut(s, "=")
+			if !ok || path == "" {
+				return fmt.Errorf("invalid --set %q, expected path=value", s)
+			}
+			var value interface{}
+			if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", path, err)
+			}
+			overrides[path] = value
+		}
+
+		logger := runLogger
+		em := core.NewEnvironmentManager(globalOpts.configFile, state.NewStateManager(globalOpts.stateDir), logger)
+		path, err := em.CreateEnvironment(args[0], envOpts.from, core.CreateOptions{
+			Overrides: overrides,
+			TTL:       envOpts.ttl,
+		})
+		if err != nil {
+			return err
+		}
+
+		created := createdEnvironment{Environment: args[0], From: envOpts.from, File: path}
+		if envOpts.ttl > 0 {
+			created.ExpiresAt = time.Now().Add(envOpts.ttl).UTC().Format(time.RFC3339)
+		}
+		return render(created)
+	},
+}
+
+var envGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Destroy expired ephemeral environments",
+	Long: `Destroy the resources of every ephemeral environment whose TTL has
+expired, then remove its configuration file and state.
+
+Resources are deleted using only the IDs and providers recorded in state:
+the environment configuration and secrets are not loaded, policies are not
+checked, nothing is prompted and a failed destroy is not rolled back.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), deployOpts.timeout)
+		defer cancel()
+
+		logger := runLogger
+		stateManager := state.NewStateManager(globalOpts.stateDir)
+		em := core.NewEnvironmentManager(globalOpts.configFile, stateManager, logger)
+		expired, err := em.ExpiredEnvironments(time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to find expired environments: %w", err)
+		}
+
+		var pluginManager *plugin.PluginManager
+		if len(expired) > 0 && !envOpts.dryRun {
+			if pluginManager, err = gcPluginManager(ctx); err != nil {
+				return err
+			}
+		}
+
+		results := make([]gcResult, 0, len(expired))
+		var failed []string
+		for _, env := range expired {
+			result := gcResult{Environment: env, Result: "destroyed"}
+			if envOpts.dryRun {
+				result.Result = "expired"
+			} else if err := destroyEnvironment(ctx, em, stateManager, pluginManager, env); err != nil {
+				result.Result = "failed"
+				result.Error = err.Error()
+				failed = append(failed, env)
+			}
+			results = append(results, result)
+		}
+
+		if err := render(results); err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to destroy %d environment(s): %s", len(failed), strings.Join(failed, ", "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	envCreateCmd.Flags().StringVar(&envOpts.from, "from", "", "Environment to copy")
+	envCreateCmd.Flags().StringArrayVar(&envOpts.set, "set", nil, "Override a setting, as path=value (repeatable)")
+	envCreateCmd.Flags().DurationVar(&envOpts.ttl, "ttl", 0, "Make the environment ephemeral, expiring after this duration")
+	envCreateCmd.MarkFlagRequired("from")
+
+	envGCCmd.Flags().BoolVar(&envOpts.dryRun, "dry-run", false, "Only list expired environments")
+	envGCCmd.Flags().IntVarP(&deployOpts.parallel, "parallel", "p", 1, "Number of resources deleted in parallel")
+	envGCCmd.Flags().DurationVar(&deployOpts.timeout, "timeout", 30*time.Minute, "Timeout for destroying all expired environments")
+	envGCCmd.Flags().BoolVar(&deployOpts.backupState, "backup-state", true, "Backup state before destroying an environment")
+
+	envCmd.AddCommand(envCreateCmd)
+	envCmd.AddCommand(envGCCmd)
+	rootCmd.AddCommand(envCmd)
+}
+
+// gcPluginManager returns a plugin manager with the provider settings of
+// the root configuration. Environments are not resolved, so expired ones
+// are collected even if their references or secrets no longer resolve.
+func gcPluginManager(ctx context.Context) (*plugin.PluginManager, error) {
+	cfg, err := config.LoadConfig(globalOpts.configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	pluginManager, err := newPluginManager(cfg, runLogger)
+	if err != nil {
+		return nil, err
+	}
+	if err := pluginManager.Initialize(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugin manager: %w", err)
+	}
+	return pluginManager, nil
+}
+
+// destroyEnvironment deletes every resource recorded in the state of env,
+// without prompting or rolling back, and removes the environment
+func destroyEnvironment(ctx context.Context, em *core.EnvironmentManager, sm *state.StateManager, pm *plugin.PluginManager, env string) error {
+	if deployOpts.backupState {
+		if err := backupState(sm, env); err != nil {
+			return fmt.Errorf("failed to backup state: %w", err)
+		}
+	}
+
+	deployer := core.NewDeployer(sm, pm, runLogger.WithField("environment", env), core.DeployerOptions{
+		Parallel: deployOpts.parallel,
+		RunID:    runLogger.RunID(),
+	})
+	plan, err := deployer.PlanDestroy(ctx, env)
+	if err != nil {
+		return err
+	}
+	if plan.HasChanges() {
+		if _, err := deployer.Deploy(ctx, plan); err != nil {
+			return fmt.Errorf("failed to destroy resources: %w", err)
+		}
+	}
+	return em.RemoveEnvironment(env)
+}
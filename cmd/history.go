@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/state"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [environment]",
+	Short: "Show the deployment history of an environment",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sm := state.NewStateManager(globalOpts.stateDir)
+		history, err := sm.History(args[0])
+		if err != nil {
+			return err
+		}
+		if len(history) == 0 {
+			return fmt.Errorf("environment %s has no deployment history", args[0])
+		}
+		return render(history)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+}
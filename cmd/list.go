@@ -2,36 +2,36 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/yahao333/gort/internal/config"
 )
 
 var listCmd = &cobra.Command{
-    Use:   "list",
-    Short: "List available environments",
-    RunE: func(cmd *cobra.Command, args []string) error {
-        cfg, err := config.LoadConfig("")
-        if err != nil {
-            return fmt.Errorf("failed to load config: %w", err)
-        }
+	Use:   "list",
+	Short: "List available environments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(globalOpts.configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
 
-        fmt.Println("Available Environments:")
-        fmt.Println("----------------------")
-        for name, env := range cfg.Environments {
-            fmt.Printf("- %s:\n", name)
-            fmt.Printf("  Provider: %s\n", env.Provider)
-            fmt.Printf("  Region: %s\n", env.Region)
-            if len(env.Tags) > 0 {
-                fmt.Printf("  Tags: %v\n", env.Tags)
-            }
-            fmt.Println()
-        }
-        
-        return nil
-    },
+		envs := make([]environmentSummary, 0, len(cfg.Environments))
+		for name, env := range cfg.Environments {
+			envs = append(envs, environmentSummary{
+				Name:     name,
+				Provider: env.Provider,
+				Region:   env.Region,
+				Tags:     env.Tags,
+			})
+		}
+		sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+
+		return render(envs)
+	},
 }
 
 func init() {
-    rootCmd.AddCommand(listCmd)
-}
\ No newline at end of file
+	rootCmd.AddCommand(listCmd)
+}
@@ -1,8 +1,19 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/approval"
 	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/state"
+)
+
+var (
+	planVersion string
+	planOut     string
 )
 
 var planCmd = &cobra.Command{
@@ -11,12 +22,92 @@ var planCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		env := args[0]
-		deployer := core.NewDeployer()
-		// TODO: Implement plan logic
+		logger := runLogger
+		logger.SetField("environment", env)
+
+		stateManager := state.NewStateManager(globalOpts.stateDir)
+		cfg, err := loadConfig(globalOpts.configFile, env, planVersion, stateManager)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		// Planning reads the resource schemas of the providers, and loads
+		// the plugins of providers that diff resources themselves or
+		// whose resources are refreshed to detect drift
+		pluginManager, err := newPluginManager(cfg, logger)
+		if err != nil {
+			return err
+		}
+		if err := pluginManager.Initialize(cmd.Context()); err != nil {
+			return fmt.Errorf("failed to initialize plugin manager: %w", err)
+		}
+		deployer := core.NewDeployer(stateManager, pluginManager, logger, core.DeployerOptions{
+			Version: planVersion,
+		})
+
+		plan, err := deployer.Plan(cmd.Context(), env, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create deployment plan: %w", err)
+		}
+
+		// Violations are rendered with the plan, mandatory ones also fail
+		// the command
+		violations, policyErr := checkPolicies(cfg, plan)
+		if violations == nil && policyErr != nil {
+			return policyErr
+		}
+
+		if err := render(planView{plan, violations}); err != nil {
+			return err
+		}
+		if policyErr != nil {
+			return policyErr
+		}
+
+		if planOut != "" {
+			return savePlan(plan, planOut, cfg.Environments[env].RequireApproval)
+		}
 		return nil
 	},
 }
 
 func init() {
-	planCmd.Flags().StringP("version", "v", "", "Version to plan")
+	planCmd.Flags().StringVarP(&planVersion, "version", "v", "", "Version to plan")
+	planCmd.Flags().StringVar(&planOut, "out", "", "Save the plan to a file, to be approved and deployed with --plan")
+}
+
+// savePlan writes the plan document to path
+func savePlan(plan *core.DeploymentPlan, path string, requiredApprovals int) error {
+	data, err := json.MarshalIndent(plan.Document(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Plan saved to %s (%s)\n", path, approval.Hash(data))
+	if requiredApprovals > 0 {
+		fmt.Fprintf(os.Stderr, "Environment %s requires %d approval(s): gort approve %s\n",
+			plan.Environment, requiredApprovals, path)
+	}
+	return nil
+}
+
+// readPlan loads a plan saved with savePlan, returning its hash
+func readPlan(path string) (*core.DeploymentPlan, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var doc core.PlanDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, "", fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	plan, err := doc.Plan()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+	return plan, approval.Hash(data), nil
 }
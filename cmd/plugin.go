@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/logging"
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+type pluginOptions struct {
+	source  string
+	upgrade bool
+}
+
+var pluginOpts = &pluginOptions{}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage provider plugins",
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available plugins",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, lock, err := scanPlugins(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		plugins := make([]pluginSummary, 0)
+		for _, info := range pm.List() {
+			plugins = append(plugins, newPluginSummary(info, lock))
+		}
+		return render(plugins)
+	},
+}
+
+var pluginInfoCmd = &cobra.Command{
+	Use:   "info [name]",
+	Short: "Show the installed versions of a plugin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pm, lock, err := scanPlugins(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		details := pluginDetails{Name: args[0], Versions: []pluginSummary{}}
+		for _, info := range pm.List() {
+			if info.Metadata.Name == args[0] {
+				details.Versions = append(details.Versions, newPluginSummary(info, lock))
+			}
+		}
+		if locked, ok := lock.Plugins[args[0]]; ok {
+			details.Locked = &locked
+		}
+		if len(details.Versions) == 0 && details.Locked == nil {
+			return fmt.Errorf("plugin %s is not installed", args[0])
+		}
+		return render(details)
+	},
+}
+
+var pluginInstallCmd = &cobra.Command{
+	Use:   "install [name[@version]...]",
+	Short: "Install plugins and pin them in the lock file",
+	Long: `Install plugins from a registry: a local directory or HTTP(S) URL holding
+an index.json. The registry defaults to plugins.registry in the
+configuration.
+
+Installed versions are pinned with their SHA-256 checksum in ` + plugin.LockFile + `
+next to the configuration. Without arguments, every locked plugin and the
+plugin of every configured provider is installed, honouring the provider's
+version. A locked version is kept while it matches, unless --upgrade is set.
+
+When plugins.trusted_keys is configured, only releases signed by one of the
+keys are installed.`,
+	Example: `  gort plugin install
+  gort plugin install aws@1.2 --source https://plugins.example.com`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(globalOpts.configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		source := pluginOpts.source
+		if source == "" {
+			source = cfg.Plugins.Registry
+		}
+		if source == "" {
+			return fmt.Errorf("no plugin registry, set --source or plugins.registry in the configuration")
+		}
+
+		lockPath := plugin.LockPath(cfg.Path())
+		lock, err := plugin.LoadLock(lockPath)
+		if err != nil {
+			return err
+		}
+		settings, err := pluginSettings(cfg)
+		if err != nil {
+			return err
+		}
+
+		wanted := make(map[string]string)
+		if len(args) == 0 {
+			for _, name := range lock.Names() {
+				wanted[name] = ""
+			}
+			for name, p := range settings {
+				wanted[name] = p.Version
+			}
+			// Built-in plugins need no install
+			for _, name := range plugin.Builtins() {
+				if _, locked := lock.Plugins[name]; !locked {
+					delete(wanted, name)
+				}
+			}
+		}
+		for _, arg := range args {
+			name, version, _ := strings.Cut(arg, "@")
+			wanted[name] = version
+		}
+		if len(wanted) == 0 {
+			return fmt.Errorf("no plugins to install")
+		}
+
+		index, err := plugin.FetchIndex(cmd.Context(), source)
+		if err != nil {
+			return err
+		}
+		installer := &plugin.Installer{
+			Dir:         globalOpts.pluginDir,
+			Lock:        lock,
+			TrustedKeys: cfg.Plugins.TrustedKeys,
+			Upgrade:     pluginOpts.upgrade,
+		}
+
+		names := make([]string, 0, len(wanted))
+		for name := range wanted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		installed := make([]pluginSummary, 0, len(names))
+		for _, name := range names {
+			in, err := installer.Install(cmd.Context(), index, name, wanted[name])
+			if err != nil {
+				return fmt.Errorf("failed to install plugin %s: %w", name, err)
+			}
+			installed = append(installed, newPluginSummary(plugin.PluginInfo{Metadata: &in.Metadata, Path: in.Path}, lock))
+		}
+
+		if err := lock.Save(lockPath); err != nil {
+			return err
+		}
+		return render(installed)
+	},
+}
+
+var pluginRemoveCmd = &cobra.Command{
+	Use:   "remove [name[@version]]",
+	Short: "Remove an installed plugin",
+	Long: `Remove the installed versions of a plugin, or only the given version, and
+unpin it from the lock file.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lockPath := plugin.LockPath(globalOpts.configFile)
+		lock, err := plugin.LoadLock(lockPath)
+		if err != nil {
+			return err
+		}
+
+		name, version, _ := strings.Cut(args[0], "@")
+		installer := &plugin.Installer{Dir: globalOpts.pluginDir, Lock: lock}
+		if err := installer.Remove(name, version); err != nil {
+			return err
+		}
+		if err := lock.Save(lockPath); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Removed plugin %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	pluginInstallCmd.Flags().StringVar(&pluginOpts.source, "source", "", "Plugin registry, a directory or URL (default plugins.registry)")
+	pluginInstallCmd.Flags().BoolVar(&pluginOpts.upgrade, "upgrade", false, "Install the latest matching versions instead of the locked ones")
+
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginInfoCmd)
+	pluginCmd.AddCommand(pluginInstallCmd)
+	pluginCmd.AddCommand(pluginRemoveCmd)
+	rootCmd.AddCommand(pluginCmd)
+}
+
+// pluginSettings maps the plugin of every configured provider to the
+// provider settings. Providers sharing a plugin share its instance, so they
+// must agree on its version and properties.
+func pluginSettings(cfg *config.Config) (map[string]config.Provider, error) {
+	settings := make(map[string]config.Provider)
+	for name, p := range cfg.Providers {
+		if p.Type == "" {
+			continue
+		}
+		if other, ok := settings[p.Type]; ok {
+			if other.Version != p.Version {
+				return nil, fmt.Errorf("providers require conflicting versions %q and %q of plugin %s (provider %s)",
+					other.Version, p.Version, p.Type, name)
+			}
+			if !reflect.DeepEqual(other.Properties, p.Properties) {
+				return nil, fmt.Errorf("providers using plugin %s have different properties (provider %s)", p.Type, name)
+			}
+		}
+		settings[p.Type] = p
+	}
+	return settings, nil
+}
+
+// newPluginManager returns a plugin manager configured with the provider
+// properties, restricted to the plugin versions required by the
+// configuration and pinned in its lock file
+func newPluginManager(cfg *config.Config, logger *logging.Logger) (*plugin.PluginManager, error) {
+	settings, err := pluginSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := plugin.LoadLock(plugin.LockPath(cfg.Path()))
+	if err != nil {
+		return nil, err
+	}
+
+	pm := plugin.NewPluginManager(globalOpts.pluginDir, logger)
+	for name, p := range settings {
+		pm.Require(name, p.Version)
+		pm.Configure(name, p.Properties)
+	}
+	pm.SetLock(lock)
+	return pm, nil
+}
+
+// scanPlugins returns the plugins of the plugin directory and the lock file
+func scanPlugins(ctx context.Context) (*plugin.PluginManager, *plugin.Lock, error) {
+	lock, err := plugin.LoadLock(plugin.LockPath(globalOpts.configFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pm := plugin.NewPluginManager(globalOpts.pluginDir, runLogger)
+	if err := pm.Initialize(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize plugin manager: %w", err)
+	}
+	return pm, lock, nil
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/output"
+	"github.com/yahao333/gort/internal/policy"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage deployment policies",
+}
+
+var policyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Run policy tests against their fixture plans",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := globalOpts.policyDir
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(globalOpts.configFile), policy.DefaultDir)
+		}
+
+		set, err := policy.Load(dir)
+		if err != nil {
+			return fmt.Errorf("failed to load policies: %w", err)
+		}
+		if len(set.Tests) == 0 {
+			return fmt.Errorf("no policy tests found in %s", dir)
+		}
+
+		results := set.RunTests()
+		if err := render(policyTestReport(results)); err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, r := range results {
+			if r.Result == policy.TestFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d policy test(s) failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyTestCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+// checkPolicies evaluates the policies of the configuration against a plan
+// and reports violations on stderr. It fails if a mandatory policy is
+// violated.
+func checkPolicies(cfg *config.Config, plan *core.DeploymentPlan) (policy.Results, error) {
+	dir := globalOpts.policyDir
+	if dir == "" {
+		dir = filepath.Join(cfg.Dir(), policy.DefaultDir)
+	}
+
+	set, err := policy.Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+
+	results, err := set.Evaluate(policy.Input{
+		Plan:   plan.Document(),
+		Config: cfg.Environments[plan.Environment],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate policies: %w", err)
+	}
+
+	color := output.ColorEnabled(os.Stderr)
+	for _, v := range results {
+		level := string(v.Level)
+		if color {
+			level = output.Colorize(level, output.StatusColor(level))
+		}
+		target := ""
+		if v.Resource != "" {
+			target = " (" + v.Resource + ")"
+		}
+		fmt.Fprintf(os.Stderr, "Policy %s violated [%s]%s: %s\n", v.Policy, level, target, v.Message)
+	}
+
+	if results.Blocking() {
+		return results, fmt.Errorf("plan violates mandatory policies")
+	}
+	return results, nil
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yahao333/gort/internal/policy"
+)
+
+const prodDeletePlan = `{
+  "format_version": 1,
+  "environment": "prod",
+  "summary": {"add": 0, "update": 0, "delete": 1, "replace": 0},
+  "changes": [
+    {"action": "delete", "resource": "db", "type": "database", "provider": "mock",
+     "before": {"name": "db", "type": "database", "properties": {"size": "xlarge"}}}
+  ]
+}`
+
+const policies = `
+policies:
+  - name: no-prod-deletes
+    level: mandatory
+    when: environment == "prod"
+    assert: summary.delete == 0 && summary.replace == 0
+  - name: instance-size
+    level: advisory
+    scope: change
+    when: change.type == "instance" && change.action != "delete"
+    assert: change.after.properties.size in ["small", "medium"]
+
+tests:
+  - name: prod delete is blocked
+    plan: fixtures/prod-delete.json
+    expect: [no-prod-deletes]
+  - name: large instance is reported
+    plan:
+      format_version: 1
+      environment: dev
+      changes:
+        - {action: add, resource: web, type: instance, after: {properties: {size: xlarge}}}
+    expect: [instance-size]
+`
+
+func writePolicies(t *testing.T, p *testProject, policyFile string) {
+	t.Helper()
+	dir := filepath.Join(p.dir, policy.DefaultDir)
+	if err := os.MkdirAll(filepath.Join(dir, "fixtures"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fixtures", "prod-delete.json"), []byte(prodDeletePlan), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(policyFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyTest(t *testing.T) {
+	tests := []struct {
+		name       string
+		policyFile string
+		wantErr    string
+		want       map[string]string
+	}{
+		{
+			name:       "passing",
+			policyFile: policies,
+			want:       map[string]string{"prod delete is blocked": policy.TestPassed, "large instance is reported": policy.TestPassed},
+		},
+		{
+			// Deletes are allowed in dev only, so the fixture no longer
+			// violates the policy
+			name:       "failing",
+			policyFile: strings.Replace(policies, `when: environment == "prod"`, `when: environment == "dev"`, 1),
+			wantErr:    "1 of 2 policy test(s) failed",
+			want:       map[string]string{"prod delete is blocked": policy.TestFailed, "large instance is reported": policy.TestPassed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProject(t, `version: "1"`)
+			writePolicies(t, p, tt.policyFile)
+
+			out, err := p.run(t, "policy", "test", "--output", "json")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("policy test: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("policy test error = %v, want %q", err, tt.wantErr)
+			}
+
+			var results []policy.TestResult
+			if err := json.Unmarshal([]byte(out), &results); err != nil {
+				t.Fatalf("failed to decode output %q: %v", out, err)
+			}
+			got := make(map[string]string)
+			for _, r := range results {
+				got[r.Name] = r.Result
+			}
+			for name, result := range tt.want {
+				if got[name] != result {
+					t.Errorf("test %q %s, want %s (%+v)", name, got[name], result, results)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/output"
+	"github.com/yahao333/gort/internal/state"
+)
+
+type promoteOptions struct {
+	from    string
+	to      string
+	planOut string
+}
+
+var promoteOpts = &promoteOptions{}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote [version]",
+	Short: "Promote a version from one environment to the next",
+	Long: `Promote a version that was deployed successfully to one environment to
+another, e.g. from staging to prod.
+
+The version must be the latest deployment of the source environment in its
+deployment history, that deployment must have succeeded and every resource
+of the source environment must be healthy. The configuration differences
+between both environments are shown before the target is planned and
+deployed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPromote,
+}
+
+func init() {
+	promoteCmd.Flags().StringVar(&promoteOpts.from, "from", "", "Environment to promote from")
+	promoteCmd.Flags().StringVar(&promoteOpts.to, "to", "", "Environment to promote to")
+	promoteCmd.Flags().StringVar(&promoteOpts.planOut, "out", "", "Save the plan for approval instead of deploying it")
+	promoteCmd.MarkFlagRequired("from")
+	promoteCmd.MarkFlagRequired("to")
+	addApplyFlags(promoteCmd)
+	rootCmd.AddCommand(promoteCmd)
+}
+
+func runPromote(cmd *cobra.Command, args []string) error {
+	version, from, to := args[0], promoteOpts.from, promoteOpts.to
+	if from == to {
+		return fmt.Errorf("cannot promote from %s to itself", from)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), deployOpts.timeout)
+	defer cancel()
+
+	stateManager := state.NewStateManager(globalOpts.stateDir)
+	if err := core.CheckPromotion(stateManager, from, version); err != nil {
+		return fmt.Errorf("cannot promote version %s: %w", version, err)
+	}
+
+	source, err := loadConfig(globalOpts.configFile, from, version, stateManager)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	d, err := prepareDeployment(ctx, to, core.DeployerOptions{Version: version, PromotedFrom: from})
+	if err != nil {
+		return err
+	}
+
+	diffs, err := config.CompareEnvironments(source.Environments[from], d.cfg.Environments[to])
+	if err != nil {
+		return err
+	}
+	printEnvironmentDiff(os.Stderr, from, to, diffs)
+
+	plan, err := d.deployer.Plan(ctx, to, d.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment plan: %w", err)
+	}
+
+	// Protected targets are deployed from an approved plan
+	required := d.cfg.Environments[to].RequireApproval
+	if promoteOpts.planOut != "" || required > 0 {
+		if promoteOpts.planOut == "" {
+			return fmt.Errorf("environment %s requires %d approval(s): save the plan with --out, "+
+				"have it approved with `gort approve` and deploy it with `gort deploy --plan`", to, required)
+		}
+		if _, err := checkPolicies(d.cfg, plan); err != nil {
+			return err
+		}
+		return savePlan(plan, promoteOpts.planOut, required)
+	}
+
+	result, err := d.apply(ctx, plan)
+	if err != nil || result == nil {
+		return err
+	}
+	return render(result)
+}
+
+// printEnvironmentDiff highlights the configuration differences between
+// the source and target of a promotion
+func printEnvironmentDiff(w io.Writer, from, to string, diffs []config.Difference) {
+	if len(diffs) == 0 {
+		fmt.Fprintf(w, "\nConfiguration of %s and %s is identical.\n", from, to)
+		return
+	}
+
+	p := &diffPrinter{w: w, color: output.ColorEnabled(os.Stderr)}
+	fmt.Fprintf(w, "\nConfiguration differences from %s to %s:\n\n", from, to)
+	for _, d := range diffs {
+		// Secret references are masked like sensitive properties
+		sensitive := sensitiveKey.MatchString(d.Path)
+		switch {
+		case d.From == nil:
+			fmt.Fprintf(w, "  %s %s = %s\n", p.marker("+"), d.Path, p.format(d.To, sensitive))
+		case d.To == nil:
+			fmt.Fprintf(w, "  %s %s = %s\n", p.marker("-"), d.Path, p.format(d.From, sensitive))
+		default:
+			fmt.Fprintf(w, "  %s %s = %s -> %s\n", p.marker("~"), d.Path,
+				p.format(d.From, sensitive), p.format(d.To, sensitive))
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package cmd
+
+// Providers compiled into gort, registered by their init functions
+import (
+	_ "github.com/yahao333/gort/internal/provider/docker"
+	_ "github.com/yahao333/gort/internal/provider/kubernetes"
+	_ "github.com/yahao333/gort/internal/provider/local"
+	_ "github.com/yahao333/gort/internal/provider/mock"
+)
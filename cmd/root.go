@@ -1,21 +1,127 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/yahao333/gort/internal/logging"
+	"github.com/yahao333/gort/internal/output"
 )
 
+// globalOptions are persistent flags shared by every command
+type globalOptions struct {
+	configFile string
+	stateDir   string
+	pluginDir  string
+	policyDir  string
+	output     string
+	columns    []string
+	sortBy     string
+	wide       bool
+	logFormat  string
+	logLevel   string
+	logFile    string
+}
+
+var globalOpts = &globalOptions{}
+
+// runLogger is the logger of the command being run, configured by the
+// logging flags before it runs
+var runLogger = logging.NewLogger(false)
+
 var rootCmd = &cobra.Command{
 	Use:   "gort",
 	Short: "GoRT - Infrastructure Release Tool",
 	Long: `GoRT is a tool for managing infrastructure deployments
            across different environments using terraform.`,
+	// main prints the returned error
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging(cmd)
+	},
+}
+
+// setupLogging configures runLogger from the logging flags. Logs go to
+// stderr, or are appended to --log-file, and carry the ID of the run.
+func setupLogging(cmd *cobra.Command) error {
+	opts := logging.Options{
+		Format: globalOpts.logFormat,
+		Level:  globalOpts.logLevel,
+		RunID:  logging.NewRunID(),
+	}
+	if !cmd.Flags().Changed("log-level") && os.Getenv("DEBUG") == "true" {
+		opts.Level = "debug"
+	}
+	if globalOpts.logFile != "" {
+		f, err := os.OpenFile(globalOpts.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		opts.Output = f
+	}
+
+	logger, err := logging.New(opts)
+	if err != nil {
+		return err
+	}
+	runLogger = logger
+	return nil
 }
 
 func Execute() error {
 	return rootCmd.Execute()
 }
 
+// newFormatter returns a formatter for the --output flag
+func newFormatter() (*output.Formatter, error) {
+	format, err := output.ParseFormat(globalOpts.output)
+	if err != nil {
+		return nil, err
+	}
+	formatter := output.NewFormatter(format)
+	formatter.SetTableOptions(output.TableOptions{
+		Columns: globalOpts.columns,
+		SortBy:  globalOpts.sortBy,
+		Wide:    globalOpts.wide,
+		Color:   output.ColorEnabled(os.Stdout),
+	})
+	return formatter, nil
+}
+
+// render prints a command result in the format selected by --output
+func render(data interface{}) error {
+	formatter, err := newFormatter()
+	if err != nil {
+		return err
+	}
+	return formatter.Format(data)
+}
+
 func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&globalOpts.configFile, "config", "gort.yaml", "Path to config file")
+	flags.StringVar(&globalOpts.stateDir, "state-dir", ".gort/state", "Directory for state files")
+	flags.StringVar(&globalOpts.pluginDir, "plugin-dir", ".gort/plugins", "Directory for plugins")
+	flags.StringVar(&globalOpts.policyDir, "policy-dir", "", "Directory for policies (default \"policies\" next to the config file)")
+	flags.StringVarP(&globalOpts.output, "output", "o", string(output.OutputFormatTable), "Output format: json, yaml, table, markdown, junit or checkstyle")
+	flags.StringSliceVar(&globalOpts.columns, "columns", nil, "Columns to show in table output")
+	flags.StringVar(&globalOpts.sortBy, "sort", "", "Column to sort table output by, prefix with - for descending")
+	flags.BoolVar(&globalOpts.wide, "wide", false, "Show all columns and do not truncate values in table output")
+	flags.StringVar(&globalOpts.logFormat, "log-format", logging.FormatText, "Log format: text or json")
+	flags.StringVar(&globalOpts.logLevel, "log-level", "info", "Log level: debug, info, warn or error (debug when DEBUG=true)")
+	flags.StringVar(&globalOpts.logFile, "log-file", "", "Append logs to this file instead of stderr")
+
+	// --format is accepted as an alias of --output
+	rootCmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "format" {
+			name = "output"
+		}
+		return pflag.NormalizedName(name)
+	})
+
 	// Add sub-commands
 	rootCmd.AddCommand(deployCmd)
 	rootCmd.AddCommand(planCmd)
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yahao333/gort/internal/secrets"
+)
+
+var (
+	secretsDir    string
+	secretsInline bool
+	secretsLength int
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the encrypted local secrets store",
+	Long: `Manage secrets kept in the encrypted local secrets store.
+
+Values are encrypted with AES-256-GCM using the key in ` + secrets.KeyEnvVar + `
+or <secrets-dir>/secrets.key, which is generated on first use.`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set [environment] [key]",
+	Short: "Set a secret, reading its value from stdin",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := readSecretValue()
+		if err != nil {
+			return err
+		}
+
+		store := secrets.NewStore(secretsDir)
+		if secretsInline {
+			enc, err := store.Encrypt(value)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt secret: %w", err)
+			}
+			fmt.Println(enc)
+			return nil
+		}
+
+		if err := store.Set(args[0], args[1], value); err != nil {
+			return fmt.Errorf("failed to set secret: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Secret %s set for environment %s\n", args[1], args[0])
+		return nil
+	},
+}
+
+var secretsGetCmd = &cobra.Command{
+	Use:   "get [environment] [key]",
+	Short: "Print the value of a secret",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := secrets.NewStore(secretsDir).Get(args[0], args[1])
+		if err != nil {
+			return fmt.Errorf("failed to get secret: %w", err)
+		}
+
+		return render(secretValue{Environment: args[0], Key: args[1], Value: value})
+	},
+}
+
+var secretsRotateCmd = &cobra.Command{
+	Use:   "rotate [environment] [key]",
+	Short: "Replace a secret with a new random value",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := secrets.NewStore(secretsDir).Rotate(args[0], args[1], secretsLength); err != nil {
+			return fmt.Errorf("failed to rotate secret: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Secret %s rotated for environment %s\n", args[1], args[0])
+		return nil
+	},
+}
+
+// readSecretValue reads a value from stdin so it never shows up in shell
+// history or process listings
+func readSecretValue() (string, error) {
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Value: ")
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return "", fmt.Errorf("failed to read secret value: %w", err)
+	}
+
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+func init() {
+	secretsCmd.PersistentFlags().StringVar(&secretsDir, "secrets-dir", secrets.DefaultDir, "Directory for the encrypted secrets store")
+	secretsSetCmd.Flags().BoolVar(&secretsInline, "inline", false, "Print an encrypted enc: value for the config instead of storing it")
+	secretsRotateCmd.Flags().IntVar(&secretsLength, "length", 32, "Length of the generated value")
+
+	secretsCmd.AddCommand(secretsSetCmd, secretsGetCmd, secretsRotateCmd)
+	rootCmd.AddCommand(secretsCmd)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/yahao333/gort/internal/state"
@@ -10,25 +11,40 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status [environment]",
 	Short: "Show the current status of an environment",
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Show the current status of an environment, or of every environment
+with saved state when none is given.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var env string
-		if len(args) > 0 {
-			env = args[0]
-		}
+		sm := state.NewStateManager(globalOpts.stateDir)
 
-		sm := state.NewStateManager(".")
-		state, err := sm.LoadState(env)
-		if err != nil {
-			return fmt.Errorf("failed to load state: %w", err)
+		envs := args
+		if len(envs) == 0 {
+			var err error
+			if envs, err = sm.ListEnvironments(); err != nil {
+				return fmt.Errorf("failed to list environments: %w", err)
+			}
 		}
 
-		// Print status
-		fmt.Printf("Environment: %s\n", state.Environment)
-		fmt.Printf("Last Update: %s\n", state.LastUpdate)
-		fmt.Printf("Resources: %d\n", len(state.Resources))
+		statuses := make([]environmentStatus, 0, len(envs))
+		for _, env := range envs {
+			state, err := sm.LoadState(env)
+			if err != nil {
+				return fmt.Errorf("failed to load state: %w", err)
+			}
+
+			status := environmentStatus{
+				Environment: env,
+				Version:     state.Version,
+				Resources:   len(state.Resources),
+				Outputs:     state.Outputs,
+			}
+			if !state.LastUpdate.IsZero() {
+				status.LastUpdate = state.LastUpdate.Format(time.RFC3339)
+			}
+			statuses = append(statuses, status)
+		}
 
-		return nil
+		return render(statuses)
 	},
 }
 
@@ -1,43 +1,145 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/plugin"
 	"github.com/yahao333/gort/internal/provider/terraform"
 )
 
 var validateCmd = &cobra.Command{
-    Use:   "validate [environment]",
-    Short: "Validate configuration and terraform files",
-    Args:  cobra.MaximumNArgs(1),
-    RunE: func(cmd *cobra.Command, args []string) error {
-        // Load and validate config
-        cfg, err := config.LoadConfig("")
-        if err != nil {
-            return fmt.Errorf("configuration validation failed: %w", err)
-        }
-
-        // If environment specified, validate specific environment
-        if len(args) > 0 {
-            env := args[0]
-            if _, exists := cfg.Environments[env]; !exists {
-                return fmt.Errorf("environment '%s' not found in configuration", env)
-            }
-
-            // Validate terraform configuration
-            provider := terraform.NewTerraformProvider(".")
-            if err := provider.Validate(env); err != nil {
-                return fmt.Errorf("terraform validation failed: %w", err)
-            }
-        }
-
-        fmt.Println("Validation successful!")
-        return nil
-    },
+	Use:   "validate [environment]",
+	Short: "Validate configuration and terraform files",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load and validate config, reporting every problem at once
+		cfg, err := config.LoadConfig(globalOpts.configFile)
+		if err != nil {
+			var verrs config.ValidationErrors
+			if !errors.As(err, &verrs) {
+				return fmt.Errorf("configuration validation failed: %w", err)
+			}
+			if err := render(validationResult{Errors: verrs}); err != nil {
+				return err
+			}
+			return fmt.Errorf("configuration validation failed: %d error(s)", len(verrs))
+		}
+
+		envs := make([]string, 0, len(cfg.Environments))
+		for name := range cfg.Environments {
+			envs = append(envs, name)
+		}
+		if len(args) > 0 {
+			if _, exists := cfg.Environments[args[0]]; !exists {
+				return fmt.Errorf("environment '%s' not found in configuration", args[0])
+			}
+			envs = args[:1]
+		}
+
+		// Check resource properties against the schemas of their providers
+		verrs, err := validateProperties(cmd.Context(), cfg, envs)
+		if err != nil {
+			return err
+		}
+		if len(verrs) > 0 {
+			if err := render(validationResult{Errors: verrs}); err != nil {
+				return err
+			}
+			return fmt.Errorf("configuration validation failed: %d error(s)", len(verrs))
+		}
+
+		// If environment specified, validate specific environment
+		if len(args) > 0 {
+			env := args[0]
+
+			// Validate the terraform files next to the configuration
+			provider := terraform.NewTerraformProvider(cfg.Dir())
+			if err := provider.Validate(env); err != nil {
+				return fmt.Errorf("terraform validation failed: %w", err)
+			}
+		}
+
+		return render(validationResult{Valid: true, Errors: []config.ValidationError{}})
+	},
 }
 
 func init() {
-    rootCmd.AddCommand(validateCmd)
-}
\ No newline at end of file
+	rootCmd.AddCommand(validateCmd)
+}
+
+// validateProperties checks the limits of every provider, and the
+// properties of the resources of envs against the schemas of their provider
+// plugins. Plugins that are not installed or have no schema are skipped.
+func validateProperties(ctx context.Context, cfg *config.Config, envs []string) (config.ValidationErrors, error) {
+	logger := runLogger
+	pm, err := newPluginManager(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := pm.Initialize(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugin manager: %w", err)
+	}
+
+	var errs config.ValidationErrors
+	providers := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	for _, name := range providers {
+		if _, err := plugin.ParseLimits(cfg.Providers[name].Properties); err != nil {
+			path := "providers." + name + ".properties"
+			errs = append(errs, config.ValidationError{Source: cfg.Source(path), Path: path, Message: err.Error()})
+		}
+	}
+
+	sort.Strings(envs)
+	schemas := make(map[string]*plugin.Schema)
+	for _, envName := range envs {
+		env := cfg.Environments[envName]
+		names := make([]string, 0, len(env.Resources))
+		for name := range env.Resources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			res := env.Resources[name]
+			pluginName := cfg.PluginName(env, res)
+			schema, seen := schemas[pluginName]
+			if !seen {
+				if schema, err = pm.Schema(ctx, pluginName); err != nil {
+					logger.Warnf("Not checking resources of provider %s: %v", pluginName, err)
+				}
+				schemas[pluginName] = schema
+			}
+			if schema == nil {
+				continue
+			}
+
+			path := "environments." + envName + ".resources." + name
+			for _, e := range schema.Validate(res.Type, res.Properties) {
+				at := path + ".type"
+				if e.Attribute != "" {
+					at = path + ".properties." + e.Attribute
+				}
+				// Missing properties are reported at their resource
+				src := cfg.Source(at)
+				if src.File == "" {
+					src = cfg.Source(path)
+				}
+				errs = append(errs, config.ValidationError{
+					Source:  src,
+					Path:    at,
+					Message: e.Message,
+				})
+			}
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/core"
+	"github.com/yahao333/gort/internal/output"
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/policy"
+)
+
+// planView renders a plan as one row per change in table format, as a
+// collapsible summary in Markdown, while JSON and YAML encode the versioned
+// plan document
+type planView struct {
+	*core.DeploymentPlan
+	violations policy.Results
+}
+
+// planDocument adds policy violations to the plan document
+type planDocument struct {
+	*core.PlanDocument `yaml:",inline"`
+	PolicyViolations   policy.Results `json:"policy_violations,omitempty" yaml:"policy_violations,omitempty"`
+}
+
+type planRow struct {
+	Action   string `table:"ACTION,status"`
+	Resource string `table:"RESOURCE"`
+	Type     string `table:"TYPE"`
+	Provider string `table:"PROVIDER"`
+}
+
+func (v planView) document() planDocument {
+	return planDocument{PlanDocument: v.Document(), PolicyViolations: v.violations}
+}
+
+func (v planView) MarshalJSON() ([]byte, error)      { return json.Marshal(v.document()) }
+func (v planView) MarshalYAML() (interface{}, error) { return v.document(), nil }
+
+func (v planView) TableRows() interface{} {
+	if !v.HasChanges() {
+		return []string{"No changes. Infrastructure is up-to-date."}
+	}
+	return v.rows()
+}
+
+func (v planView) rows() []planRow {
+	doc := v.Document()
+	rows := make([]planRow, 0, len(doc.Changes))
+	for _, c := range doc.Changes {
+		rows = append(rows, planRow{
+			Action:   c.Action,
+			Resource: c.Resource,
+			Type:     c.Type,
+			Provider: c.Provider,
+		})
+	}
+	return rows
+}
+
+// Markdown renders the plan as a pull request comment, with the changes
+// collapsed below the summary
+func (v planView) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Plan for `%s`", v.Environment)
+	if v.Version != "" {
+		fmt.Fprintf(&b, " (version `%s`)", v.Version)
+	}
+	b.WriteString("\n\n")
+
+	if !v.HasChanges() {
+		b.WriteString("No changes. Infrastructure is up-to-date.\n")
+		return b.String()
+	}
+
+	sum := v.Document().Summary
+	fmt.Fprintf(&b, "**%d to add, %d to change, %d to destroy.**\n\n",
+		sum.Add+sum.Replace, sum.Update, sum.Delete+sum.Replace)
+
+	headers := []string{"Action", "Resource", "Type", "Provider"}
+	var rows [][]string
+	for _, r := range v.rows() {
+		rows = append(rows, []string{r.Action, "`" + r.Resource + "`", r.Type, r.Provider})
+	}
+
+	fmt.Fprintf(&b, "<details>\n<summary>Show %d change(s)</summary>\n\n", len(rows))
+	b.WriteString(output.MarkdownTable(headers, rows))
+	b.WriteString("\n</details>\n")
+
+	if len(v.violations) > 0 {
+		rows = nil
+		for _, p := range v.violations {
+			rows = append(rows, []string{string(p.Level), p.Policy, p.Resource, p.Message})
+		}
+		fmt.Fprintf(&b, "\n#### Policy violations\n\n")
+		b.WriteString(output.MarkdownTable([]string{"Level", "Policy", "Resource", "Message"}, rows))
+	}
+	return b.String()
+}
+
+type environmentSummary struct {
+	Name     string            `json:"name" yaml:"name"`
+	Provider string            `json:"provider" yaml:"provider"`
+	Region   string            `json:"region,omitempty" yaml:"region,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+type environmentStatus struct {
+	Environment string                 `json:"environment" yaml:"environment"`
+	Version     string                 `json:"version,omitempty" yaml:"version,omitempty"`
+	LastUpdate  string                 `json:"last_update" yaml:"last_update"`
+	Resources   int                    `json:"resources" yaml:"resources"`
+	Outputs     map[string]interface{} `json:"outputs,omitempty" yaml:"outputs,omitempty" table:",wide"`
+}
+
+type createdEnvironment struct {
+	Environment string `json:"environment" yaml:"environment"`
+	From        string `json:"from" yaml:"from"`
+	File        string `json:"file" yaml:"file"`
+	ExpiresAt   string `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
+
+type gcResult struct {
+	Environment string `json:"environment" yaml:"environment"`
+	Result      string `json:"result" yaml:"result" table:"RESULT,status"`
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type validationResult struct {
+	Valid  bool                     `json:"valid" yaml:"valid"`
+	Errors []config.ValidationError `json:"errors" yaml:"errors"`
+}
+
+func (r validationResult) TableRows() interface{} {
+	if r.Valid {
+		return []string{"Validation successful!"}
+	}
+	return r.Errors
+}
+
+func (r validationResult) ReportName() string { return "gort validate" }
+func (r validationResult) Checks() []string   { return []string{"configuration"} }
+
+func (r validationResult) Findings() []output.Finding {
+	findings := make([]output.Finding, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		msg := e.Message
+		if e.Path != "" {
+			msg = e.Path + ": " + msg
+		}
+		findings = append(findings, output.Finding{
+			Check:    "configuration",
+			File:     e.Source.File,
+			Line:     e.Source.Line,
+			Column:   e.Source.Column,
+			Severity: "error",
+			Message:  msg,
+		})
+	}
+	return findings
+}
+
+type secretValue struct {
+	Environment string `json:"environment" yaml:"environment"`
+	Key         string `json:"key" yaml:"key"`
+	Value       string `json:"value" yaml:"value"`
+}
+
+func (s secretValue) TableRows() interface{} {
+	return []string{s.Value}
+}
+
+// policyTestReport renders policy test results, also as JUnit or checkstyle
+type policyTestReport []policy.TestResult
+
+func (r policyTestReport) ReportName() string { return "gort policy test" }
+
+func (r policyTestReport) Checks() []string {
+	checks := make([]string, 0, len(r))
+	for _, t := range r {
+		if t.Result == policy.TestPassed {
+			checks = append(checks, t.Name)
+		}
+	}
+	return checks
+}
+
+func (r policyTestReport) Findings() []output.Finding {
+	var findings []output.Finding
+	for _, t := range r {
+		if t.Result == policy.TestFailed {
+			findings = append(findings, output.Finding{
+				Check:    t.Name,
+				File:     t.File,
+				Severity: "error",
+				Message:  t.Message,
+			})
+		}
+	}
+	return findings
+}
+
+type pluginSummary struct {
+	Name        string   `json:"name" yaml:"name"`
+	Version     string   `json:"version" yaml:"version"`
+	APIVersion  int      `json:"api_version" yaml:"api_version" table:"API"`
+	Interfaces  []string `json:"interfaces" yaml:"interfaces"`
+	Locked      bool     `json:"locked" yaml:"locked"`
+	Builtin     bool     `json:"builtin" yaml:"builtin"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty" table:",wide"`
+	Path        string   `json:"path,omitempty" yaml:"path,omitempty" table:",wide"`
+}
+
+func newPluginSummary(info plugin.PluginInfo, lock *plugin.Lock) pluginSummary {
+	locked, ok := lock.Plugins[info.Metadata.Name]
+	return pluginSummary{
+		Name:        info.Metadata.Name,
+		Version:     info.Metadata.Version,
+		APIVersion:  info.Metadata.APIVersion,
+		Interfaces:  info.Metadata.Interfaces,
+		Locked:      ok && locked.Version == info.Metadata.Version && !info.Builtin,
+		Builtin:     info.Builtin,
+		Description: info.Metadata.Description,
+		Path:        info.Path,
+	}
+}
+
+// pluginDetails lists the installed versions of a plugin and its pin
+type pluginDetails struct {
+	Name     string               `json:"name" yaml:"name"`
+	Locked   *plugin.LockedPlugin `json:"locked,omitempty" yaml:"locked,omitempty"`
+	Versions []pluginSummary      `json:"versions" yaml:"versions"`
+}
+
+func (d pluginDetails) TableRows() interface{} {
+	return d.Versions
+}
@@ -19,20 +19,14 @@ func main() {
 	}
 
 	// Load AWS provider plugin
-	if err := pm.LoadPlugin(ctx, "aws-provider"); err != nil {
+	if err := pm.LoadPlugin(ctx, "aws"); err != nil {
 		log.Fatalf("Failed to load AWS provider plugin: %v", err)
 	}
 
-	// Get plugin instance
-	p, err := pm.GetPlugin("aws-provider")
+	// Get the plugin as a provider
+	provider, err := pm.GetProvider("aws")
 	if err != nil {
-		log.Fatalf("Failed to get plugin: %v", err)
-	}
-
-	// Cast to provider plugin
-	provider, ok := p.(plugin.ProviderPlugin)
-	if !ok {
-		log.Fatal("Invalid plugin type")
+		log.Fatalf("Failed to get provider plugin: %v", err)
 	}
 
 	// Use the provider
@@ -8,9 +8,10 @@ import (
 
 // Metadata exports plugin metadata
 var Metadata = &plugin.PluginMetadata{
-	Name:        "aws-provider",
+	Name:        "aws",
 	Version:     "1.0.0",
-	Type:        "provider",
+	APIVersion:  plugin.APIVersion,
+	Interfaces:  []string{plugin.InterfaceProvider},
 	Author:      "Your Name",
 	Description: "AWS infrastructure provider",
 	Properties: map[string]string{
@@ -71,3 +72,6 @@ func (p *AWSProvider) GetResource(ctx context.Context, id string) (*plugin.Resou
 	// Implement AWS resource retrieval
 	return nil, nil
 }
+
+// main is required by -buildmode=plugin and never called
+func main() {}
@@ -0,0 +1,181 @@
+package approval
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yahao333/gort/internal/state"
+)
+
+// KeyEnv holds a base64 ed25519 private key seed, used instead of the key
+// file, e.g. in CI
+const KeyEnv = "GORT_APPROVAL_KEY"
+
+// DefaultKeyPath returns where the approval signing key of the current user
+// is kept
+func DefaultKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".gort", "approval.key")
+	}
+	return filepath.Join(home, ".gort", "approval.key")
+}
+
+// LoadKey returns the signing key from KeyEnv or the key file, creating the
+// file with a new key when it does not exist yet
+func LoadKey(path string) (key ed25519.PrivateKey, created bool, err error) {
+	if encoded := os.Getenv(KeyEnv); encoded != "" {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid %s: %w", KeyEnv, err)
+		}
+		return key, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := decodeKey(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid approval key %s: %w", path, err)
+		}
+		return key, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, fmt.Errorf("failed to read approval key: %w", err)
+	}
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate approval key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, false, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Seed())
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, false, fmt.Errorf("failed to write approval key: %w", err)
+	}
+	return key, true, nil
+}
+
+func decodeKey(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("expected a %d byte seed, got %d bytes", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// PublicKey returns the base64 public key of a signing key, as listed in
+// the approvers of an environment
+func PublicKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// Hash identifies the contents of a saved plan
+func Hash(plan []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(plan))
+}
+
+// Sign records the approval of a plan by user
+func Sign(key ed25519.PrivateKey, env, planHash, user string, at time.Time) state.Approval {
+	a := state.Approval{
+		Environment: env,
+		PlanHash:    planHash,
+		User:        user,
+		Time:        at.UTC(),
+		PublicKey:   PublicKey(key),
+	}
+	a.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, message(a)))
+	return a
+}
+
+// Verify checks the signature of an approval
+func Verify(a state.Approval) error {
+	pub, err := base64.StdEncoding.DecodeString(a.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(a.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), message(a), sig) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+func message(a state.Approval) []byte {
+	return []byte(strings.Join([]string{
+		"gort-approval-v1",
+		a.Environment,
+		a.PlanHash,
+		a.User,
+		a.Time.UTC().Format(time.RFC3339Nano),
+	}, "\n"))
+}
+
+// Status summarizes the approvals of a plan
+type Status struct {
+	Environment string   `json:"environment" yaml:"environment"`
+	PlanHash    string   `json:"plan_hash" yaml:"plan_hash"`
+	Required    int      `json:"required" yaml:"required"`
+	Approvers   []string `json:"approvers" yaml:"approvers"`
+	// Rejected lists approvals that were ignored and why
+	Rejected []string `json:"rejected,omitempty" yaml:"rejected,omitempty" table:",wide"`
+}
+
+// Approved reports whether enough distinct users approved the plan
+func (s Status) Approved() bool {
+	return len(s.Approvers) >= s.Required
+}
+
+// Check counts the distinct approvers with a valid approval of the plan.
+// Only approvals by users listed in trusted, signed with their listed
+// public key, count; users and keys are each counted once.
+func Check(approvals []state.Approval, env, planHash string, required int, trusted map[string]string) Status {
+	status := Status{Environment: env, PlanHash: planHash, Required: required, Approvers: []string{}}
+	seenUsers := make(map[string]bool)
+	seenKeys := make(map[string]bool)
+
+	for _, a := range approvals {
+		if a.Environment != env || a.PlanHash != planHash || seenUsers[a.User] {
+			continue
+		}
+		if err := Verify(a); err != nil {
+			status.Rejected = append(status.Rejected, fmt.Sprintf("%s: %v", a.User, err))
+			continue
+		}
+		key, ok := trusted[a.User]
+		if !ok {
+			status.Rejected = append(status.Rejected, fmt.Sprintf("%s: not an approver of %s", a.User, env))
+			continue
+		}
+		if key != a.PublicKey {
+			status.Rejected = append(status.Rejected, fmt.Sprintf("%s: signed with an unknown key", a.User))
+			continue
+		}
+		if seenKeys[a.PublicKey] {
+			status.Rejected = append(status.Rejected, fmt.Sprintf("%s: key already used by another approval", a.User))
+			continue
+		}
+		seenUsers[a.User] = true
+		seenKeys[a.PublicKey] = true
+		status.Approvers = append(status.Approvers, a.User)
+	}
+
+	sort.Strings(status.Approvers)
+	return status
+}
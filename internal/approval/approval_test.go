@@ -0,0 +1,114 @@
+package approval
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yahao333/gort/internal/state"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestCheck(t *testing.T) {
+	const env, hash = "prod", "sha256:plan"
+	alice, bob, carol, mallory := newKey(t), newKey(t), newKey(t), newKey(t)
+	trusted := map[string]string{
+		"alice": PublicKey(alice),
+		"bob":   PublicKey(bob),
+		"carol": PublicKey(carol),
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	sign := func(key ed25519.PrivateKey, user string) state.Approval {
+		return Sign(key, env, hash, user, at)
+	}
+	tampered := sign(bob, "bob")
+	tampered.Time = at.Add(time.Hour)
+
+	tests := []struct {
+		name         string
+		approvals    []state.Approval
+		required     int
+		wantApproved []string
+		wantRejected []string
+	}{
+		{
+			name:         "distinct approvers",
+			approvals:    []state.Approval{sign(bob, "bob"), sign(alice, "alice")},
+			required:     2,
+			wantApproved: []string{"alice", "bob"},
+		},
+		{
+			name:         "same user approving twice counts once",
+			approvals:    []state.Approval{sign(alice, "alice"), sign(alice, "alice")},
+			required:     2,
+			wantApproved: []string{"alice"},
+		},
+		{
+			name:         "user not an approver",
+			approvals:    []state.Approval{sign(alice, "alice"), sign(mallory, "mallory")},
+			required:     2,
+			wantApproved: []string{"alice"},
+			wantRejected: []string{"mallory: not an approver of prod"},
+		},
+		{
+			name:         "approver signing with another key",
+			approvals:    []state.Approval{sign(mallory, "carol")},
+			required:     1,
+			wantApproved: []string{},
+			wantRejected: []string{"carol: signed with an unknown key"},
+		},
+		{
+			name:         "one key used for two approvers",
+			approvals:    []state.Approval{sign(alice, "alice"), sign(alice, "bob")},
+			required:     2,
+			wantApproved: []string{"alice"},
+			wantRejected: []string{"bob: signed with an unknown key"},
+		},
+		{
+			name:         "bad signature",
+			approvals:    []state.Approval{tampered, sign(carol, "carol")},
+			required:     2,
+			wantApproved: []string{"carol"},
+			wantRejected: []string{"bob: signature does not match"},
+		},
+		{
+			name: "approvals of other plans and environments are ignored",
+			approvals: []state.Approval{
+				Sign(alice, env, "sha256:other", "alice", at),
+				Sign(bob, "staging", hash, "bob", at),
+				sign(carol, "carol"),
+			},
+			required:     2,
+			wantApproved: []string{"carol"},
+		},
+		{
+			name:         "no approvals",
+			required:     1,
+			wantApproved: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := Check(tt.approvals, env, hash, tt.required, trusted)
+			if !reflect.DeepEqual(status.Approvers, tt.wantApproved) {
+				t.Errorf("approvers = %v, want %v", status.Approvers, tt.wantApproved)
+			}
+			if !reflect.DeepEqual(status.Rejected, tt.wantRejected) {
+				t.Errorf("rejected = %q, want %q", status.Rejected, tt.wantRejected)
+			}
+			if want := len(tt.wantApproved) >= tt.required; status.Approved() != want {
+				t.Errorf("Approved() = %v with %d of %d approvals", status.Approved(), len(status.Approvers), tt.required)
+			}
+		})
+	}
+}
@@ -1,101 +1,149 @@
 package backup
 
 import (
-    "archive/zip"
-    "fmt"
-    "io"
-    "os"
-    "path/filepath"
-    "time"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yahao333/gort/internal/logging"
 )
 
 type BackupManager struct {
-    backupDir string
-    logger    *Logger
+	backupDir string
+	logger    logging.Log
 }
 
 type BackupMetadata struct {
-    Timestamp   time.Time `json:"timestamp"`
-    Environment string    `json:"environment"`
-    Version     string    `json:"version"`
-    Type        string    `json:"type"`
+	Timestamp   time.Time `json:"timestamp"`
+	Environment string    `json:"environment"`
+	Version     string    `json:"version"`
+	Type        string    `json:"type"`
 }
 
-func NewBackupManager(backupDir string, logger *Logger) *BackupManager {
-    return &BackupManager{
-        backupDir: backupDir,
-        logger:    logger,
-    }
+// NewBackupManager creates a backup manager; a nil logger discards its logs
+func NewBackupManager(backupDir string, logger logging.Log) *BackupManager {
+	if logger == nil {
+		logger = logging.Discard
+	}
+	return &BackupManager{
+		backupDir: backupDir,
+		logger:    logger,
+	}
 }
 
 func (bm *BackupManager) CreateBackup(env string, sourceDir string) (string, error) {
-    timestamp := time.Now().Format("20060102-150405")
-    backupFile := filepath.Join(bm.backupDir, fmt.Sprintf("%s-%s.zip", env, timestamp))
-
-    if err := os.MkdirAll(bm.backupDir, 0755); err != nil {
-        return "", fmt.Errorf("failed to create backup directory: %w", err)
-    }
-
-    zipfile, err := os.Create(backupFile)
-    if err != nil {
-        return "", fmt.Errorf("failed to create backup file: %w", err)
-    }
-    defer zipfile.Close()
-
-    archive := zip.NewWriter(zipfile)
-    defer archive.Close()
-
-    err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-        if err != nil {
-            return err
-        }
-
-        if info.IsDir() {
-            return nil
-        }
-
-        relPath, err := filepath.Rel(sourceDir, path)
-        if err != nil {
-            return err
-        }
-
-        zipFile, err := archive.Create(relPath)
-        if err != nil {
-            return err
-        }
-
-        fsFile, err := os.Open(path)
-        if err != nil {
-            return err
-        }
-        defer fsFile.Close()
-
-        _, err = io.Copy(zipFile, fsFile)
-        return err
-    })
-
-    if err != nil {
-        return "", fmt.Errorf("failed to create backup: %w", err)
-    }
-
-    bm.logger.Infof("Created backup: %s", backupFile)
-    return backupFile, nil
+	timestamp := time.Now().Format("20060102-150405")
+	backupFile := filepath.Join(bm.backupDir, fmt.Sprintf("%s-%s.zip", env, timestamp))
+
+	if err := os.MkdirAll(bm.backupDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	zipfile, err := os.Create(backupFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer zipfile.Close()
+
+	archive := zip.NewWriter(zipfile)
+	defer archive.Close()
+
+	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+
+		zipFile, err := archive.Create(relPath)
+		if err != nil {
+			return err
+		}
+
+		fsFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fsFile.Close()
+
+		_, err = io.Copy(zipFile, fsFile)
+		return err
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	bm.logger.Infof("Created backup: %s", backupFile)
+	return backupFile, nil
 }
 
 func (bm *BackupManager) RestoreBackup(backupFile string, targetDir string) error {
-    reader, err := zip.OpenReader(backupFile)
-    if err != nil {
-        return fmt.Errorf("failed to open backup file: %w", err)
-    }
-    defer reader.Close()
-
-    for _, file := range reader.File {
-        path := filepath.Join(targetDir, file.Name)
-
-        if file.FileInfo().IsDir() {
-            os.MkdirAll(path, file.Mode())
-            continue
-        }
-
-        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-            return fmt.Errorf("failed to create directory: %w
\ No newline at end of file
+	reader, err := zip.OpenReader(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		path := filepath.Join(targetDir, file.Name)
+		if !within(targetDir, path) {
+			return fmt.Errorf("invalid path %s in backup", file.Name)
+		}
+
+		if file.FileInfo().IsDir() {
+			os.MkdirAll(path, file.Mode())
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		if err := extractFile(file, path); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Name, err)
+		}
+	}
+
+	bm.logger.Infof("Restored backup %s to %s", backupFile, targetDir)
+	return nil
+}
+
+// extractFile writes a file of a backup archive to path
+func extractFile(file *zip.File, path string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// within reports whether path is inside dir
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
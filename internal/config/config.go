@@ -2,30 +2,109 @@ package config
 
 import (
 	"fmt"
-	"os"
-
-	"gopkg.in/yaml.v3"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Version      string                 `yaml:"version"`
+	Include      []string               `yaml:"include,omitempty"`
 	Environments map[string]Environment `yaml:"environments"`
 	Providers    map[string]Provider    `yaml:"providers"`
 	Defaults     map[string]interface{} `yaml:"defaults"`
+	Plugins      PluginSettings         `yaml:"plugins,omitempty"`
+
+	path    string
+	values  map[string]interface{}
+	sources Sources
 }
 
 type Environment struct {
 	Provider  string                 `yaml:"provider"`
 	Region    string                 `yaml:"region"`
 	Variables map[string]interface{} `yaml:"variables"`
+	Secrets   map[string]string      `yaml:"secrets,omitempty"`
 	Tags      map[string]string      `yaml:"tags"`
 	Backend   *Backend               `yaml:"backend,omitempty"`
+	Resources map[string]Resource    `yaml:"resources,omitempty"`
+	// RequireApproval is the number of distinct users that must approve a
+	// saved plan before it can be deployed
+	RequireApproval int `yaml:"require_approval,omitempty"`
+	// Approvers lists who may approve, mapping user names to their base64
+	// ed25519 public keys; required with RequireApproval
+	Approvers map[string]string `yaml:"approvers,omitempty"`
+}
+
+// Resource declares a resource managed in an environment
+type Resource struct {
+	Type string `yaml:"type"`
+	// Provider defaults to the provider of the environment
+	Provider   string                 `yaml:"provider,omitempty"`
+	Properties map[string]interface{} `yaml:"properties"`
+	DependsOn  []string               `yaml:"depends_on,omitempty"`
+	// Ready is the condition the resource must reach after it is created
+	// or updated, before resources depending on it are deployed
+	Ready *ReadyCondition `yaml:"ready,omitempty"`
+	// Timeout bounds the provider operations on the resource and the wait
+	// until it is ready, e.g. 15m
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retry overrides the retry policy of the provider for the resource
+	Retry *RetryPolicy `yaml:"retry,omitempty"`
+}
+
+// ReadyCondition declares when a resource is ready; every condition that is
+// set must hold
+type ReadyCondition struct {
+	// Status is the resource status reported by the provider
+	Status string `yaml:"status,omitempty" json:"status,omitempty"`
+	// Attributes must match the properties reported by the provider
+	Attributes map[string]interface{} `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+	// HealthCheck is an http(s) URL that must answer with a 2xx status, or
+	// tcp://host:port that must accept connections
+	HealthCheck string `yaml:"health_check,omitempty" json:"health_check,omitempty"`
+	// Interval is the delay before the first check, doubled after every
+	// failed one
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"`
 }
 
 type Provider struct {
 	Type       string                 `yaml:"type"`
 	Version    string                 `yaml:"version"`
 	Properties map[string]interface{} `yaml:"properties"`
+	// Defaults are environment settings applied to every environment
+	// using this provider, on top of the global defaults.
+	Defaults map[string]interface{} `yaml:"defaults,omitempty"`
+	// Retry is the retry policy of calls to the provider
+	Retry *RetryPolicy `yaml:"retry,omitempty"`
+}
+
+// RetryPolicy controls how failed provider calls are retried. Errors the
+// provider marks as retryable, and errors matching RetryOn, are retried
+// with exponential backoff and jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made, including the first
+	MaxAttempts int `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	// InitialDelay is the delay before the first retry, doubled after
+	// every retry up to MaxDelay
+	InitialDelay string `yaml:"initial_delay,omitempty" json:"initial_delay,omitempty"`
+	MaxDelay     string `yaml:"max_delay,omitempty" json:"max_delay,omitempty"`
+	// RetryOn are regular expressions matched against error messages
+	RetryOn []string `yaml:"retry_on,omitempty" json:"retry_on,omitempty"`
+}
+
+// PluginSettings configures where plugins are installed from
+type PluginSettings struct {
+	// Registry is the default source of 'gort plugin install', a directory
+	// or HTTP(S) URL holding an index.json
+	Registry string `yaml:"registry,omitempty"`
+	// TrustedKeys are base64 ed25519 public keys; when set, plugins must be
+	// signed by one of them
+	TrustedKeys []string `yaml:"trusted_keys,omitempty"`
 }
 
 type Backend struct {
@@ -33,44 +112,366 @@ type Backend struct {
 	Config map[string]interface{} `yaml:"config"`
 }
 
-// LoadConfig loads configuration from the specified path
+// LoadConfig loads configuration from the specified path, merging included
+// files, per-environment files and layered defaults
 func LoadConfig(path string) (*Config, error) {
 	if path == "" {
 		path = "gort.yaml"
 	}
 
-	data, err := os.ReadFile(path)
+	var errs ValidationErrors
+	merged, err := loadFiles(path, make(map[string]bool), &errs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
+	if err := loadEnvironmentFiles(path, merged, &errs); err != nil {
+		return nil, err
+	}
+
+	applyLayers(merged)
+
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := decodeValue(merged.values, &config); err != nil {
+		if len(errs) > 0 {
+			errs.sort()
+			return nil, fmt.Errorf("invalid configuration: %w", errs)
+		}
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	config.path = path
+	config.values = merged.values
+	config.sources = merged.sources
 
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	if verrs, ok := config.Validate().(ValidationErrors); ok {
+		errs = append(errs, verrs...)
+	}
+	if len(errs) > 0 {
+		errs.sort()
+		return nil, fmt.Errorf("invalid configuration: %w", errs)
 	}
 
 	return &config, nil
 }
 
+// Path returns the root file the configuration was loaded from
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Dir returns the directory containing the root config file
+func (c *Config) Dir() string {
+	return filepath.Dir(c.path)
+}
+
+// Source returns where the value at a dotted path was defined. For a
+// mapping it is the earliest value defined below it.
+func (c *Config) Source(path string) Source {
+	if src, ok := c.sources[path]; ok {
+		return src
+	}
+
+	var first Source
+	prefix := path + "."
+	for k, src := range c.sources {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if first.File == "" || src.File < first.File || (src.File == first.File && src.Line < first.Line) {
+			first = src
+		}
+	}
+	return first
+}
+
+// PluginName returns the plugin managing a resource of an environment: the
+// type of its provider, or the provider name for providers without a type
+func (c *Config) PluginName(env Environment, res Resource) string {
+	providerName := res.Provider
+	if providerName == "" {
+		providerName = env.Provider
+	}
+	if pluginName := c.Providers[providerName].Type; pluginName != "" {
+		return pluginName
+	}
+	return providerName
+}
+
+// RetryPolicy returns the retry policy of a resource: the settings of the
+// resource over those of its provider, or nil when neither has any
+func (c *Config) RetryPolicy(env Environment, res Resource) *RetryPolicy {
+	providerName := res.Provider
+	if providerName == "" {
+		providerName = env.Provider
+	}
+	base, override := c.Providers[providerName].Retry, res.Retry
+	if base == nil {
+		return override
+	}
+	if override == nil {
+		return base
+	}
+
+	merged := *base
+	if override.MaxAttempts != 0 {
+		merged.MaxAttempts = override.MaxAttempts
+	}
+	if override.InitialDelay != "" {
+		merged.InitialDelay = override.InitialDelay
+	}
+	if override.MaxDelay != "" {
+		merged.MaxDelay = override.MaxDelay
+	}
+	if override.RetryOn != nil {
+		merged.RetryOn = override.RetryOn
+	}
+	return &merged
+}
+
+// SetVariable sets a variable of an environment, overriding the configured
+// value, so it can be referenced as ${var.<name>} once resolved
+func (c *Config) SetVariable(envName, name string, value interface{}) error {
+	env, exists := c.Environments[envName]
+	if !exists {
+		return fmt.Errorf("environment '%s' not found in configuration", envName)
+	}
+
+	vars := make(map[string]interface{}, len(env.Variables)+1)
+	for k, v := range env.Variables {
+		vars[k] = v
+	}
+	vars[name] = value
+	env.Variables = vars
+	c.Environments[envName] = env
+
+	envs, _ := c.values["environments"].(map[string]interface{})
+	if values, ok := envs[envName].(map[string]interface{}); ok {
+		rawVars, _ := values["variables"].(map[string]interface{})
+		if rawVars == nil {
+			rawVars = make(map[string]interface{})
+			values["variables"] = rawVars
+		}
+		rawVars[name] = value
+	}
+	return nil
+}
+
+// Explain returns every effective value of an environment, including the
+// settings of the provider it uses, together with the file that set it.
+func (c *Config) Explain(envName string) ([]Value, error) {
+	env, exists := c.Environments[envName]
+	if !exists {
+		return nil, fmt.Errorf("environment '%s' not found in configuration", envName)
+	}
+
+	envPath := joinPath("environments", envName)
+	values := c.explain(envPath)
+	if env.Provider != "" {
+		values = append(values, c.explain(joinPath("providers", env.Provider))...)
+	}
+
+	return values, nil
+}
+
+func (c *Config) explain(path string) []Value {
+	var cur interface{} = c.values
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+
+	return flatten(path, cur, c.sources)
+}
+
+// EnvironmentValues returns a copy of the effective settings of an
+// environment as in the configuration files, before references are
+// resolved
+func (c *Config) EnvironmentValues(name string) (map[string]interface{}, error) {
+	envs, _ := c.values["environments"].(map[string]interface{})
+	values, ok := envs[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("environment '%s' not found in configuration", name)
+	}
+	return deepCopy(values).(map[string]interface{}), nil
+}
+
+// Difference is a setting whose value differs between two environments. A
+// nil value means the setting is not set.
+type Difference struct {
+	Path string      `json:"path" yaml:"path"`
+	From interface{} `json:"from" yaml:"from"`
+	To   interface{} `json:"to" yaml:"to"`
+}
+
+// CompareEnvironments returns the settings that differ between two
+// environments, by dotted path
+func CompareEnvironments(from, to Environment) ([]Difference, error) {
+	var a, b map[string]interface{}
+	if err := decodeValue(from, &a); err != nil {
+		return nil, fmt.Errorf("failed to compare environments: %w", err)
+	}
+	if err := decodeValue(to, &b); err != nil {
+		return nil, fmt.Errorf("failed to compare environments: %w", err)
+	}
+
+	values := make(map[string][2]interface{})
+	for _, v := range flatten("", a, nil) {
+		values[v.Path] = [2]interface{}{v.Value, nil}
+	}
+	for _, v := range flatten("", b, nil) {
+		pair := values[v.Path]
+		pair[1] = v.Value
+		values[v.Path] = pair
+	}
+
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var diffs []Difference
+	for _, path := range paths {
+		pair := values[path]
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			diffs = append(diffs, Difference{Path: path, From: pair[0], To: pair[1]})
+		}
+	}
+	return diffs, nil
+}
+
+// Validate checks references between sections and returns every problem
+// found as ValidationErrors
 func (c *Config) Validate() error {
+	var errs ValidationErrors
 	if len(c.Environments) == 0 {
-		return fmt.Errorf("no environments defined")
+		errs.add(Source{File: c.path}, "", "no environments defined")
+	}
+
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	for name, env := range c.Environments {
+	for _, name := range names {
+		env := c.Environments[name]
+		path := joinPath("environments", name)
 		if env.Provider == "" {
-			return fmt.Errorf("provider not specified for environment %s", name)
+			errs.add(c.Source(path), path, "provider not specified for environment %s", name)
+			continue
 		}
 
 		if _, exists := c.Providers[env.Provider]; !exists {
-			return fmt.Errorf("undefined provider '%s' referenced in environment %s",
-				env.Provider, name)
+			errs.add(c.Source(joinPath(path, "provider")), joinPath(path, "provider"),
+				"undefined provider '%s' referenced in environment %s", env.Provider, name)
+		}
+
+		if env.RequireApproval < 0 {
+			errs.add(c.Source(joinPath(path, "require_approval")), joinPath(path, "require_approval"),
+				"require_approval must not be negative")
+		} else if env.RequireApproval > 0 && len(env.Approvers) == 0 {
+			errs.add(c.Source(joinPath(path, "require_approval")), joinPath(path, "require_approval"),
+				"require_approval needs a list of approvers")
+		} else if env.RequireApproval > len(env.Approvers) {
+			errs.add(c.Source(joinPath(path, "require_approval")), joinPath(path, "require_approval"),
+				"require_approval is %d but only %d approver(s) are configured", env.RequireApproval, len(env.Approvers))
 		}
+
+		c.validateResources(name, env, &errs)
 	}
 
+	providers := make([]string, 0, len(c.Providers))
+	for name := range c.Providers {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	for _, name := range providers {
+		if retry := c.Providers[name].Retry; retry != nil {
+			c.validateRetry(joinPath(joinPath("providers", name), "retry"), retry, &errs)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
+
+func (c *Config) validateReady(path string, ready *ReadyCondition, errs *ValidationErrors) {
+	if ready.Interval != "" {
+		if _, err := time.ParseDuration(ready.Interval); err != nil {
+			errs.add(c.Source(joinPath(path, "interval")), joinPath(path, "interval"), "invalid duration %q", ready.Interval)
+		}
+	}
+	if ready.HealthCheck != "" {
+		u, err := url.Parse(ready.HealthCheck)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "tcp") {
+			errs.add(c.Source(joinPath(path, "health_check")), joinPath(path, "health_check"),
+				"health check must be an http(s):// or tcp://host:port URL")
+		}
+	}
+}
+
+func (c *Config) validateRetry(path string, retry *RetryPolicy, errs *ValidationErrors) {
+	if retry.MaxAttempts < 0 {
+		errs.add(c.Source(joinPath(path, "max_attempts")), joinPath(path, "max_attempts"), "max_attempts must not be negative")
+	}
+	if retry.InitialDelay != "" {
+		if _, err := time.ParseDuration(retry.InitialDelay); err != nil {
+			errs.add(c.Source(joinPath(path, "initial_delay")), joinPath(path, "initial_delay"), "invalid duration %q", retry.InitialDelay)
+		}
+	}
+	if retry.MaxDelay != "" {
+		if _, err := time.ParseDuration(retry.MaxDelay); err != nil {
+			errs.add(c.Source(joinPath(path, "max_delay")), joinPath(path, "max_delay"), "invalid duration %q", retry.MaxDelay)
+		}
+	}
+	for _, pattern := range retry.RetryOn {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs.add(c.Source(joinPath(path, "retry_on")), joinPath(path, "retry_on"), "invalid pattern %q: %v", pattern, err)
+		}
+	}
+}
+
+func (c *Config) validateResources(envName string, env Environment, errs *ValidationErrors) {
+	names := make([]string, 0, len(env.Resources))
+	for name := range env.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		res := env.Resources[name]
+		path := joinPath(joinPath(joinPath("environments", envName), "resources"), name)
+		if res.Type == "" {
+			errs.add(c.Source(path), path, "resource type not specified")
+		}
+		if res.Provider != "" {
+			if _, exists := c.Providers[res.Provider]; !exists {
+				errs.add(c.Source(joinPath(path, "provider")), joinPath(path, "provider"),
+					"undefined provider '%s' referenced by resource %s", res.Provider, name)
+			}
+		}
+		for _, dep := range res.DependsOn {
+			if _, exists := env.Resources[dep]; !exists {
+				errs.add(c.Source(joinPath(path, "depends_on")), joinPath(path, "depends_on"),
+					"resource %s depends on undefined resource %s", name, dep)
+			}
+		}
+		if res.Timeout != "" {
+			if _, err := time.ParseDuration(res.Timeout); err != nil {
+				errs.add(c.Source(joinPath(path, "timeout")), joinPath(path, "timeout"), "invalid duration %q", res.Timeout)
+			}
+		}
+		if res.Ready != nil {
+			c.validateReady(joinPath(path, "ready"), res.Ready, errs)
+		}
+		if res.Retry != nil {
+			c.validateRetry(joinPath(path, "retry"), res.Retry, errs)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resolver supplies values for references to data that lives outside the
+// configuration, such as deployed state.
+type Resolver interface {
+	// Output returns the output name recorded for an environment
+	Output(env, name string) (interface{}, error)
+	// ResourceAttribute returns an attribute of a deployed resource
+	ResourceAttribute(env, resource, attr string) (interface{}, error)
+}
+
+// Supported references, resolved by Resolve:
+//
+//	${var.<name>}                 a variable of the environment
+//	${env.<NAME>}                 a process environment variable
+//	${output.<env>.<name>}        an output of a deployed environment
+//	${resource.<name>.<attr>}     an attribute of a deployed resource
+//
+// ${secret.<name>} references are left untouched; they are substituted by
+// the deployer when calling providers so secret values never reach plans
+// or state.
+//
+// A string made of a single reference takes the type of the referenced
+// value; otherwise references are substituted as text. Use $${ to write a
+// literal ${.
+var referencePattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// Resolve returns a copy of the configuration in which the references in
+// the given environment and in the provider it uses are resolved.
+func (c *Config) Resolve(envName string, resolver Resolver) (*Config, error) {
+	env, exists := c.Environments[envName]
+	if !exists {
+		return nil, fmt.Errorf("environment '%s' not found in configuration", envName)
+	}
+
+	envPath := joinPath("environments", envName)
+	in := &interpolator{
+		env:      envName,
+		varsPath: joinPath(envPath, "variables"),
+		vars:     env.Variables,
+		resolved: make(map[string]interface{}),
+		sources:  c.sources,
+		resolver: resolver,
+	}
+
+	resolved := *c
+	resolved.values = deepCopy(c.values).(map[string]interface{})
+	resolved.Environments = make(map[string]Environment, len(c.Environments))
+	for k, v := range c.Environments {
+		resolved.Environments[k] = v
+	}
+	resolved.Providers = make(map[string]Provider, len(c.Providers))
+	for k, v := range c.Providers {
+		resolved.Providers[k] = v
+	}
+
+	envValues, _ := resolved.values["environments"].(map[string]interface{})
+	v, err := in.value(envPath, envValues[envName])
+	if err != nil {
+		return nil, err
+	}
+	envValues[envName] = v
+	var resolvedEnv Environment
+	if err := decodeValue(v, &resolvedEnv); err != nil {
+		return nil, fmt.Errorf("failed to decode environment %s: %w", envName, err)
+	}
+	resolved.Environments[envName] = resolvedEnv
+
+	providerValues, _ := resolved.values["providers"].(map[string]interface{})
+	if pv, ok := providerValues[env.Provider]; ok {
+		v, err := in.value(joinPath("providers", env.Provider), pv)
+		if err != nil {
+			return nil, err
+		}
+		providerValues[env.Provider] = v
+		var resolvedProvider Provider
+		if err := decodeValue(v, &resolvedProvider); err != nil {
+			return nil, fmt.Errorf("failed to decode provider %s: %w", env.Provider, err)
+		}
+		resolved.Providers[env.Provider] = resolvedProvider
+	}
+
+	return &resolved, nil
+}
+
+type interpolator struct {
+	env       string
+	varsPath  string
+	vars      map[string]interface{}
+	resolved  map[string]interface{}
+	resolving []string
+	sources   Sources
+	resolver  Resolver
+}
+
+func (in *interpolator) value(path string, v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		// Walk keys in order so errors are deterministic.
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		m := make(map[string]interface{}, len(t))
+		for _, k := range keys {
+			val := t[k]
+			if path == in.varsPath {
+				// Go through variable so cycles are reported from the start.
+				r, err := in.variable(joinPath(path, k), k)
+				if err != nil {
+					return nil, err
+				}
+				m[k] = r
+				continue
+			}
+			r, err := in.value(joinPath(path, k), val)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = r
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			// Sources are recorded per list, not per element.
+			r, err := in.value(path, val)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = r
+		}
+		return s, nil
+	case string:
+		return in.str(path, t)
+	default:
+		return v, nil
+	}
+}
+
+func (in *interpolator) str(path, s string) (interface{}, error) {
+	matches := referencePattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	// A lone reference keeps the type of what it refers to.
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) && !strings.HasPrefix(s, "$$") {
+		return in.reference(path, s[matches[0][2]:matches[0][3]])
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		last = m[1]
+		if strings.HasPrefix(s[m[0]:], "$$") {
+			b.WriteString(s[m[0]+1 : m[1]])
+			continue
+		}
+		v, err := in.reference(path, s[m[2]:m[3]])
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(fmt.Sprint(v))
+	}
+	b.WriteString(s[last:])
+
+	return b.String(), nil
+}
+
+func (in *interpolator) reference(path, ref string) (interface{}, error) {
+	ref = strings.TrimSpace(ref)
+	parts := strings.SplitN(ref, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, in.errorf(path, "invalid reference ${%s}", ref)
+	}
+
+	switch parts[0] {
+	case "secret":
+		return "${" + ref + "}", nil
+	case "var":
+		return in.variable(path, parts[1])
+	case "env":
+		v, ok := os.LookupEnv(parts[1])
+		if !ok {
+			return nil, in.errorf(path, "environment variable %s is not set", parts[1])
+		}
+		return v, nil
+	case "output":
+		args := strings.SplitN(parts[1], ".", 2)
+		if len(args) != 2 {
+			return nil, in.errorf(path, "invalid reference ${%s}, expected ${output.<env>.<name>}", ref)
+		}
+		if in.resolver == nil {
+			return nil, in.errorf(path, "outputs are not available to resolve ${%s}", ref)
+		}
+		v, err := in.resolver.Output(args[0], args[1])
+		if err != nil {
+			return nil, in.errorf(path, "failed to resolve ${%s}: %v", ref, err)
+		}
+		return v, nil
+	case "resource":
+		args := strings.SplitN(parts[1], ".", 2)
+		if len(args) != 2 {
+			return nil, in.errorf(path, "invalid reference ${%s}, expected ${resource.<name>.<attr>}", ref)
+		}
+		if in.resolver == nil {
+			return nil, in.errorf(path, "resources are not available to resolve ${%s}", ref)
+		}
+		v, err := in.resolver.ResourceAttribute(in.env, args[0], args[1])
+		if err != nil {
+			return nil, in.errorf(path, "failed to resolve ${%s}: %v", ref, err)
+		}
+		return v, nil
+	default:
+		return nil, in.errorf(path, "unknown reference type %q in ${%s}", parts[0], ref)
+	}
+}
+
+func (in *interpolator) variable(path, name string) (interface{}, error) {
+	if v, ok := in.resolved[name]; ok {
+		return v, nil
+	}
+
+	for i, n := range in.resolving {
+		if n == name {
+			cycle := append(append([]string{}, in.resolving[i:]...), name)
+			return nil, in.errorf(path, "variable cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	raw, ok := in.vars[name]
+	if !ok {
+		return nil, in.errorf(path, "undefined variable %q", name)
+	}
+
+	in.resolving = append(in.resolving, name)
+	v, err := in.value(joinPath(in.varsPath, name), raw)
+	in.resolving = in.resolving[:len(in.resolving)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	in.resolved[name] = v
+	return v, nil
+}
+
+func (in *interpolator) errorf(path, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if src, ok := in.sources[path]; ok {
+		return fmt.Errorf("%s:%d:%d: %s: %s", src.File, src.Line, src.Column, path, msg)
+	}
+	return fmt.Errorf("%s: %s", path, msg)
+}
+
+func decodeValue(v interface{}, out interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files relative to a temporary directory and returns the
+// path of gort.yaml in it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.TrimPrefix(content, "\n")), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "gort.yaml")
+}
+
+func mustLoad(t *testing.T, files map[string]string) *Config {
+	t.Helper()
+	cfg, err := LoadConfig(writeFiles(t, files))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// fakeResolver answers outputs and resource attributes from maps keyed by
+// "<env>.<name>" and "<env>.<resource>.<attr>"
+type fakeResolver struct {
+	outputs    map[string]interface{}
+	attributes map[string]interface{}
+}
+
+func (r fakeResolver) Output(env, name string) (interface{}, error) {
+	v, ok := r.outputs[env+"."+name]
+	if !ok {
+		return nil, fmt.Errorf("output %s not found in environment %s", name, env)
+	}
+	return v, nil
+}
+
+func (r fakeResolver) ResourceAttribute(env, resource, attr string) (interface{}, error) {
+	v, ok := r.attributes[env+"."+resource+"."+attr]
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found in environment %s", resource, env)
+	}
+	return v, nil
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv("GORT_TEST_REGION", "eu-west-1")
+	cfg := mustLoad(t, map[string]string{"gort.yaml": `
+version: "1"
+providers:
+  cloud:
+    type: mock
+    properties:
+      region: ${env.GORT_TEST_REGION}
+environments:
+  dev:
+    provider: cloud
+    variables:
+      name: web
+      port: 8080
+      url: http://${var.name}:${var.port}
+    resources:
+      app:
+        type: instance
+        properties:
+          port: ${var.port}
+          url: ${var.url}
+          api: ${output.shared.api_url}
+          subnet: ${resource.network.subnet_id}
+          password: ${secret.db_password}
+          literal: $${var.name}
+          mixed: $${var.name} is ${var.name}
+`})
+	resolver := fakeResolver{
+		outputs:    map[string]interface{}{"shared.api_url": "https://api.example.com"},
+		attributes: map[string]interface{}{"dev.network.subnet_id": "subnet-1"},
+	}
+
+	resolved, err := cfg.Resolve("dev", resolver)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	want := map[string]interface{}{
+		// A lone reference keeps the type of the value
+		"port":     8080,
+		"url":      "http://web:8080",
+		"api":      "https://api.example.com",
+		"subnet":   "subnet-1",
+		"password": "${secret.db_password}",
+		"literal":  "${var.name}",
+		"mixed":    "${var.name} is web",
+	}
+	if got := resolved.Environments["dev"].Resources["app"].Properties; !reflect.DeepEqual(got, want) {
+		t.Errorf("properties = %#v, want %#v", got, want)
+	}
+	if got := resolved.Providers["cloud"].Properties["region"]; got != "eu-west-1" {
+		t.Errorf("provider region = %v, want eu-west-1", got)
+	}
+	// The loaded configuration is left unresolved
+	if got := cfg.Environments["dev"].Resources["app"].Properties["port"]; got != "${var.port}" {
+		t.Errorf("original port = %v, want it unresolved", got)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables string
+		property  string
+		wantErr   string
+	}{
+		{
+			name:      "cycle",
+			variables: "a: ${var.b}\n      b: x-${var.c}\n      c: ${var.a}",
+			property:  "${var.a}",
+			wantErr:   "gort.yaml:10:10: environments.dev.variables.c: variable cycle: a -> b -> c -> a",
+		},
+		{
+			name:     "undefined variable",
+			property: "${var.missing}",
+			wantErr:  `gort.yaml:12:29: environments.dev.resources.app.properties.value: undefined variable "missing"`,
+		},
+		{
+			name:     "unset environment variable",
+			property: "prefix-${env.GORT_TEST_UNSET}",
+			wantErr:  "gort.yaml:12:29: environments.dev.resources.app.properties.value: environment variable GORT_TEST_UNSET is not set",
+		},
+		{
+			name:     "unknown reference",
+			property: "${local.x}",
+			wantErr:  `unknown reference type "local" in ${local.x}`,
+		},
+		{
+			name:     "invalid reference",
+			property: "${var}",
+			wantErr:  "invalid reference ${var}",
+		},
+		{
+			name:     "invalid output reference",
+			property: "${output.shared}",
+			wantErr:  "invalid reference ${output.shared}, expected ${output.<env>.<name>}",
+		},
+		{
+			name:     "missing output",
+			property: "${output.shared.url}",
+			wantErr:  "failed to resolve ${output.shared.url}: output url not found in environment shared",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variables := tt.variables
+			if variables == "" {
+				variables = "unused: true"
+			}
+			cfg := mustLoad(t, map[string]string{"gort.yaml": `
+version: "1"
+providers:
+  cloud: {type: mock}
+environments:
+  dev:
+    provider: cloud
+    variables:
+      ` + variables + `
+    resources:
+      app:
+        type: instance
+        properties: {value: "` + tt.property + `"}
+`})
+			_, err := cfg.Resolve("dev", fakeResolver{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Resolve error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveWithoutResolver(t *testing.T) {
+	cfg := mustLoad(t, map[string]string{"gort.yaml": `
+version: "1"
+providers:
+  cloud: {type: mock}
+environments:
+  dev:
+    provider: cloud
+    resources:
+      app:
+        type: instance
+        properties: {subnet: "${resource.network.subnet_id}"}
+`})
+	_, err := cfg.Resolve("dev", nil)
+	if err == nil || !strings.Contains(err.Error(), "resources are not available to resolve ${resource.network.subnet_id}") {
+		t.Errorf("Resolve error = %v, want resources to be unavailable", err)
+	}
+}
+
+func TestSetVariable(t *testing.T) {
+	cfg := mustLoad(t, map[string]string{"gort.yaml": `
+version: "1"
+providers:
+  cloud: {type: mock}
+environments:
+  dev:
+    provider: cloud
+    variables: {version: dev}
+    resources:
+      app:
+        type: instance
+        properties: {image: "app:${var.version}"}
+`})
+	if err := cfg.SetVariable("dev", "version", "1.4.3"); err != nil {
+		t.Fatalf("SetVariable: %v", err)
+	}
+	resolved, err := cfg.Resolve("dev", nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := resolved.Environments["dev"].Resources["app"].Properties["image"]; got != "app:1.4.3" {
+		t.Errorf("image = %v, want app:1.4.3", got)
+	}
+	if err := cfg.SetVariable("prod", "version", "1.4.3"); err == nil {
+		t.Error("SetVariable accepted an undefined environment")
+	}
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvironmentsDir is the directory, relative to the root config file, that
+// holds per-environment files named <environment>.yaml.
+const EnvironmentsDir = "environments"
+
+// The effective configuration is assembled from several files:
+//
+//  1. files matched by the include globs of a file, in glob order, followed
+//     by the including file itself (includes may nest);
+//  2. environments/<name>.yaml next to the root file, which is merged into
+//     environments.<name>.
+//
+// Later files override earlier ones. Mappings are deep-merged key by key,
+// while scalars and lists are replaced as a whole.
+//
+// Every environment is then layered as defaults -> providers.<p>.defaults ->
+// environments.<name>, using the same merge rules, so an environment only
+// needs to spell out what differs from its provider and from the global
+// defaults.
+
+// loadFiles reads path and everything it includes into a single layer.
+// Schema violations are collected in errs so they can all be reported.
+func loadFiles(path string, visited map[string]bool, errs *ValidationErrors) (*layer, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if visited[abs] {
+		return newLayer(), nil
+	}
+	visited[abs] = true
+
+	own, err := readLayer(path, configSchema, "", errs)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := newLayer()
+	includes, err := includePatterns(own)
+	if err != nil {
+		return nil, err
+	}
+	if includes != nil {
+		own.values["include"] = toList(includes)
+	}
+	for _, pattern := range includes {
+		matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include pattern %q: %w", path, pattern, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			included, err := loadFiles(match, visited, errs)
+			if err != nil {
+				return nil, err
+			}
+			merged.merge(included)
+		}
+	}
+
+	merged.merge(own)
+	return merged, nil
+}
+
+// readLayer reads a single file, checking it strictly against root, which
+// describes the value found at the dotted path at.
+func readLayer(path string, root *schema, at string, errs *ValidationErrors) (*layer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	root.check(path, at, &node, errs)
+	return decodeLayer(path, &node)
+}
+
+func toList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
+
+func includePatterns(l *layer) ([]string, error) {
+	raw, ok := l.values["include"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	switch v := raw.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		patterns := make([]string, 0, len(v))
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: include entries must be strings", l.sources["include"])
+			}
+			patterns = append(patterns, s)
+		}
+		return patterns, nil
+	default:
+		return nil, fmt.Errorf("%s: include must be a string or a list of strings", l.sources["include"])
+	}
+}
+
+// loadEnvironmentFiles merges environments/<name>.yaml into the layer.
+func loadEnvironmentFiles(root string, l *layer, errs *ValidationErrors) error {
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(root), EnvironmentsDir, "*.yaml"))
+	if err != nil {
+		return fmt.Errorf("failed to scan environment directory: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+		env, err := readLayer(file, environmentSchema, joinPath("environments", name), errs)
+		if err != nil {
+			return err
+		}
+		l.merge(env.under(joinPath("environments", name)))
+	}
+
+	return nil
+}
+
+// applyLayers resolves defaults -> provider defaults -> environment for
+// every environment in the layer.
+func applyLayers(l *layer) {
+	envs, _ := l.values["environments"].(map[string]interface{})
+	for name := range envs {
+		path := joinPath("environments", name)
+
+		// The provider itself may come from the defaults.
+		base := l.sub("defaults")
+		base.merge(l.sub(path))
+		provider, _ := base.values["provider"].(string)
+
+		effective := l.sub("defaults")
+		if provider != "" {
+			effective.merge(l.sub(joinPath(joinPath("providers", provider), "defaults")))
+		}
+		effective.merge(l.sub(path))
+
+		envs[name] = effective.values
+		l.sources.remove(path)
+		for k, v := range effective.sources {
+			l.sources[joinPath(path, k)] = v
+		}
+	}
+}
+
+// sub returns a copy of the mapping at path with sources relative to it.
+func (l *layer) sub(path string) *layer {
+	s := newLayer()
+	var cur interface{} = l.values
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return s
+		}
+		cur = m[key]
+	}
+	m, ok := cur.(map[string]interface{})
+	if !ok {
+		return s
+	}
+
+	s.values = deepCopy(m).(map[string]interface{})
+	prefix := path + "."
+	for k, v := range l.sources {
+		if strings.HasPrefix(k, prefix) {
+			s.sources[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return s
+}
+
+// under returns the layer nested below path.
+func (l *layer) under(path string) *layer {
+	n := newLayer()
+	keys := strings.Split(path, ".")
+	cur := n.values
+	for _, key := range keys[:len(keys)-1] {
+		next := make(map[string]interface{})
+		cur[key] = next
+		cur = next
+	}
+	cur[keys[len(keys)-1]] = l.values
+	for k, v := range l.sources {
+		n.sources[joinPath(path, k)] = v
+	}
+	return n
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigMergesIncludes(t *testing.T) {
+	cfg := mustLoad(t, map[string]string{
+		"gort.yaml": `
+version: "1"
+include: ["conf.d/*.yaml"]
+environments:
+  dev:
+    region: us-east-1
+`,
+		// Included files are merged in glob order, then the including file
+		"conf.d/a.yaml": `
+providers:
+  cloud: {type: mock, properties: {zone: a}}
+environments:
+  dev:
+    provider: cloud
+    region: eu-west-1
+    tags: {team: a, cost: shared}
+`,
+		"conf.d/b.yaml": `
+providers:
+  cloud: {properties: {zone: b}}
+environments:
+  dev:
+    tags: {team: b}
+`,
+	})
+
+	dir := filepath.Dir(cfg.Path())
+	env := cfg.Environments["dev"]
+	if env.Provider != "cloud" || env.Region != "us-east-1" {
+		t.Errorf("dev = %+v, want provider cloud in us-east-1", env)
+	}
+	if want := map[string]string{"team": "b", "cost": "shared"}; !reflect.DeepEqual(env.Tags, want) {
+		t.Errorf("tags = %v, want %v", env.Tags, want)
+	}
+	if p := cfg.Providers["cloud"]; p.Type != "mock" || p.Properties["zone"] != "b" {
+		t.Errorf("provider = %+v, want type mock from a.yaml and zone b from b.yaml", p)
+	}
+
+	sources := map[string]Source{
+		"environments.dev.region":    {File: filepath.Join(dir, "gort.yaml"), Line: 5, Column: 13},
+		"environments.dev.provider":  {File: filepath.Join(dir, "conf.d", "a.yaml"), Line: 5, Column: 15},
+		"environments.dev.tags.team": {File: filepath.Join(dir, "conf.d", "b.yaml"), Line: 5, Column: 18},
+		"environments.dev.tags.cost": {File: filepath.Join(dir, "conf.d", "a.yaml"), Line: 7, Column: 27},
+	}
+	for path, want := range sources {
+		if got := cfg.Source(path); got != want {
+			t.Errorf("Source(%s) = %+v, want %+v", path, got, want)
+		}
+	}
+}
+
+func TestLoadConfigEnvironmentFiles(t *testing.T) {
+	cfg := mustLoad(t, map[string]string{
+		"gort.yaml": `
+version: "1"
+providers:
+  cloud: {type: mock}
+environments:
+  prod:
+    provider: cloud
+    region: us-east-1
+    variables: {replicas: 2, size: small}
+`,
+		// environments/<name>.yaml takes precedence over gort.yaml, and
+		// may define environments of its own
+		"environments/prod.yaml": `
+region: eu-west-1
+variables: {replicas: 5}
+`,
+		"environments/preview.yaml": `
+provider: cloud
+`,
+	})
+
+	prod := cfg.Environments["prod"]
+	if prod.Region != "eu-west-1" {
+		t.Errorf("prod region = %s, want the environment file's", prod.Region)
+	}
+	if want := map[string]interface{}{"replicas": 5, "size": "small"}; !reflect.DeepEqual(prod.Variables, want) {
+		t.Errorf("prod variables = %v, want %v", prod.Variables, want)
+	}
+	if preview, ok := cfg.Environments["preview"]; !ok || preview.Provider != "cloud" {
+		t.Errorf("preview = %+v, %v, want it defined by its file", preview, ok)
+	}
+	want := Source{File: filepath.Join(filepath.Dir(cfg.Path()), "environments", "prod.yaml"), Line: 1, Column: 9}
+	if got := cfg.Source("environments.prod.region"); got != want {
+		t.Errorf("Source(region) = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadConfigLayersDefaults(t *testing.T) {
+	cfg := mustLoad(t, map[string]string{"gort.yaml": `
+version: "1"
+defaults:
+  region: us-east-1
+  tags: {team: platform, cost: shared}
+  variables: {zones: [a, b], size: small}
+providers:
+  cloud:
+    type: mock
+    defaults:
+      region: eu-west-1
+      tags: {team: web}
+  other: {type: mock}
+environments:
+  dev:
+    provider: cloud
+    tags: {owner: alice}
+    variables: {zones: [c]}
+  ci:
+    provider: other
+`})
+
+	// Mappings are merged key by key, scalars and lists are replaced
+	dev := cfg.Environments["dev"]
+	if dev.Region != "eu-west-1" {
+		t.Errorf("dev region = %s, want the provider default", dev.Region)
+	}
+	if want := map[string]string{"team": "web", "cost": "shared", "owner": "alice"}; !reflect.DeepEqual(dev.Tags, want) {
+		t.Errorf("dev tags = %v, want %v", dev.Tags, want)
+	}
+	if want := map[string]interface{}{"zones": []interface{}{"c"}, "size": "small"}; !reflect.DeepEqual(dev.Variables, want) {
+		t.Errorf("dev variables = %v, want %v", dev.Variables, want)
+	}
+
+	// Provider defaults only apply to environments using the provider
+	ci := cfg.Environments["ci"]
+	if ci.Region != "us-east-1" || ci.Tags["team"] != "platform" {
+		t.Errorf("ci = %+v, want the global defaults", ci)
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source records the file and position a configuration value was read from
+type Source struct {
+	File   string `json:"file" yaml:"file"`
+	Line   int    `json:"line" yaml:"line"`
+	Column int    `json:"column" yaml:"column"`
+}
+
+func (s Source) String() string {
+	if s.File == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// Sources maps dotted configuration paths (e.g. "environments.prod.region")
+// to the place the effective value was defined.
+type Sources map[string]Source
+
+// layer is a decoded YAML document together with the source of every leaf.
+type layer struct {
+	values  map[string]interface{}
+	sources Sources
+}
+
+func newLayer() *layer {
+	return &layer{
+		values:  make(map[string]interface{}),
+		sources: make(Sources),
+	}
+}
+
+// decodeLayer converts a YAML document into a generic tree, remembering the
+// position of every scalar and sequence so that merged values can be traced
+// back to the file that defined them.
+func decodeLayer(file string, node *yaml.Node) (*layer, error) {
+	l := newLayer()
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return l, nil
+		}
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: top level must be a mapping", file, node.Line)
+	}
+
+	values, err := decodeNode(file, "", node, l.sources)
+	if err != nil {
+		return nil, err
+	}
+	l.values = values.(map[string]interface{})
+	return l, nil
+}
+
+func decodeNode(file, path string, node *yaml.Node, sources Sources) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return decodeNode(file, path, node.Alias, sources)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				return nil, fmt.Errorf("%s:%d: merge keys are not supported, use include or defaults", file, key.Line)
+			}
+			v, err := decodeNode(file, joinPath(path, key.Value), val, sources)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		if path != "" && len(m) == 0 {
+			sources[path] = Source{File: file, Line: node.Line, Column: node.Column}
+		}
+		return m, nil
+	default:
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, node.Line, err)
+		}
+		sources[path] = Source{File: file, Line: node.Line, Column: node.Column}
+		return v, nil
+	}
+}
+
+// merge overlays src onto dst. Mappings are merged key by key; scalars and
+// sequences in src replace whatever dst held at the same path.
+func (dst *layer) merge(src *layer) {
+	mergeValues(dst.values, src.values, "", dst.sources, src.sources)
+}
+
+func mergeValues(dst, src map[string]interface{}, path string, dstSources, srcSources Sources) {
+	for key, sv := range src {
+		p := joinPath(path, key)
+		sm, srcIsMap := sv.(map[string]interface{})
+		dm, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dm, sm, p, dstSources, srcSources)
+			continue
+		}
+
+		dstSources.remove(p)
+		dst[key] = deepCopy(sv)
+		srcSources.copyTo(dstSources, p, p)
+	}
+}
+
+// remove deletes the source of path and of everything nested below it.
+func (s Sources) remove(path string) {
+	prefix := path + "."
+	for k := range s {
+		if k == path || strings.HasPrefix(k, prefix) {
+			delete(s, k)
+		}
+	}
+}
+
+// copyTo copies the sources under from into dst, rebased under to.
+func (s Sources) copyTo(dst Sources, from, to string) {
+	prefix := from + "."
+	for k, v := range s {
+		switch {
+		case k == from:
+			dst[to] = v
+		case strings.HasPrefix(k, prefix):
+			dst[to+"."+strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = deepCopy(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = deepCopy(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Value is a single effective configuration value and where it came from
+type Value struct {
+	Path   string      `json:"path" yaml:"path"`
+	Value  interface{} `json:"value" yaml:"value"`
+	Source Source      `json:"source" yaml:"source"`
+}
+
+// flatten walks a tree and returns its leaves sorted by path.
+func flatten(path string, v interface{}, sources Sources) []Value {
+	var values []Value
+	if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, flatten(joinPath(path, k), m[k], sources)...)
+		}
+		return values
+	}
+	return append(values, Value{Path: path, Value: v, Source: sources[path]})
+}
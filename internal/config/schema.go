@@ -0,0 +1,333 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a single problem found in the configuration
+type ValidationError struct {
+	Source  Source `json:"source" yaml:"source"`
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	if e.Source.File != "" {
+		fmt.Fprintf(&b, "%s:%d:%d: ", e.Source.File, e.Source.Line, e.Source.Column)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, "%s: ", e.Path)
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// ValidationErrors collects every problem found so they can be reported
+// at once
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *ValidationErrors) add(src Source, path, format string, args ...interface{}) {
+	*e = append(*e, ValidationError{Source: src, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// sort orders errors by file and position
+func (e ValidationErrors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		a, b := e[i].Source, e[j].Source
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+type schemaKind int
+
+const (
+	kindAny schemaKind = iota
+	kindObject
+	kindMap
+	kindList
+	kindString
+	kindInteger
+	kindNumber
+	kindBoolean
+)
+
+// schema describes the expected shape of a YAML value. It is derived from
+// the Go types so strict decoding and the exported JSON Schema stay in sync
+// with what LoadConfig actually reads.
+type schema struct {
+	kind   schemaKind
+	fields map[string]*schema
+	elem   *schema
+}
+
+// environmentShaped lists map fields that hold environment settings layered
+// under every environment, and are therefore checked like an Environment.
+var environmentShaped = map[reflect.Type]map[string]bool{
+	reflect.TypeOf(Config{}):   {"Defaults": true},
+	reflect.TypeOf(Provider{}): {"Defaults": true},
+}
+
+var (
+	configSchema      = schemaFor(reflect.TypeOf(Config{}))
+	environmentSchema = schemaFor(reflect.TypeOf(Environment{}))
+)
+
+func schemaFor(t reflect.Type) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &schema{kind: kindObject, fields: make(map[string]*schema)}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			if environmentShaped[t][f.Name] {
+				s.fields[name] = schemaFor(reflect.TypeOf(Environment{}))
+				continue
+			}
+			s.fields[name] = schemaFor(f.Type)
+		}
+		return s
+	case reflect.Map:
+		return &schema{kind: kindMap, elem: schemaFor(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return &schema{kind: kindList, elem: schemaFor(t.Elem())}
+	case reflect.String:
+		return &schema{kind: kindString}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{kind: kindInteger}
+	case reflect.Float32, reflect.Float64:
+		return &schema{kind: kindNumber}
+	case reflect.Bool:
+		return &schema{kind: kindBoolean}
+	default:
+		return &schema{kind: kindAny}
+	}
+}
+
+// check validates a YAML node against the schema, reporting unknown fields
+// and type mismatches with their position.
+func (s *schema) check(file, path string, node *yaml.Node, errs *ValidationErrors) {
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return
+		}
+		node = node.Content[0]
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	src := Source{File: file, Line: node.Line, Column: node.Column}
+
+	// null is allowed anywhere and leaves the zero value
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch s.kind {
+	case kindAny:
+		return
+	case kindObject:
+		if node.Kind != yaml.MappingNode {
+			errs.add(src, path, "expected a mapping, got %s", describe(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			field, ok := s.fields[key.Value]
+			if !ok {
+				errs.add(Source{File: file, Line: key.Line, Column: key.Column}, path,
+					"unknown field %q%s", key.Value, suggest(key.Value, s.fields))
+				continue
+			}
+			field.check(file, joinPath(path, key.Value), val, errs)
+		}
+	case kindMap:
+		if node.Kind != yaml.MappingNode {
+			errs.add(src, path, "expected a mapping, got %s", describe(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			s.elem.check(file, joinPath(path, node.Content[i].Value), node.Content[i+1], errs)
+		}
+	case kindList:
+		// A single string is accepted where a list of strings is expected
+		if node.Kind == yaml.ScalarNode && s.elem.kind == kindString {
+			return
+		}
+		if node.Kind != yaml.SequenceNode {
+			errs.add(src, path, "expected a list, got %s", describe(node))
+			return
+		}
+		for _, item := range node.Content {
+			s.elem.check(file, path, item, errs)
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			errs.add(src, path, "expected %s, got %s", s.kindName(), describe(node))
+			return
+		}
+		var ok bool
+		switch s.kind {
+		case kindString:
+			ok = true
+		case kindInteger:
+			ok = node.Tag == "!!int"
+		case kindNumber:
+			ok = node.Tag == "!!int" || node.Tag == "!!float"
+		case kindBoolean:
+			ok = node.Tag == "!!bool"
+		}
+		if !ok {
+			errs.add(src, path, "expected %s, got %q", s.kindName(), node.Value)
+		}
+	}
+}
+
+func (s *schema) kindName() string {
+	switch s.kind {
+	case kindObject, kindMap:
+		return "a mapping"
+	case kindList:
+		return "a list"
+	case kindString:
+		return "a string"
+	case kindInteger:
+		return "an integer"
+	case kindNumber:
+		return "a number"
+	case kindBoolean:
+		return "a boolean"
+	default:
+		return "a value"
+	}
+}
+
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
+
+// suggest returns a hint for a mistyped field name
+func suggest(name string, fields map[string]*schema) string {
+	best, bestDist := "", 3
+	for f := range fields {
+		if d := distance(name, f); d < bestDist || (d == bestDist && f < best) {
+			best, bestDist = f, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// distance is the Levenshtein distance between a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing gort.yaml,
+// for editor integration
+func JSONSchema() map[string]interface{} {
+	s := configSchema.jsonSchema()
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = "https://github.com/yahao333/gort/gort.schema.json"
+	s["title"] = "gort.yaml"
+	return s
+}
+
+func (s *schema) jsonSchema() map[string]interface{} {
+	switch s.kind {
+	case kindObject:
+		props := make(map[string]interface{}, len(s.fields))
+		for name, f := range s.fields {
+			props[name] = f.jsonSchema()
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+	case kindMap:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": s.elem.jsonSchema(),
+		}
+	case kindList:
+		list := map[string]interface{}{
+			"type":  "array",
+			"items": s.elem.jsonSchema(),
+		}
+		if s.elem.kind == kindString {
+			return map[string]interface{}{
+				"anyOf": []interface{}{map[string]interface{}{"type": "string"}, list},
+			}
+		}
+		return list
+	case kindString:
+		return map[string]interface{}{"type": "string"}
+	case kindInteger:
+		return map[string]interface{}{"type": "integer"}
+	case kindNumber:
+		return map[string]interface{}{"type": "number"}
+	case kindBoolean:
+		return map[string]interface{}{"type": "boolean"}
+	default:
+		return map[string]interface{}{}
+	}
+}
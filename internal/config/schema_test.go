@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigReportsEveryError(t *testing.T) {
+	path := writeFiles(t, map[string]string{
+		"gort.yaml": `
+version: "1"
+providers:
+  cloud:
+    type: mock
+    retry: {max_attempts: -1}
+environments:
+  dev:
+    provider: cloud
+    regoin: us-east-1
+    resources:
+      app:
+        type: instance
+        depends_on: [db]
+        timeout: soon
+  prod:
+    provider: missing
+`,
+		"environments/staging.yaml": `
+provider: cloud
+tag: {team: web}
+`,
+	})
+	dir := filepath.Dir(path)
+
+	_, err := LoadConfig(path)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("LoadConfig error = %v, want ValidationErrors", err)
+	}
+
+	// Schema and reference errors are reported together, by file and position
+	root, staging := filepath.Join(dir, "gort.yaml"), filepath.Join(dir, "environments", "staging.yaml")
+	want := []string{
+		staging + `:2:1: environments.staging: unknown field "tag", did you mean "tags"?`,
+		root + `:5:27: providers.cloud.retry.max_attempts: max_attempts must not be negative`,
+		root + `:9:5: environments.dev: unknown field "regoin", did you mean "region"?`,
+		root + `:13:21: environments.dev.resources.app.depends_on: resource app depends on undefined resource db`,
+		root + `:14:18: environments.dev.resources.app.timeout: invalid duration "soon"`,
+		root + `:16:15: environments.prod.provider: undefined provider 'missing' referenced in environment prod`,
+	}
+	got := make([]string, len(errs))
+	for i, e := range errs {
+		got[i] = e.Error()
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadConfigReportsTypeMismatches(t *testing.T) {
+	path := writeFiles(t, map[string]string{"gort.yaml": `
+version: "1"
+providers:
+  cloud: {type: mock}
+environments:
+  dev:
+    provider: cloud
+    require_approval: two
+    resources: [app]
+`})
+
+	_, err := LoadConfig(path)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("LoadConfig error = %v, want two validation errors", err)
+	}
+	for i, want := range []string{
+		`gort.yaml:7:23: environments.dev.require_approval: expected an integer, got "two"`,
+		`gort.yaml:8:16: environments.dev.resources: expected a mapping, got a list`,
+	} {
+		if !strings.HasSuffix(errs[i].Error(), want) {
+			t.Errorf("error %d = %v, want %q", i, errs[i], want)
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnknownTopLevelFields(t *testing.T) {
+	path := writeFiles(t, map[string]string{"gort.yaml": `
+version: "1"
+provider:
+  cloud: {type: mock}
+environments:
+  dev: {provider: cloud}
+`})
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `gort.yaml:2:1: unknown field "provider", did you mean "providers"?`) {
+		t.Errorf("LoadConfig error = %v, want the unknown field with its position", err)
+	}
+}
@@ -1,35 +1,525 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/yahao333/gort/internal/logging"
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/state"
 )
 
+// DeployerOptions controls how a plan is applied
+type DeployerOptions struct {
+	// Parallel is the number of resources applied concurrently
+	Parallel int
+	Force    bool
+	// Version is recorded in plans and state
+	Version string
+	// Secrets are substituted for ${secret.<name>} in resource properties
+	// when calling providers; they are never written to plans or state.
+	Secrets map[string]string
+	// PromotedFrom is recorded in the deployment history when a version is
+	// promoted from another environment
+	PromotedFrom string
+	// Progress is called as resources are applied, see ProgressEvent
+	Progress func(ProgressEvent)
+	// RunID correlates the deployment with the logs of the run
+	RunID string
+}
+
 type Deployer struct {
-	logger *logrus.Logger
+	stateManager  *state.StateManager
+	pluginManager *plugin.PluginManager
+	logger        logging.Log
+	options       DeployerOptions
+
+	// version is the version of the plan being deployed
+	version string
+
+	mu      sync.Mutex
+	applied []appliedChange
+	// retries counts the retried provider calls per resource
+	retries map[string]int
+	// waits sums the time spent waiting for provider limits
+	waits map[string]time.Duration
 }
 
-func NewDeployer() *Deployer {
-	logger := logrus.New()
-	logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
+// DeploymentResult summarizes an applied plan
+type DeploymentResult struct {
+	Environment       string                 `json:"environment" yaml:"environment"`
+	Version           string                 `json:"version,omitempty" yaml:"version,omitempty"`
+	RunID             string                 `json:"run_id,omitempty" yaml:"run_id,omitempty"`
+	StartTime         time.Time              `json:"start_time" yaml:"start_time"`
+	Duration          time.Duration          `json:"duration" yaml:"duration"`
+	CreatedResources  []string               `json:"created_resources" yaml:"created_resources"`
+	UpdatedResources  []string               `json:"updated_resources" yaml:"updated_resources"`
+	DeletedResources  []string               `json:"deleted_resources" yaml:"deleted_resources"`
+	ReplacedResources []string               `json:"replaced_resources,omitempty" yaml:"replaced_resources,omitempty"`
+	Outputs           map[string]interface{} `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// Retries counts the retried provider calls per resource
+	Retries map[string]int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	// LimitWait is the time spent waiting for the rate limit and
+	// concurrency cap of each provider
+	LimitWait map[string]time.Duration `json:"limit_wait,omitempty" yaml:"limit_wait,omitempty"`
+}
+
+// appliedChange remembers what was changed so it can be rolled back
+type appliedChange struct {
+	change string
+	name   string
+	before *ResourceRecord
+}
+
+func NewDeployer(stateManager *state.StateManager, pluginManager *plugin.PluginManager, logger logging.Log, options DeployerOptions) *Deployer {
+	if options.Parallel < 1 {
+		options.Parallel = 1
+	}
 
 	return &Deployer{
-		logger: logger,
+		stateManager:  stateManager,
+		pluginManager: pluginManager,
+		logger:        logger,
+		options:       options,
+	}
+}
+
+// Deploy applies a plan: deletions first, then creations and updates in
+// dependency order. State is saved after every resource so an interrupted
+// deployment can be resumed by planning again. The outcome is recorded in
+// the deployment history of the environment.
+func (d *Deployer) Deploy(ctx context.Context, plan *DeploymentPlan) (*DeploymentResult, error) {
+	d.logger.Infof("Starting deployment to environment: %s", plan.Environment)
+	if plan.Environment == "" {
+		return nil, fmt.Errorf("environment name cannot be empty")
+	}
+
+	start := time.Now()
+	result, err := d.deploy(ctx, plan)
+
+	entry := state.Deployment{
+		Environment:  plan.Environment,
+		Version:      plan.Version,
+		Status:       state.DeploymentSucceeded,
+		StartTime:    start,
+		Duration:     time.Since(start),
+		PromotedFrom: d.options.PromotedFrom,
+		RunID:        d.options.RunID,
 	}
+	if result != nil {
+		entry.Created = len(result.CreatedResources) + len(result.ReplacedResources)
+		entry.Updated = len(result.UpdatedResources)
+		entry.Deleted = len(result.DeletedResources) + len(result.ReplacedResources)
+	}
+	if err != nil {
+		entry.Status = state.DeploymentFailed
+		entry.Error = err.Error()
+	}
+	if herr := d.stateManager.RecordDeployment(entry); herr != nil {
+		d.logger.Errorf("Failed to record deployment history: %v", herr)
+	}
+
+	return result, err
 }
 
-func (d *Deployer) Deploy(env string) error {
-	d.logger.Infof("Starting deployment to environment: %s", env)
+func (d *Deployer) deploy(ctx context.Context, plan *DeploymentPlan) (*DeploymentResult, error) {
+	if err := d.stateManager.Lock(plan.Environment); err != nil {
+		return nil, fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer d.stateManager.Unlock(plan.Environment)
+
+	st, err := d.stateManager.LoadState(plan.Environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	if st.Resources == nil {
+		st.Resources = make(map[string]interface{})
+	}
 
-	// Validate environment
-	if env == "" {
-		return fmt.Errorf("environment name cannot be empty")
+	if plan.StateDigest != "" {
+		digest, err := stateDigest(st)
+		if err != nil {
+			return nil, err
+		}
+		if digest != plan.StateDigest {
+			return nil, fmt.Errorf("plan is stale: the state of %s changed since it was planned", plan.Environment)
+		}
 	}
 
-	// TODO: Implement actual deployment logic
-	d.logger.Info("Deployment completed successfully")
+	d.version = plan.Version
+	d.mu.Lock()
+	d.applied = nil
+	d.retries = nil
+	d.waits = nil
+	d.mu.Unlock()
+
+	result := &DeploymentResult{
+		Environment: plan.Environment,
+		Version:     plan.Version,
+		RunID:       d.options.RunID,
+		StartTime:   time.Now(),
+	}
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		result.Retries = d.retries
+		result.LimitWait = d.waits
+		for name, waited := range d.waits {
+			d.logger.Infof("Waited %s in total for the limits of provider %s", waited.Round(time.Millisecond), name)
+		}
+	}()
+	run := &deployRun{deployer: d, state: st, result: result}
+
+	for _, spec := range plan.DeleteResources {
+		if err := run.delete(ctx, spec); err != nil {
+			return result, err
+		}
+	}
+
+	pending := make(map[string]ResourceSpec)
+	changes := make(map[string]string)
+	for _, spec := range plan.AddResources {
+		pending[spec.Name] = spec
+		changes[spec.Name] = ChangeAdd
+	}
+	for _, spec := range plan.UpdateResources {
+		pending[spec.Name] = spec
+		changes[spec.Name] = ChangeUpdate
+	}
+	for _, spec := range plan.ReplaceResources {
+		pending[spec.Name] = spec
+		changes[spec.Name] = ChangeReplace
+	}
+
+	for _, wave := range levels(pending) {
+		if err := run.apply(ctx, wave, changes); err != nil {
+			return result, err
+		}
+	}
+
+	if plan.Version != "" {
+		st.Version = plan.Version
+	}
+	if err := d.stateManager.SaveState(plan.Environment, st); err != nil {
+		return result, fmt.Errorf("failed to save state: %w", err)
+	}
+
+	result.Duration = time.Since(result.StartTime)
+	result.Outputs = st.Outputs
+	d.logger.Infof("Deployment completed successfully")
+	return result, nil
+}
+
+// Rollback reverts the changes applied by the last call to Deploy, most
+// recent first
+func (d *Deployer) Rollback(ctx context.Context, plan *DeploymentPlan) error {
+	d.mu.Lock()
+	applied := d.applied
+	d.applied = nil
+	d.mu.Unlock()
+
+	if err := d.stateManager.Lock(plan.Environment); err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer d.stateManager.Unlock(plan.Environment)
+
+	st, err := d.stateManager.LoadState(plan.Environment)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if st.Resources == nil {
+		st.Resources = make(map[string]interface{})
+	}
+
+	var errs []string
+	for i := len(applied) - 1; i >= 0; i-- {
+		a := applied[i]
+		d.logger.WithField("resource", a.name).Infof("Rolling back %s of resource %s", a.change, a.name)
+		if err := d.revert(ctx, st, a); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", a.name, err))
+		}
+	}
+
+	if err := d.stateManager.SaveState(plan.Environment, st); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to roll back %d resource(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (d *Deployer) revert(ctx context.Context, st *state.State, a appliedChange) error {
+	switch a.change {
+	case ChangeAdd:
+		rec, err := currentRecord(st, a.name)
+		if err != nil {
+			return err
+		}
+		if err := d.remove(ctx, rec.Provider, rec.ID, rec.spec(a.name)); err != nil {
+			return err
+		}
+		delete(st.Resources, a.name)
+	case ChangeUpdate:
+		res, err := d.update(ctx, a.before.ID, a.before.spec(a.name))
+		if err != nil {
+			return err
+		}
+		st.Resources[a.name] = record(a.before.spec(a.name), res)
+	case ChangeReplace:
+		rec, err := currentRecord(st, a.name)
+		if err != nil {
+			return err
+		}
+		if err := d.remove(ctx, rec.Provider, rec.ID, rec.spec(a.name)); err != nil {
+			return err
+		}
+		delete(st.Resources, a.name)
+		fallthrough
+	case ChangeDelete:
+		res, err := d.create(ctx, a.before.spec(a.name))
+		if err != nil {
+			return err
+		}
+		st.Resources[a.name] = record(a.before.spec(a.name), res)
+	}
 	return nil
 }
+
+func (d *Deployer) record(a appliedChange) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.applied = append(d.applied, a)
+}
+
+// provider loads the provider plugin with the given name
+func (d *Deployer) provider(ctx context.Context, name string) (plugin.ProviderPlugin, error) {
+	if err := d.pluginManager.LoadPlugin(ctx, name); err != nil {
+		return nil, fmt.Errorf("failed to load provider %s: %w", name, err)
+	}
+
+	return d.pluginManager.GetProvider(name)
+}
+
+// pluginSpec converts a spec for a provider call, substituting secrets and
+// adding the version being deployed
+func (d *Deployer) pluginSpec(spec ResourceSpec) plugin.ResourceSpec {
+	return plugin.ResourceSpec{
+		Type:       string(spec.Type),
+		Name:       spec.Name,
+		Properties: d.substituteSecrets(spec.Properties).(map[string]interface{}),
+		Version:    d.version,
+	}
+}
+
+func (d *Deployer) substituteSecrets(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = d.substituteSecrets(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = d.substituteSecrets(val)
+		}
+		return s
+	case string:
+		for name, value := range d.options.Secrets {
+			t = strings.ReplaceAll(t, "${secret."+name+"}", value)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// deployRun holds the state of a single Deploy call
+type deployRun struct {
+	deployer *Deployer
+	mu       sync.Mutex
+	state    *state.State
+	result   *DeploymentResult
+}
+
+func (r *deployRun) delete(ctx context.Context, spec ResourceSpec) error {
+	d := r.deployer
+	rec, err := currentRecord(r.state, spec.Name)
+	if err != nil {
+		return err
+	}
+
+	d.logger.WithField("resource", spec.Name).Infof("Deleting resource %s", spec.Name)
+	if err := d.remove(ctx, rec.Provider, rec.ID, spec); err != nil {
+		return fmt.Errorf("failed to delete resource %s: %w", spec.Name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.state.Resources, spec.Name)
+	r.result.DeletedResources = append(r.result.DeletedResources, spec.Name)
+	d.record(appliedChange{change: ChangeDelete, name: spec.Name, before: rec})
+	return r.save()
+}
+
+// apply creates or updates a wave of independent resources concurrently
+func (r *deployRun) apply(ctx context.Context, wave []ResourceSpec, changes map[string]string) error {
+	d := r.deployer
+	sem := make(chan struct{}, d.options.Parallel)
+	errs := make(chan error, len(wave))
+	var wg sync.WaitGroup
+
+	for _, spec := range wave {
+		wg.Add(1)
+		go func(spec ResourceSpec) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+			errs <- r.applyOne(ctx, spec, changes[spec.Name])
+		}(spec)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	var msgs []string
+	for err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func (r *deployRun) applyOne(ctx context.Context, spec ResourceSpec, change string) error {
+	d := r.deployer
+	if change == ChangeAdd {
+		d.logger.WithField("resource", spec.Name).Infof("Creating resource %s of type %s", spec.Name, spec.Type)
+		res, err := d.create(ctx, spec)
+		if err != nil {
+			return fmt.Errorf("failed to create resource %s: %w", spec.Name, err)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.state.Resources[spec.Name] = record(spec, res)
+		r.result.CreatedResources = append(r.result.CreatedResources, spec.Name)
+		d.record(appliedChange{change: ChangeAdd, name: spec.Name})
+		return r.save()
+	}
+
+	r.mu.Lock()
+	before, err := currentRecord(r.state, spec.Name)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if change == ChangeReplace {
+		return r.replace(ctx, spec, before)
+	}
+
+	d.logger.WithField("resource", spec.Name).Infof("Updating resource %s", spec.Name)
+	res, err := d.update(ctx, before.ID, spec)
+	if err != nil {
+		return fmt.Errorf("failed to update resource %s: %w", spec.Name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := record(spec, res)
+	if rec.ID == "" {
+		rec.ID = before.ID
+	}
+	r.state.Resources[spec.Name] = rec
+	r.result.UpdatedResources = append(r.result.UpdatedResources, spec.Name)
+	d.record(appliedChange{change: ChangeUpdate, name: spec.Name, before: before})
+	return r.save()
+}
+
+// replace deletes a resource with its old provider and creates it again
+func (r *deployRun) replace(ctx context.Context, spec ResourceSpec, before *ResourceRecord) error {
+	d := r.deployer
+	d.logger.WithField("resource", spec.Name).Infof("Replacing resource %s", spec.Name)
+
+	if err := d.remove(ctx, before.Provider, before.ID, spec); err != nil {
+		return fmt.Errorf("failed to delete resource %s for replacement: %w", spec.Name, err)
+	}
+
+	r.mu.Lock()
+	delete(r.state.Resources, spec.Name)
+	if err := r.save(); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+
+	res, err := d.create(ctx, spec)
+	if err != nil {
+		// Recorded as a deletion so a rollback recreates the old resource
+		d.record(appliedChange{change: ChangeDelete, name: spec.Name, before: before})
+		return fmt.Errorf("failed to create resource %s for replacement: %w", spec.Name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.Resources[spec.Name] = record(spec, res)
+	r.result.ReplacedResources = append(r.result.ReplacedResources, spec.Name)
+	d.record(appliedChange{change: ChangeReplace, name: spec.Name, before: before})
+	return r.save()
+}
+
+// save persists state; callers must hold r.mu
+func (r *deployRun) save() error {
+	if err := r.deployer.stateManager.SaveState(r.result.Environment, r.state); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+func currentRecord(st *state.State, name string) (*ResourceRecord, error) {
+	raw, exists := st.Resources[name]
+	if !exists {
+		return nil, fmt.Errorf("resource %s not found in state", name)
+	}
+
+	var rec ResourceRecord
+	if err := convert(raw, &rec); err != nil {
+		return nil, fmt.Errorf("invalid state for resource %s: %w", name, err)
+	}
+	return &rec, nil
+}
+
+// record builds the state entry for a resource returned by a provider. The
+// configured properties are kept, not the secret-substituted ones.
+func record(spec ResourceSpec, res *plugin.Resource) *ResourceRecord {
+	rec := &ResourceRecord{
+		Type:         string(spec.Type),
+		Provider:     spec.Provider,
+		Properties:   spec.Properties,
+		Dependencies: spec.Dependencies,
+		Status:       string(ResourceStateRunning),
+		UpdatedAt:    time.Now(),
+	}
+	if res != nil {
+		rec.ID = res.ID
+		if res.Status != "" {
+			rec.Status = res.Status
+		}
+	}
+	return rec
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// planDiffer works out the changes of updates while planning, with the
+// provider's Diff when it implements one and structurally otherwise
+type planDiffer struct {
+	deployer *Deployer
+	schemas  providerSchemas
+	// differs caches the Differ of each provider, nil for structural diffs
+	differs map[string]plugin.Differ
+}
+
+func (d *Deployer) newPlanDiffer(schemas providerSchemas) *planDiffer {
+	return &planDiffer{
+		deployer: d,
+		schemas:  schemas,
+		differs:  make(map[string]plugin.Differ),
+	}
+}
+
+// diff compares a resource recorded in state, with defaults filled in as
+// before, to its desired spec
+func (pd *planDiffer) diff(ctx context.Context, rec *ResourceRecord, before, after ResourceSpec) (*plugin.ResourceDiff, error) {
+	current := plugin.Resource{
+		ID:         rec.ID,
+		Type:       string(before.Type),
+		Name:       before.Name,
+		Properties: before.Properties,
+		Status:     rec.Status,
+	}
+	desired := plugin.ResourceSpec{
+		Type:       string(after.Type),
+		Name:       after.Name,
+		Properties: after.Properties,
+	}
+
+	if differ := pd.differ(ctx, after.Provider); differ != nil {
+		if err := pd.deployer.throttle(ctx, after.Provider); err != nil {
+			return nil, err
+		}
+		diff, err := differ.Diff(ctx, current, desired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff resource %s: %w", after.Name, err)
+		}
+		return diff, nil
+	}
+
+	var schema *plugin.ResourceSchema
+	if rs, ok := pd.schemas.resource(after); ok {
+		schema = &rs
+	}
+	return plugin.StructuralDiff(current, desired, schema), nil
+}
+
+// refresh reads a resource recorded in state from its provider and returns
+// before with the configured properties that drifted from what was applied.
+// Properties the provider adds are ignored, and the resource is diffed
+// against state when it cannot be read. Providers with a Differ compare
+// with the live resource themselves and are not refreshed.
+func (pd *planDiffer) refresh(ctx context.Context, rec *ResourceRecord, before ResourceSpec) ResourceSpec {
+	if rec.ID == "" || pd.deployer.pluginManager == nil || pd.differ(ctx, before.Provider) != nil {
+		return before
+	}
+
+	p, err := pd.deployer.provider(ctx, before.Provider)
+	if err == nil {
+		err = pd.deployer.throttle(ctx, before.Provider)
+	}
+	var live *plugin.Resource
+	if err == nil {
+		live, err = p.GetResource(ctx, rec.ID)
+	}
+	if err != nil {
+		pd.deployer.logger.Warnf("Not refreshing resource %s: %v", before.Name, err)
+		return before
+	}
+
+	var drifted map[string]interface{}
+	for k, applied := range before.Properties {
+		v, ok := live.Properties[k]
+		if !ok || sameValue(v, pd.deployer.substituteSecrets(applied)) {
+			continue
+		}
+		if drifted == nil {
+			drifted = make(map[string]interface{}, len(before.Properties))
+			for k, v := range before.Properties {
+				drifted[k] = v
+			}
+		}
+		drifted[k] = v
+		pd.deployer.logger.Warnf("Resource %s drifted: %s changed outside of gort", before.Name, k)
+	}
+	if drifted != nil {
+		before.Properties = drifted
+	}
+	return before
+}
+
+// sameValue compares values through JSON, so numbers decoded from YAML and
+// from providers compare equal
+func sameValue(a, b interface{}) bool {
+	da, errA := json.Marshal(a)
+	db, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
+
+// differ returns the Differ of a provider. Providers that cannot be loaded
+// are diffed structurally.
+func (pd *planDiffer) differ(ctx context.Context, name string) plugin.Differ {
+	if differ, cached := pd.differs[name]; cached {
+		return differ
+	}
+
+	var differ plugin.Differ
+	if pd.deployer.pluginManager != nil {
+		var err error
+		if differ, err = pd.deployer.pluginManager.Differ(ctx, name); err != nil {
+			pd.deployer.logger.Warnf("Diffing resources of provider %s structurally: %v", name, err)
+		}
+	}
+	pd.differs[name] = differ
+	return differ
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/provider"
+)
+
+// PlanFormatVersion is the version of the machine-readable plan document.
+// It is bumped whenever a field is removed or changes meaning; fields may
+// be added without a bump.
+const PlanFormatVersion = 1
+
+// PlanDocument is the stable JSON representation of a deployment plan, as
+// printed by `gort plan -o json`
+type PlanDocument struct {
+	FormatVersion int              `json:"format_version" yaml:"format_version"`
+	Environment   string           `json:"environment" yaml:"environment"`
+	Version       string           `json:"version,omitempty" yaml:"version,omitempty"`
+	CreatedAt     time.Time        `json:"created_at" yaml:"created_at"`
+	Summary       PlanSummary      `json:"summary" yaml:"summary"`
+	Changes       []ChangeDocument `json:"changes" yaml:"changes"`
+	StateDigest   string           `json:"state_digest,omitempty" yaml:"state_digest,omitempty"`
+}
+
+// PlanSummary counts the planned changes by action
+type PlanSummary struct {
+	Add     int `json:"add" yaml:"add"`
+	Update  int `json:"update" yaml:"update"`
+	Delete  int `json:"delete" yaml:"delete"`
+	Replace int `json:"replace" yaml:"replace"`
+}
+
+// ChangeDocument describes a single provider.Change. Before is null for
+// additions and After is null for deletions.
+type ChangeDocument struct {
+	Action   string        `json:"action" yaml:"action"`
+	Resource string        `json:"resource" yaml:"resource"`
+	Type     string        `json:"type" yaml:"type"`
+	Provider string        `json:"provider" yaml:"provider"`
+	Before   *ResourceSpec `json:"before" yaml:"before"`
+	After    *ResourceSpec `json:"after" yaml:"after"`
+	// Attributes lists the attribute changes of updates and replacements,
+	// as planned by the provider
+	Attributes []plugin.AttributeChange `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	// ForcesReplacement lists the attributes that cause a replace
+	ForcesReplacement []string `json:"forces_replacement,omitempty" yaml:"forces_replacement,omitempty"`
+	// Sensitive lists the attributes the provider marks as sensitive
+	Sensitive []string `json:"sensitive,omitempty" yaml:"sensitive,omitempty"`
+}
+
+// Document returns the versioned representation of the plan
+func (p *DeploymentPlan) Document() *PlanDocument {
+	doc := &PlanDocument{
+		FormatVersion: PlanFormatVersion,
+		Environment:   p.Environment,
+		Version:       p.Version,
+		CreatedAt:     p.CreatedAt,
+		Summary: PlanSummary{
+			Add:     len(p.AddResources),
+			Update:  len(p.UpdateResources),
+			Delete:  len(p.DeleteResources),
+			Replace: len(p.ReplaceResources),
+		},
+		Changes:     make([]ChangeDocument, 0, len(p.Changes)),
+		StateDigest: p.StateDigest,
+	}
+
+	for _, c := range p.Changes {
+		change := ChangeDocument{
+			Action:            c.Type,
+			Resource:          c.Resource,
+			Attributes:        c.Attributes,
+			ForcesReplacement: c.ForcesReplacement,
+			Sensitive:         c.Sensitive,
+		}
+		if spec, ok := c.Before.(ResourceSpec); ok {
+			change.Before = &spec
+			change.Type, change.Provider = string(spec.Type), spec.Provider
+		}
+		if spec, ok := c.After.(ResourceSpec); ok {
+			change.After = &spec
+			change.Type, change.Provider = string(spec.Type), spec.Provider
+		}
+		doc.Changes = append(doc.Changes, change)
+	}
+
+	return doc
+}
+
+// Plan rebuilds a deployment plan from a saved document
+func (doc *PlanDocument) Plan() (*DeploymentPlan, error) {
+	if doc.FormatVersion < 1 || doc.FormatVersion > PlanFormatVersion {
+		return nil, fmt.Errorf("unsupported plan format version %d (supported up to %d)", doc.FormatVersion, PlanFormatVersion)
+	}
+
+	plan := &DeploymentPlan{
+		Environment: doc.Environment,
+		Version:     doc.Version,
+		CreatedAt:   doc.CreatedAt,
+		StateDigest: doc.StateDigest,
+	}
+	for _, c := range doc.Changes {
+		change := provider.Change{
+			Type:              c.Action,
+			Resource:          c.Resource,
+			Attributes:        c.Attributes,
+			ForcesReplacement: c.ForcesReplacement,
+			Sensitive:         c.Sensitive,
+		}
+		if c.Before != nil {
+			change.Before = *c.Before
+		}
+		if c.After != nil {
+			change.After = *c.After
+		}
+
+		switch c.Action {
+		case ChangeAdd, ChangeUpdate, ChangeReplace:
+			if c.After == nil {
+				return nil, fmt.Errorf("change %s of resource %s has no new spec", c.Action, c.Resource)
+			}
+		case ChangeDelete:
+			if c.Before == nil {
+				return nil, fmt.Errorf("change %s of resource %s has no current spec", c.Action, c.Resource)
+			}
+		default:
+			return nil, fmt.Errorf("unknown change %s of resource %s", c.Action, c.Resource)
+		}
+
+		switch c.Action {
+		case ChangeAdd:
+			plan.AddResources = append(plan.AddResources, *c.After)
+		case ChangeUpdate:
+			plan.UpdateResources = append(plan.UpdateResources, *c.After)
+		case ChangeReplace:
+			plan.ReplaceResources = append(plan.ReplaceResources, *c.After)
+		case ChangeDelete:
+			plan.DeleteResources = append(plan.DeleteResources, *c.Before)
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	return plan, nil
+}
@@ -1,22 +1,33 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/yahao333/gort/internal/config"
 	"github.com/yahao333/gort/internal/logging"
+	"github.com/yahao333/gort/internal/state"
 	"gopkg.in/yaml.v3"
 )
 
 type EnvironmentManager struct {
-	configPath string
-	lockPath   string
-	mu         sync.Mutex
-	logger     *logging.Logger
+	configPath   string
+	lockPath     string
+	mu           sync.Mutex
+	stateManager *state.StateManager
+	logger       logging.Log
 }
 
+// EnvironmentConfig is the effective configuration of an environment.
+// Secrets holds secret references (see secrets.Resolver) that are only
+// resolved at runtime and never persisted.
 type EnvironmentConfig struct {
 	Variables map[string]string         `yaml:"variables"`
 	Secrets   map[string]string         `yaml:"secrets"`
@@ -28,27 +39,191 @@ type ProviderConfig struct {
 	Properties map[string]interface{} `yaml:"properties"`
 }
 
-func NewEnvironmentManager(configPath string, logger *logging.Logger) *EnvironmentManager {
+func NewEnvironmentManager(configPath string, stateManager *state.StateManager, logger logging.Log) *EnvironmentManager {
 	return &EnvironmentManager{
-		configPath: configPath,
-		lockPath:   filepath.Join(filepath.Dir(configPath), "locks"),
-		logger:     logger,
+		configPath:   configPath,
+		lockPath:     filepath.Join(filepath.Dir(configPath), "locks"),
+		stateManager: stateManager,
+		logger:       logger,
 	}
 }
 
+// validName restricts environment names to what is safe as a file name
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// CreateOptions controls how an environment is created from another
+type CreateOptions struct {
+	// Overrides are set on the copied settings by dotted path, e.g.
+	// "variables.branch"
+	Overrides map[string]interface{}
+	// TTL makes the environment ephemeral; it is destroyed by `gort env gc`
+	// once expired
+	TTL time.Duration
+}
+
+// CreateEnvironment materializes a new environment in environments/ from the
+// effective settings of an existing one, and returns the file written
+func (em *EnvironmentManager) CreateEnvironment(name, from string, opts CreateOptions) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid environment name %q", name)
+	}
+
+	cfg, err := config.LoadConfig(em.configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load environment config: %w", err)
+	}
+	if _, exists := cfg.Environments[name]; exists {
+		return "", fmt.Errorf("environment '%s' already exists", name)
+	}
+
+	values, err := cfg.EnvironmentValues(from)
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(opts.Overrides))
+	for key := range opts.Overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := setPath(values, key, opts.Overrides[key]); err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Created from %s by `gort env create`\n", from)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(values); err != nil {
+		return "", fmt.Errorf("failed to marshal environment: %w", err)
+	}
+
+	path := filepath.Join(cfg.Dir(), config.EnvironmentsDir, name+".yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create environments directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write environment: %w", err)
+	}
+
+	// Overrides may produce an invalid configuration
+	if _, err := config.LoadConfig(em.configPath); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to create environment %s: %w", name, err)
+	}
+
+	// Without its expiry an ephemeral environment would never be collected
+	if opts.TTL > 0 {
+		st, err := em.stateManager.LoadState(name)
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		expires := time.Now().Add(opts.TTL).UTC()
+		st.ExpiresAt = &expires
+		if err := em.stateManager.SaveState(name, st); err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("failed to save state: %w", err)
+		}
+	}
+
+	em.logger.Infof("Created environment %s from %s", name, from)
+	return path, nil
+}
+
+// ExpiredEnvironments returns the ephemeral environments that expired
+// before now
+func (em *EnvironmentManager) ExpiredEnvironments(now time.Time) ([]string, error) {
+	envs, err := em.stateManager.ListEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, env := range envs {
+		st, err := em.stateManager.LoadState(env)
+		if err != nil {
+			return nil, err
+		}
+		if st.ExpiresAt != nil && st.ExpiresAt.Before(now) {
+			expired = append(expired, env)
+		}
+	}
+	return expired, nil
+}
+
+// RemoveEnvironment deletes the file of an environment created with
+// CreateEnvironment and its state. Its resources must have been destroyed.
+func (em *EnvironmentManager) RemoveEnvironment(name string) error {
+	st, err := em.stateManager.LoadState(name)
+	if err != nil {
+		return err
+	}
+	if len(st.Resources) > 0 {
+		return fmt.Errorf("environment %s still has %d resource(s)", name, len(st.Resources))
+	}
+
+	path := filepath.Join(filepath.Dir(em.configPath), config.EnvironmentsDir, name+".yaml")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove environment: %w", err)
+	}
+	if err := em.stateManager.DeleteState(name); err != nil {
+		return err
+	}
+
+	em.logger.Infof("Removed environment %s", name)
+	return nil
+}
+
+// setPath sets a value in nested maps by dotted path
+func setPath(values map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	cur := values
+	for i, key := range keys[:len(keys)-1] {
+		next, ok := cur[key].(map[string]interface{})
+		if !ok {
+			if cur[key] != nil {
+				return fmt.Errorf("cannot set %s: %s is not a mapping", path, strings.Join(keys[:i+1], "."))
+			}
+			next = make(map[string]interface{})
+			cur[key] = next
+		}
+		cur = next
+	}
+	cur[keys[len(keys)-1]] = value
+	return nil
+}
+
+// LoadEnvironment returns the effective configuration of an environment,
+// as merged by config.LoadConfig from the root config file at configPath.
 func (em *EnvironmentManager) LoadEnvironment(name string) (*EnvironmentConfig, error) {
-	configFile := filepath.Join(em.configPath, fmt.Sprintf("%s.yaml", name))
-	data, err := os.ReadFile(configFile)
+	cfg, err := config.LoadConfig(em.configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read environment config: %w", err)
+		return nil, fmt.Errorf("failed to load environment config: %w", err)
+	}
+
+	env, exists := cfg.Environments[name]
+	if !exists {
+		return nil, fmt.Errorf("environment '%s' not found in configuration", name)
 	}
 
-	var config EnvironmentConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse environment config: %w", err)
+	variables := make(map[string]string, len(env.Variables))
+	for k, v := range env.Variables {
+		variables[k] = fmt.Sprint(v)
 	}
 
-	return &config, nil
+	provider := cfg.Providers[env.Provider]
+	return &EnvironmentConfig{
+		Variables: variables,
+		Secrets:   env.Secrets,
+		Providers: map[string]ProviderConfig{
+			env.Provider: {
+				Type:       provider.Type,
+				Properties: provider.Properties,
+			},
+		},
+	}, nil
 }
 
 func (em *EnvironmentManager) LockEnvironment(name string) error {
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// throttle waits until the rate limit of a provider allows another call
+func (d *Deployer) throttle(ctx context.Context, providerName string) error {
+	waited, err := d.pluginManager.Limiter(providerName).Wait(ctx)
+	if waited = waited.Round(time.Millisecond); waited > 0 {
+		d.logger.Debugf("Waited %s for the rate limit of provider %s", waited, providerName)
+		d.addWait(providerName, waited)
+	}
+	return err
+}
+
+// addWait records time spent waiting for the limits of a provider for the
+// DeploymentResult
+func (d *Deployer) addWait(providerName string, waited time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.waits == nil {
+		d.waits = make(map[string]time.Duration)
+	}
+	d.waits[providerName] += waited
+}
+
+// limitedProvider waits for the rate limit of the provider before every call
+type limitedProvider struct {
+	plugin.ProviderPlugin
+	throttle func(context.Context) error
+}
+
+func (p limitedProvider) CreateResource(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.ProviderPlugin.CreateResource(ctx, spec)
+}
+
+func (p limitedProvider) DeleteResource(ctx context.Context, id string) error {
+	if err := p.throttle(ctx); err != nil {
+		return err
+	}
+	return p.ProviderPlugin.DeleteResource(ctx, id)
+}
+
+func (p limitedProvider) UpdateResource(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.ProviderPlugin.UpdateResource(ctx, id, spec)
+}
+
+func (p limitedProvider) GetResource(ctx context.Context, id string) (*plugin.Resource, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.ProviderPlugin.GetResource(ctx, id)
+}
+
+// limitedAsync waits for the rate limit of the provider before every call
+type limitedAsync struct {
+	plugin.AsyncProvider
+	throttle func(context.Context) error
+}
+
+func (p limitedAsync) StartCreate(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.AsyncProvider.StartCreate(ctx, spec)
+}
+
+func (p limitedAsync) StartUpdate(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.AsyncProvider.StartUpdate(ctx, id, spec)
+}
+
+func (p limitedAsync) StartDelete(ctx context.Context, id string) (*plugin.Operation, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.AsyncProvider.StartDelete(ctx, id)
+}
+
+func (p limitedAsync) PollOperation(ctx context.Context, op plugin.Operation) (*plugin.OperationStatus, error) {
+	if err := p.throttle(ctx); err != nil {
+		return nil, err
+	}
+	return p.AsyncProvider.PollOperation(ctx, op)
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+const (
+	// DefaultTimeout bounds the operations on a resource without a timeout
+	DefaultTimeout = 10 * time.Minute
+	// DefaultPollInterval is the first delay between checks of operations
+	// and ready conditions
+	DefaultPollInterval = 2 * time.Second
+	maxPollInterval     = 30 * time.Second
+)
+
+// ProgressEvent reports the progress of a resource while a plan is applied
+type ProgressEvent struct {
+	Resource string
+	// Action is ChangeAdd, ChangeUpdate or ChangeDelete
+	Action  string
+	Message string
+	Elapsed time.Duration
+	Done    bool
+	Err     error
+}
+
+// progress sends an event to the progress callback, if any
+func (d *Deployer) progress(name, action string, start time.Time, message string, done bool, err error) {
+	if d.options.Progress == nil {
+		return
+	}
+	d.options.Progress(ProgressEvent{
+		Resource: name,
+		Action:   action,
+		Message:  message,
+		Elapsed:  time.Since(start),
+		Done:     done,
+		Err:      err,
+	})
+}
+
+// create creates a resource with its provider and waits until it is ready
+func (d *Deployer) create(ctx context.Context, spec ResourceSpec) (*plugin.Resource, error) {
+	return d.operate(ctx, spec, ChangeAdd, func(ctx context.Context, p plugin.ProviderPlugin, async plugin.AsyncProvider) (*plugin.Resource, *plugin.Operation, error) {
+		if async != nil {
+			op, err := async.StartCreate(ctx, d.pluginSpec(spec))
+			return nil, op, err
+		}
+		res, err := p.CreateResource(ctx, d.pluginSpec(spec))
+		return res, nil, err
+	})
+}
+
+// update updates a resource with its provider and waits until it is ready
+func (d *Deployer) update(ctx context.Context, id string, spec ResourceSpec) (*plugin.Resource, error) {
+	return d.operate(ctx, spec, ChangeUpdate, func(ctx context.Context, p plugin.ProviderPlugin, async plugin.AsyncProvider) (*plugin.Resource, *plugin.Operation, error) {
+		if async != nil {
+			op, err := async.StartUpdate(ctx, id, d.pluginSpec(spec))
+			return nil, op, err
+		}
+		res, err := p.UpdateResource(ctx, id, d.pluginSpec(spec))
+		return res, nil, err
+	})
+}
+
+// remove deletes a resource with the provider that created it
+func (d *Deployer) remove(ctx context.Context, providerName, id string, spec ResourceSpec) error {
+	spec.Provider = providerName
+	spec.Ready = nil
+	_, err := d.operate(ctx, spec, ChangeDelete, func(ctx context.Context, p plugin.ProviderPlugin, async plugin.AsyncProvider) (*plugin.Resource, *plugin.Operation, error) {
+		if async != nil {
+			op, err := async.StartDelete(ctx, id)
+			return nil, op, err
+		}
+		return nil, nil, p.DeleteResource(ctx, id)
+	})
+	return err
+}
+
+// operate makes a provider call within the timeout of the resource, waits
+// for the operation it started, if any, then for its ready condition,
+// reporting progress along the way. Only the call itself is retried: a
+// failed poll of its operation is retried by wait and never starts the
+// operation again.
+func (d *Deployer) operate(ctx context.Context, spec ResourceSpec, action string,
+	call func(context.Context, plugin.ProviderPlugin, plugin.AsyncProvider) (*plugin.Resource, *plugin.Operation, error)) (*plugin.Resource, error) {
+	p, err := d.provider(ctx, spec.Provider)
+	if err != nil {
+		return nil, err
+	}
+	async, err := d.pluginManager.GetAsync(spec.Provider)
+	if err != nil {
+		return nil, err
+	}
+	throttle := func(ctx context.Context) error { return d.throttle(ctx, spec.Provider) }
+	p = limitedProvider{ProviderPlugin: p, throttle: throttle}
+	if async != nil {
+		async = limitedAsync{AsyncProvider: async, throttle: throttle}
+	}
+
+	// The timeout starts once the provider allows another operation
+	release, waited, err := d.pluginManager.Limiter(spec.Provider).Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if waited = waited.Round(time.Millisecond); waited > 0 {
+		d.logger.WithField("resource", spec.Name).Infof("Waited %s for a free operation slot of provider %s", waited, spec.Provider)
+		d.addWait(spec.Provider, waited)
+	}
+
+	timeout := spec.timeout()
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	d.progress(spec.Name, action, start, progressVerbs[action], false, nil)
+	var res *plugin.Resource
+	err = d.retry(opCtx, spec, action, start, func() error {
+		var op *plugin.Operation
+		var err error
+		res, op, err = call(opCtx, p, async)
+		if err != nil || async == nil {
+			return err
+		}
+		res, err = d.wait(opCtx, async, spec, action, op, start)
+		return err
+	})
+	if err == nil && spec.Ready != nil {
+		res, err = d.waitReady(opCtx, p, spec, action, res, start)
+	}
+	// Only the timeout of the resource is reported as such, not the end of
+	// the whole deployment
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	d.progress(spec.Name, action, start, "", true, err)
+	return res, err
+}
+
+var progressVerbs = map[string]string{
+	ChangeAdd:    "creating",
+	ChangeUpdate: "updating",
+	ChangeDelete: "deleting",
+}
+
+// wait polls an operation until it is done. Failed polls are retried with
+// the retry policy of the resource; when they keep failing the error is
+// permanent, so that the operation is not started again. Only an operation
+// the provider reports as failed and retryable may be started again.
+func (d *Deployer) wait(ctx context.Context, async plugin.AsyncProvider, spec ResourceSpec, action string, op *plugin.Operation, start time.Time) (*plugin.Resource, error) {
+	if op == nil {
+		return nil, fmt.Errorf("provider returned no operation")
+	}
+
+	var res *plugin.Resource
+	err := poll(ctx, spec.pollInterval(), func() (bool, error) {
+		var status *plugin.OperationStatus
+		err := d.retry(ctx, spec, action, start, func() error {
+			var err error
+			status, err = async.PollOperation(ctx, *op)
+			return err
+		})
+		if err != nil {
+			return false, plugin.Permanent(fmt.Errorf("failed to poll operation %s: %w", op.ID, err))
+		}
+		if !status.Done {
+			msg := status.Message
+			if msg == "" {
+				msg = "operation " + op.ID + " in progress"
+			}
+			d.progress(spec.Name, action, start, msg, false, nil)
+			return false, nil
+		}
+		if status.Error != "" {
+			err := fmt.Errorf("operation %s failed: %s", op.ID, status.Error)
+			if status.Retryable {
+				err = plugin.Retryable(err)
+			}
+			return false, err
+		}
+		res = status.Resource
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil && op.ResourceID != "" {
+		res = &plugin.Resource{ID: op.ResourceID}
+	}
+	return res, nil
+}
+
+// waitReady polls the resource until its ready condition holds
+func (d *Deployer) waitReady(ctx context.Context, p plugin.ProviderPlugin, spec ResourceSpec, action string, res *plugin.Resource, start time.Time) (*plugin.Resource, error) {
+	if res == nil || res.ID == "" {
+		return nil, fmt.Errorf("provider returned no resource ID to check readiness with")
+	}
+
+	cond := spec.Ready
+	id := res.ID
+	first := true
+	err := poll(ctx, spec.pollInterval(), func() (bool, error) {
+		// The resource returned by the call is checked first, without
+		// asking the provider again
+		if !first || res.Status == "" {
+			current, err := p.GetResource(ctx, id)
+			if err != nil {
+				return false, fmt.Errorf("failed to read resource: %w", err)
+			}
+			res = current
+		}
+		first = false
+
+		reason := readiness(ctx, cond, res)
+		if reason == "" {
+			return true, nil
+		}
+		d.progress(spec.Name, action, start, "waiting until ready: "+reason, false, nil)
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.ID == "" {
+		res.ID = id
+	}
+	return res, nil
+}
+
+// readiness returns why a resource is not ready, or "" when it is
+func readiness(ctx context.Context, cond *config.ReadyCondition, res *plugin.Resource) string {
+	if cond.Status != "" && res.Status != cond.Status {
+		return fmt.Sprintf("status is %q, want %q", res.Status, cond.Status)
+	}
+
+	keys := make([]string, 0, len(cond.Attributes))
+	for k := range cond.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Compare through JSON so YAML and provider numbers match
+		var want, have interface{}
+		if convert(cond.Attributes[k], &want) != nil || convert(res.Properties[k], &have) != nil || !reflect.DeepEqual(want, have) {
+			return fmt.Sprintf("%s is %v, want %v", k, res.Properties[k], cond.Attributes[k])
+		}
+	}
+
+	if cond.HealthCheck != "" {
+		if err := healthCheck(ctx, cond.HealthCheck); err != nil {
+			return "health check: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// healthCheck requests an http(s) URL, expecting a 2xx status, or connects
+// to a tcp://host:port address
+func healthCheck(ctx context.Context, target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if u.Scheme == "tcp" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", target, resp.Status)
+	}
+	return nil
+}
+
+// poll calls check until it reports done, fails or ctx ends. The delay
+// between calls starts at interval and doubles up to maxPollInterval.
+func poll(ctx context.Context, interval time.Duration, check func() (bool, error)) error {
+	for {
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if interval *= 2; interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+}
+
+// timeout is how long operations on the resource may take
+func (s ResourceSpec) timeout() time.Duration {
+	if d, err := time.ParseDuration(s.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTimeout
+}
+
+func (s ResourceSpec) pollInterval() time.Duration {
+	if s.Ready != nil {
+		if d, err := time.ParseDuration(s.Ready.Interval); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultPollInterval
+}
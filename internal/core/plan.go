@@ -0,0 +1,379 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/provider"
+	"github.com/yahao333/gort/internal/state"
+)
+
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	// ChangeReplace deletes a resource and creates it again, for changes a
+	// provider cannot apply in place
+	ChangeReplace = "replace"
+)
+
+// DeploymentPlan describes the changes needed to bring an environment to
+// its configured state
+type DeploymentPlan struct {
+	Environment     string            `json:"environment" yaml:"environment"`
+	Version         string            `json:"version,omitempty" yaml:"version,omitempty"`
+	CreatedAt       time.Time         `json:"created_at" yaml:"created_at"`
+	Changes         []provider.Change `json:"changes" yaml:"changes"`
+	AddResources    []ResourceSpec    `json:"add_resources" yaml:"add_resources"`
+	UpdateResources []ResourceSpec    `json:"update_resources" yaml:"update_resources"`
+	// ReplaceResources holds the new specs of resources to be replaced
+	ReplaceResources []ResourceSpec `json:"replace_resources" yaml:"replace_resources"`
+	// StateDigest identifies the state the plan was made against, so a
+	// saved plan is not applied once the state has changed
+	StateDigest     string         `json:"state_digest,omitempty" yaml:"state_digest,omitempty"`
+	DeleteResources []ResourceSpec `json:"delete_resources" yaml:"delete_resources"`
+}
+
+// HasChanges reports whether applying the plan would change anything
+func (p *DeploymentPlan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// ResourceRecord is what the deployer keeps in state for a managed resource
+type ResourceRecord struct {
+	ID           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	Provider     string                 `json:"provider"`
+	Properties   map[string]interface{} `json:"properties"`
+	Dependencies []string               `json:"dependencies,omitempty"`
+	Status       string                 `json:"status"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+func (r *ResourceRecord) spec(name string) ResourceSpec {
+	return ResourceSpec{
+		Name:         name,
+		Type:         ResourceType(r.Type),
+		Provider:     r.Provider,
+		Properties:   r.Properties,
+		Dependencies: r.Dependencies,
+	}
+}
+
+// Plan compares the resources configured for an environment with its state
+func (d *Deployer) Plan(ctx context.Context, envName string, cfg *config.Config) (*DeploymentPlan, error) {
+	env, exists := cfg.Environments[envName]
+	if !exists {
+		return nil, fmt.Errorf("environment '%s' not found in configuration", envName)
+	}
+
+	st, err := d.stateManager.LoadState(envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	current, err := records(st)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := stateDigest(st)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DeploymentPlan{
+		Environment: envName,
+		Version:     d.options.Version,
+		CreatedAt:   time.Now(),
+		StateDigest: digest,
+	}
+
+	desired, err := desiredResources(env, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := d.schemas(ctx, desired, current)
+	if err := schemas.apply(desired); err != nil {
+		return nil, err
+	}
+	differ := d.newPlanDiffer(schemas)
+
+	for _, spec := range orderSpecs(desired) {
+		sensitive := schemas.sensitive(spec)
+		rec, exists := current[spec.Name]
+		if !exists {
+			plan.AddResources = append(plan.AddResources, spec)
+			plan.Changes = append(plan.Changes, provider.Change{
+				Type:      ChangeAdd,
+				Resource:  spec.Name,
+				After:     spec,
+				Sensitive: sensitive,
+			})
+			continue
+		}
+
+		before, err := schemas.withDefaults(rec.spec(spec.Name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid state for resource %s: %w", spec.Name, err)
+		}
+		before = differ.refresh(ctx, rec, before)
+		if forced := ForcesReplacement(before, spec); len(forced) > 0 {
+			plan.ReplaceResources = append(plan.ReplaceResources, spec)
+			plan.Changes = append(plan.Changes, provider.Change{
+				Type:              ChangeReplace,
+				Resource:          spec.Name,
+				Before:            before,
+				After:             spec,
+				ForcesReplacement: forced,
+				Sensitive:         sensitive,
+			})
+			continue
+		}
+
+		diff, err := differ.diff(ctx, rec, before, spec)
+		if err != nil {
+			return nil, err
+		}
+		if forced := diff.ReplaceAttributes(); len(forced) > 0 {
+			plan.ReplaceResources = append(plan.ReplaceResources, spec)
+			plan.Changes = append(plan.Changes, provider.Change{
+				Type:              ChangeReplace,
+				Resource:          spec.Name,
+				Before:            before,
+				After:             spec,
+				Attributes:        diff.Changes,
+				ForcesReplacement: forced,
+				Sensitive:         sensitive,
+			})
+		} else if diff.HasChanges() {
+			plan.UpdateResources = append(plan.UpdateResources, spec)
+			plan.Changes = append(plan.Changes, provider.Change{
+				Type:       ChangeUpdate,
+				Resource:   spec.Name,
+				Before:     before,
+				After:      spec,
+				Attributes: diff.Changes,
+				Sensitive:  sensitive,
+			})
+		}
+	}
+
+	var removed []ResourceSpec
+	for name, rec := range current {
+		if _, exists := desired[name]; !exists {
+			removed = append(removed, rec.spec(name))
+		}
+	}
+	removed = reverseSpecs(orderSpecs(specMap(removed)))
+	for _, spec := range removed {
+		plan.DeleteResources = append(plan.DeleteResources, spec)
+		plan.Changes = append(plan.Changes, provider.Change{
+			Type:      ChangeDelete,
+			Resource:  spec.Name,
+			Before:    spec,
+			Sensitive: schemas.sensitive(spec),
+		})
+	}
+
+	d.logger.Infof("Planned %d change(s) for environment %s", len(plan.Changes), envName)
+	return plan, nil
+}
+
+// PlanDestroy plans the deletion of every resource of an environment
+func (d *Deployer) PlanDestroy(ctx context.Context, envName string) (*DeploymentPlan, error) {
+	st, err := d.stateManager.LoadState(envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	current, err := records(st)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := stateDigest(st)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DeploymentPlan{
+		Environment: envName,
+		Version:     d.options.Version,
+		CreatedAt:   time.Now(),
+		StateDigest: digest,
+	}
+
+	specs := make(map[string]ResourceSpec, len(current))
+	for name, rec := range current {
+		specs[name] = rec.spec(name)
+	}
+	schemas := d.schemas(ctx, nil, current)
+	for _, spec := range reverseSpecs(orderSpecs(specs)) {
+		plan.DeleteResources = append(plan.DeleteResources, spec)
+		plan.Changes = append(plan.Changes, provider.Change{
+			Type:      ChangeDelete,
+			Resource:  spec.Name,
+			Before:    spec,
+			Sensitive: schemas.sensitive(spec),
+		})
+	}
+
+	d.logger.Infof("Planned destruction of %d resource(s) in environment %s", len(plan.Changes), envName)
+	return plan, nil
+}
+
+// desiredResources builds the specs of the resources configured for env.
+// Properties are normalized through JSON so they compare equal to state.
+func desiredResources(env config.Environment, cfg *config.Config) (map[string]ResourceSpec, error) {
+	specs := make(map[string]ResourceSpec, len(env.Resources))
+	for name, res := range env.Resources {
+		props, err := normalize(res.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("invalid properties for resource %s: %w", name, err)
+		}
+
+		deps := append([]string(nil), res.DependsOn...)
+		sort.Strings(deps)
+		specs[name] = ResourceSpec{
+			Name:         name,
+			Type:         ResourceType(res.Type),
+			Provider:     cfg.PluginName(env, res),
+			Properties:   props,
+			Dependencies: deps,
+			Ready:        res.Ready,
+			Timeout:      res.Timeout,
+			Retry:        cfg.RetryPolicy(env, res),
+		}
+	}
+	return specs, nil
+}
+
+// stateDigest hashes the resources in state
+func stateDigest(st *state.State) (string, error) {
+	data, err := json.Marshal(st.Resources)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash state: %w", err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
+
+func records(st *state.State) (map[string]*ResourceRecord, error) {
+	recs := make(map[string]*ResourceRecord, len(st.Resources))
+	for name, raw := range st.Resources {
+		var rec ResourceRecord
+		if err := convert(raw, &rec); err != nil {
+			return nil, fmt.Errorf("invalid state for resource %s: %w", name, err)
+		}
+		recs[name] = &rec
+	}
+	return recs, nil
+}
+
+// ForcesReplacement returns the attributes whose change cannot be applied in
+// place regardless of the provider: a resource moving to another type or
+// provider is recreated. Providers with a schema add their ForceNew
+// attributes when planning.
+func ForcesReplacement(before, after ResourceSpec) []string {
+	var attrs []string
+	if before.Type != after.Type {
+		attrs = append(attrs, "type")
+	}
+	if before.Provider != after.Provider {
+		attrs = append(attrs, "provider")
+	}
+	return attrs
+}
+
+// orderSpecs sorts specs so that dependencies come before the resources
+// that depend on them, breaking ties by name.
+func orderSpecs(specs map[string]ResourceSpec) []ResourceSpec {
+	var ordered []ResourceSpec
+	for _, level := range levels(specs) {
+		ordered = append(ordered, level...)
+	}
+	return ordered
+}
+
+// levels groups specs into waves; every spec only depends on specs in
+// earlier waves. Dependencies outside the set are ignored, and cycles are
+// broken by emitting the remaining specs in a final wave.
+func levels(specs map[string]ResourceSpec) [][]ResourceSpec {
+	done := make(map[string]bool, len(specs))
+	var waves [][]ResourceSpec
+
+	for len(done) < len(specs) {
+		var wave []ResourceSpec
+		for name, spec := range specs {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range spec.Dependencies {
+				if _, inSet := specs[dep]; inSet && !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				wave = append(wave, spec)
+			}
+		}
+
+		if len(wave) == 0 {
+			for name, spec := range specs {
+				if !done[name] {
+					wave = append(wave, spec)
+				}
+			}
+		}
+
+		sort.Slice(wave, func(i, j int) bool { return wave[i].Name < wave[j].Name })
+		for _, spec := range wave {
+			done[spec.Name] = true
+		}
+		waves = append(waves, wave)
+	}
+
+	return waves
+}
+
+func specMap(specs []ResourceSpec) map[string]ResourceSpec {
+	m := make(map[string]ResourceSpec, len(specs))
+	for _, s := range specs {
+		m[s.Name] = s
+	}
+	return m
+}
+
+func reverseSpecs(specs []ResourceSpec) []ResourceSpec {
+	for i, j := 0, len(specs)-1; i < j; i, j = i+1, j-1 {
+		specs[i], specs[j] = specs[j], specs[i]
+	}
+	return specs
+}
+
+func normalize(props map[string]interface{}) (map[string]interface{}, error) {
+	if props == nil {
+		return nil, nil
+	}
+	var out map[string]interface{}
+	if err := convert(props, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// convert copies v into out through its JSON representation
+func convert(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
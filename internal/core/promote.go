@@ -0,0 +1,83 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yahao333/gort/internal/state"
+)
+
+// healthyStatuses are the resource statuses reported by providers for
+// resources that are up
+var healthyStatuses = map[string]bool{
+	string(ResourceStateRunning): true,
+	"healthy":                    true,
+	"available":                  true,
+	"active":                     true,
+	"ready":                      true,
+}
+
+// UnhealthyResources returns the resources in state whose last known status
+// is not healthy, by name
+func UnhealthyResources(st *state.State) (map[string]string, error) {
+	recs, err := records(st)
+	if err != nil {
+		return nil, err
+	}
+
+	unhealthy := make(map[string]string)
+	for name, rec := range recs {
+		if !healthyStatuses[rec.Status] {
+			unhealthy[name] = rec.Status
+		}
+	}
+	return unhealthy, nil
+}
+
+// CheckPromotion verifies that version can be promoted from env: it must be
+// the latest deployment of env, that deployment must have succeeded and
+// every resource of env must be healthy.
+func CheckPromotion(sm *state.StateManager, env, version string) error {
+	history, err := sm.History(env)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("environment %s has no deployment history", env)
+	}
+
+	last := history[len(history)-1]
+	if last.Version != version {
+		return fmt.Errorf("version %s is not deployed to %s, the latest deployment is version %q", version, env, last.Version)
+	}
+	if last.Status != state.DeploymentSucceeded {
+		return fmt.Errorf("the latest deployment of version %s to %s %s", version, env, last.Status)
+	}
+
+	st, err := sm.LoadState(env)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	unhealthy, err := UnhealthyResources(st)
+	if err != nil {
+		return err
+	}
+	if len(unhealthy) > 0 {
+		var details []string
+		for _, name := range sortedNames(unhealthy) {
+			details = append(details, fmt.Sprintf("%s (%s)", name, unhealthy[name]))
+		}
+		return fmt.Errorf("environment %s is not healthy: %s", env, strings.Join(details, ", "))
+	}
+	return nil
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/yahao333/gort/internal/config"
 	"github.com/yahao333/gort/internal/logging"
 	"github.com/yahao333/gort/internal/state"
 )
@@ -28,7 +29,7 @@ const (
 
 type ResourceManager struct {
 	stateManager *state.StateManager
-	logger       *logging.Logger
+	logger       logging.Log
 }
 
 type ResourceSpec struct {
@@ -37,6 +38,12 @@ type ResourceSpec struct {
 	Provider     string                 `json:"provider"`
 	Properties   map[string]interface{} `json:"properties"`
 	Dependencies []string               `json:"dependencies"`
+	// Ready and Timeout control how long applying the resource waits for
+	// it, see config.Resource
+	Ready   *config.ReadyCondition `json:"ready,omitempty"`
+	Timeout string                 `json:"timeout,omitempty"`
+	// Retry is the retry policy of the resource and its provider
+	Retry *config.RetryPolicy `json:"retry,omitempty"`
 }
 
 type ResourceStatus struct {
@@ -45,7 +52,7 @@ type ResourceStatus struct {
 	LastUpdated time.Time     `json:"last_updated"`
 }
 
-func NewResourceManager(stateManager *state.StateManager, logger *logging.Logger) *ResourceManager {
+func NewResourceManager(stateManager *state.StateManager, logger logging.Log) *ResourceManager {
 	return &ResourceManager{
 		stateManager: stateManager,
 		logger:       logger,
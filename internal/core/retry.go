@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+const (
+	// DefaultMaxAttempts is the number of calls made for errors the
+	// provider marks as retryable, when no retry policy sets it
+	DefaultMaxAttempts   = 3
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = 30 * time.Second
+)
+
+// retryPolicy is a parsed config.RetryPolicy with defaults filled in
+type retryPolicy struct {
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	retryOn      []*regexp.Regexp
+}
+
+// newRetryPolicy parses a policy; invalid settings were reported when the
+// configuration was validated and fall back to the defaults
+func newRetryPolicy(cfg *config.RetryPolicy) retryPolicy {
+	p := retryPolicy{
+		maxAttempts:  DefaultMaxAttempts,
+		initialDelay: defaultRetryDelay,
+		maxDelay:     defaultMaxRetryDelay,
+	}
+	if cfg == nil {
+		return p
+	}
+
+	if cfg.MaxAttempts > 0 {
+		p.maxAttempts = cfg.MaxAttempts
+	}
+	if d, err := time.ParseDuration(cfg.InitialDelay); err == nil && d > 0 {
+		p.initialDelay = d
+	}
+	if d, err := time.ParseDuration(cfg.MaxDelay); err == nil && d > 0 {
+		p.maxDelay = d
+	}
+	for _, pattern := range cfg.RetryOn {
+		if re, err := regexp.Compile(pattern); err == nil {
+			p.retryOn = append(p.retryOn, re)
+		}
+	}
+	return p
+}
+
+// retryable reports whether a failed call may be retried: the provider
+// marked the error as retryable, or it matches a retry pattern and was not
+// marked as permanent
+func (p retryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || plugin.IsPermanent(err) {
+		return false
+	}
+	if plugin.IsRetryable(err) {
+		return true
+	}
+	for _, re := range p.retryOn {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay is the backoff before the given retry, counting from 1. Half of it
+// is random so that resources failing together do not retry together.
+func (p retryPolicy) delay(retry int, err error) time.Duration {
+	d := p.initialDelay
+	for i := 1; i < retry && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+	if after := plugin.RetryAfter(err); after > d {
+		d = after
+	}
+	return d
+}
+
+// retry calls a provider until it succeeds, fails with an error that is not
+// retryable, runs out of attempts or ctx ends
+func (d *Deployer) retry(ctx context.Context, spec ResourceSpec, action string, start time.Time, call func() error) error {
+	policy := newRetryPolicy(spec.Retry)
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= policy.maxAttempts || !policy.retryable(err) {
+			return err
+		}
+
+		delay := policy.delay(attempt, err)
+		d.logger.WithField("resource", spec.Name).Warnf("Failed %s resource %s, retrying in %s (attempt %d of %d): %v",
+			progressVerbs[action], spec.Name, delay.Round(time.Millisecond), attempt+1, policy.maxAttempts, err)
+		d.progress(spec.Name, action, start, fmt.Sprintf("retrying in %s: %v", delay.Round(time.Millisecond), err), false, nil)
+		d.countRetry(spec.Name)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// countRetry records a retry of a resource for the DeploymentResult
+func (d *Deployer) countRetry(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.retries == nil {
+		d.retries = make(map[string]int)
+	}
+	d.retries[name]++
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/logging"
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/state"
+)
+
+// scriptedProvider is an async provider whose calls fail as scripted
+type scriptedProvider struct {
+	mu sync.Mutex
+	// startFailures and pollFailures fail that many calls of StartCreate
+	// and PollOperation with a retryable error
+	startFailures int
+	pollFailures  int
+	// failOperations completes that many operations as failed and
+	// retryable
+	failOperations int
+	starts         int
+}
+
+var scripted = &scriptedProvider{}
+
+func init() {
+	plugin.Register("test-scripted", plugin.PluginMetadata{
+		Version:    "1.0.0",
+		Interfaces: []string{plugin.InterfaceProvider, plugin.InterfaceAsync},
+	}, func() plugin.Plugin { return scripted })
+}
+
+func (p *scriptedProvider) Init(config map[string]interface{}) error { return nil }
+func (p *scriptedProvider) Name() string                             { return "test-scripted" }
+func (p *scriptedProvider) Version() string                          { return "1.0.0" }
+func (p *scriptedProvider) Shutdown(ctx context.Context) error       { return nil }
+
+func (p *scriptedProvider) CreateResource(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	return nil, errors.New("not used")
+}
+func (p *scriptedProvider) UpdateResource(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	return nil, errors.New("not used")
+}
+func (p *scriptedProvider) DeleteResource(ctx context.Context, id string) error {
+	return errors.New("not used")
+}
+func (p *scriptedProvider) GetResource(ctx context.Context, id string) (*plugin.Resource, error) {
+	return nil, errors.New("not used")
+}
+
+func (p *scriptedProvider) StartCreate(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.starts++
+	if p.startFailures > 0 {
+		p.startFailures--
+		return nil, plugin.Retryable(errors.New("throttled"))
+	}
+	return &plugin.Operation{ID: fmt.Sprintf("op-%d", p.starts), ResourceID: "res/" + spec.Name}, nil
+}
+func (p *scriptedProvider) StartUpdate(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	return nil, errors.New("not used")
+}
+func (p *scriptedProvider) StartDelete(ctx context.Context, id string) (*plugin.Operation, error) {
+	return nil, errors.New("not used")
+}
+
+func (p *scriptedProvider) PollOperation(ctx context.Context, op plugin.Operation) (*plugin.OperationStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pollFailures > 0 {
+		p.pollFailures--
+		return nil, plugin.Retryable(errors.New("connection reset"))
+	}
+	if p.failOperations > 0 {
+		p.failOperations--
+		return &plugin.OperationStatus{Done: true, Error: "capacity", Retryable: true}, nil
+	}
+	return &plugin.OperationStatus{Done: true, Resource: &plugin.Resource{ID: op.ResourceID}}, nil
+}
+
+func (p *scriptedProvider) reset(startFailures, pollFailures, failOperations int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.startFailures, p.pollFailures, p.failOperations = startFailures, pollFailures, failOperations
+	p.starts = 0
+}
+
+func newTestDeployer(t *testing.T) (*Deployer, *logging.TestLogger) {
+	t.Helper()
+	logger := logging.NewTestLogger()
+	pm := plugin.NewPluginManager(t.TempDir(), logger)
+	if err := pm.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return NewDeployer(state.NewStateManager(t.TempDir()), pm, logger, DeployerOptions{}), logger
+}
+
+func TestCreateRetries(t *testing.T) {
+	policy := &config.RetryPolicy{MaxAttempts: 3, InitialDelay: "1ms", MaxDelay: "1ms"}
+	tests := []struct {
+		name                                        string
+		startFailures, pollFailures, failOperations int
+		wantErr                                     string
+		wantStarts, wantRetries                     int
+	}{
+		{name: "start retried", startFailures: 2, wantStarts: 3, wantRetries: 2},
+		{name: "start fails", startFailures: 3, wantErr: "throttled", wantStarts: 3, wantRetries: 2},
+		// A failed poll does not start the operation again
+		{name: "poll retried", pollFailures: 2, wantStarts: 1, wantRetries: 2},
+		{name: "poll fails", pollFailures: 3, wantErr: "failed to poll operation op-1", wantStarts: 1, wantRetries: 2},
+		{name: "retryable operation started again", failOperations: 1, wantStarts: 2, wantRetries: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripted.reset(tt.startFailures, tt.pollFailures, tt.failOperations)
+			d, logger := newTestDeployer(t)
+			spec := ResourceSpec{Name: "db", Type: "database", Provider: "test-scripted", Retry: policy}
+
+			res, err := d.create(context.Background(), spec)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("create error = %v, want %q", err, tt.wantErr)
+			}
+			if err == nil && res.ID != "res/db" {
+				t.Errorf("resource ID = %s, want res/db", res.ID)
+			}
+			if scripted.starts != tt.wantStarts {
+				t.Errorf("operation started %d times, want %d", scripted.starts, tt.wantStarts)
+			}
+			if d.retries["db"] != tt.wantRetries {
+				t.Errorf("%d retries counted, want %d", d.retries["db"], tt.wantRetries)
+			}
+			if tt.wantRetries > 0 && !logger.Contains("warning", "retrying") {
+				t.Error("retries were not logged")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// providerSchemas holds the resource schemas of the providers in a plan by
+// plugin name. Resources of providers without a schema are compared
+// structurally.
+type providerSchemas map[string]*plugin.Schema
+
+// schemas looks up the schemas of the providers of the desired and current
+// resources. A provider whose schema cannot be read is planned without one.
+func (d *Deployer) schemas(ctx context.Context, desired map[string]ResourceSpec, current map[string]*ResourceRecord) providerSchemas {
+	schemas := make(providerSchemas)
+	if d.pluginManager == nil {
+		return schemas
+	}
+
+	names := make(map[string]bool)
+	for _, spec := range desired {
+		names[spec.Provider] = true
+	}
+	for _, rec := range current {
+		names[rec.Provider] = true
+	}
+	for name := range names {
+		schema, err := d.pluginManager.Schema(ctx, name)
+		if err != nil {
+			d.logger.Warnf("Planning resources of provider %s without a schema: %v", name, err)
+			continue
+		}
+		if schema == nil {
+			d.logger.Debugf("Provider %s has no schema, its resources are compared structurally", name)
+			continue
+		}
+		schemas[name] = schema
+	}
+	return schemas
+}
+
+func (s providerSchemas) resource(spec ResourceSpec) (plugin.ResourceSchema, bool) {
+	schema, ok := s[spec.Provider]
+	if !ok {
+		return plugin.ResourceSchema{}, false
+	}
+	return schema.Resource(string(spec.Type))
+}
+
+// apply validates the desired resources against their schemas and fills in
+// default properties
+func (s providerSchemas) apply(desired map[string]ResourceSpec) error {
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		spec := desired[name]
+		schema, ok := s[spec.Provider]
+		if !ok {
+			continue
+		}
+		for _, e := range schema.Validate(string(spec.Type), spec.Properties) {
+			problems = append(problems, fmt.Sprintf("resource %s: %v", name, e))
+		}
+
+		spec, err := s.withDefaults(spec)
+		if err != nil {
+			return fmt.Errorf("invalid properties for resource %s: %w", name, err)
+		}
+		desired[name] = spec
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid resource properties:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// withDefaults fills in the default properties of a spec, so resources
+// deployed before a default was added do not show a change
+func (s providerSchemas) withDefaults(spec ResourceSpec) (ResourceSpec, error) {
+	rs, ok := s.resource(spec)
+	if !ok {
+		return spec, nil
+	}
+	props, err := normalize(rs.ApplyDefaults(spec.Properties))
+	if err != nil {
+		return spec, err
+	}
+	spec.Properties = props
+	return spec, nil
+}
+
+// sensitive returns the attributes of a resource whose values are hidden
+func (s providerSchemas) sensitive(spec ResourceSpec) []string {
+	if rs, ok := s.resource(spec); ok {
+		return rs.Sensitive()
+	}
+	return nil
+}
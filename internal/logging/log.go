@@ -0,0 +1,36 @@
+package logging
+
+import "github.com/sirupsen/logrus"
+
+// Log is the logging interface accepted by every subsystem. *Logger writes
+// entries out, Discard drops them and TestLogger captures them.
+type Log interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// WithField returns a Log adding a field to every entry
+	WithField(key string, value interface{}) Log
+}
+
+// Discard is a Log that drops every entry, for libraries used without a
+// logger
+var Discard Log = discard{}
+
+type discard struct{}
+
+func (discard) Debugf(format string, args ...interface{}) {}
+func (discard) Infof(format string, args ...interface{})  {}
+func (discard) Warnf(format string, args ...interface{})  {}
+func (discard) Errorf(format string, args ...interface{}) {}
+
+func (d discard) WithField(key string, value interface{}) Log { return d }
+
+// entry is a Log adding fields to the entries of a Logger
+type entry struct {
+	*logrus.Entry
+}
+
+func (e entry) WithField(key string, value interface{}) Log {
+	return entry{e.Entry.WithField(key, value)}
+}
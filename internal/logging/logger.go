@@ -1,40 +1,150 @@
 package logging
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configures a Logger
+type Options struct {
+	// Format is FormatText, the default, or FormatJSON
+	Format string
+	// Level is debug, info, the default, warn or error
+	Level string
+	// Output defaults to stderr, so logs do not mix with command output
+	Output io.Writer
+	// RunID is added to every entry to correlate the logs of a run
+	RunID string
+}
+
 type Logger struct {
 	*logrus.Logger
+	masker *maskingFormatter
+	fields *fieldHook
+	runID  string
 }
 
-func NewLogger(debug bool) *Logger {
+// New creates a logger from options
+func New(opts Options) (*Logger, error) {
 	log := logrus.New()
-	log.SetOutput(os.Stdout)
+	log.SetOutput(os.Stderr)
+	if opts.Output != nil {
+		log.SetOutput(opts.Output)
+	}
 
-	if debug {
-		log.SetLevel(logrus.DebugLevel)
-		log.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp: true,
-			PadLevelText:  true,
-		})
-	} else {
-		log.SetLevel(logrus.InfoLevel)
+	level := logrus.InfoLevel
+	if opts.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(opts.Level); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", opts.Level)
+		}
+	}
+	log.SetLevel(level)
+
+	switch opts.Format {
+	case FormatText, "":
 		log.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp: false,
+			FullTimestamp: level >= logrus.DebugLevel,
 			PadLevelText:  true,
 		})
+	case FormatJSON:
+		log.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return nil, fmt.Errorf("invalid log format %q (supported: %s, %s)", opts.Format, FormatText, FormatJSON)
+	}
+
+	masker := &maskingFormatter{Formatter: log.Formatter}
+	log.SetFormatter(masker)
+
+	fields := &fieldHook{fields: logrus.Fields{}}
+	if opts.RunID != "" {
+		fields.fields["run_id"] = opts.RunID
+	}
+	log.AddHook(fields)
+
+	return &Logger{Logger: log, masker: masker, fields: fields, runID: opts.RunID}, nil
+}
+
+// NewLogger creates a text logger writing to stderr, logging debug entries
+// when debug is set
+func NewLogger(debug bool) *Logger {
+	opts := Options{Level: "info"}
+	if debug {
+		opts.Level = "debug"
+	}
+	logger, _ := New(opts)
+	return logger
+}
+
+// NewRunID returns a random ID correlating the logs of a run
+func NewRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
 	}
+	return hex.EncodeToString(b)
+}
+
+// RunID returns the ID added to every entry, if any
+func (l *Logger) RunID() string {
+	return l.runID
+}
+
+// Mask registers secret values that must never appear in log output
+func (l *Logger) Mask(values ...string) {
+	l.masker.add(values...)
+}
 
-	return &Logger{log}
+// SetField adds a field to every entry logged from now on, such as the
+// environment a command works on
+func (l *Logger) SetField(key string, value interface{}) {
+	l.fields.set(key, value)
 }
 
-func (l *Logger) WithField(key string, value interface{}) *logrus.Entry {
-	return l.Logger.WithField(key, value)
+func (l *Logger) WithField(key string, value interface{}) Log {
+	return entry{l.Logger.WithField(key, value)}
 }
 
 func (l *Logger) WithError(err error) *logrus.Entry {
 	return l.Logger.WithError(err)
 }
+
+// fieldHook adds the fields set with SetField to every entry
+type fieldHook struct {
+	mu     sync.RWMutex
+	fields logrus.Fields
+}
+
+func (h *fieldHook) set(key string, value interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fields[key] = value
+}
+
+func (h *fieldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fieldHook) Fire(entry *logrus.Entry) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for k, v := range h.fields {
+		// Fields of the entry itself take precedence
+		if _, set := entry.Data[k]; !set {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTestLoggerCapturesEntries(t *testing.T) {
+	logger := NewTestLogger()
+	var log Log = logger
+
+	log.Infof("deploying %s", "dev")
+	scoped := log.WithField("environment", "dev").WithField("resource", "db")
+	scoped.Warnf("retrying %s", "db")
+	scoped.Errorf("failed")
+
+	entries := logger.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("captured %d entries, want 3: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Level != "info" || e.Message != "deploying dev" || len(e.Fields) != 0 {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Level != "warning" || e.Fields["environment"] != "dev" || e.Fields["resource"] != "db" {
+		t.Errorf("entry logged with fields = %+v", e)
+	}
+
+	if !logger.Contains("warning", "retrying db") || !logger.Contains("", "failed") {
+		t.Error("Contains did not find logged entries")
+	}
+	if logger.Contains("error", "retrying") {
+		t.Error("Contains matched an entry of another level")
+	}
+
+	logger.Reset()
+	if n := len(logger.Entries()); n != 0 {
+		t.Errorf("%d entries after Reset", n)
+	}
+}
+
+func TestLoggerMasksSecrets(t *testing.T) {
+	for _, format := range []string{FormatText, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := New(Options{Format: format, Output: &out, RunID: "run-1"})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			logger.Mask("hunter2", "p\"ss")
+			logger.SetField("environment", "prod")
+
+			logger.WithField("token", Secret("abc")).Infof("connecting with hunter2 and p\"ss")
+
+			text := out.String()
+			for _, secret := range []string{"hunter2", "p\\\"ss", "abc"} {
+				if strings.Contains(text, secret) {
+					t.Errorf("output reveals %q: %s", secret, text)
+				}
+			}
+			for _, want := range []string{Masked, "run-1", "prod"} {
+				if !strings.Contains(text, want) {
+					t.Errorf("output lacks %q: %s", want, text)
+				}
+			}
+			if format == FormatJSON {
+				var fields map[string]interface{}
+				if err := json.Unmarshal(out.Bytes(), &fields); err != nil {
+					t.Errorf("masked JSON output is invalid: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerMaskKeepsNamesAndShortValues(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(Options{Format: FormatJSON, Output: &out, RunID: "run-2026"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// "20" and "2026" occur in the run ID and the timestamp, "environment" is
+	// also a field name
+	logger.Mask("20", "2026", "environment")
+
+	logger.WithField("port", "20").WithField("environment", "dev").Infof("deploying 20 environments")
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &fields); err != nil {
+		t.Fatalf("masked JSON output is invalid: %v", err)
+	}
+	want := map[string]interface{}{
+		"port":        Masked,
+		"environment": "dev",
+		"msg":         "deploying 20 " + Masked + "s",
+		"run_id":      "run-2026",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %v, want %v", k, fields[k], v)
+		}
+	}
+	if ts, _ := fields["time"].(string); !strings.Contains(ts, "20") {
+		t.Errorf("time = %q, want it unmasked", ts)
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	if _, err := New(Options{Level: "loud"}); err == nil {
+		t.Error("New accepted an invalid level")
+	}
+	if _, err := New(Options{Format: "xml"}); err == nil {
+		t.Error("New accepted an invalid format")
+	}
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Masked replaces secret values in log output
+const Masked = "******"
+
+// Secret is a field value that is always logged as Masked, for example
+// logger.WithField("token", logging.Secret(token))
+type Secret string
+
+func (Secret) String() string { return Masked }
+
+func (Secret) MarshalText() ([]byte, error) { return []byte(Masked), nil }
+
+// minMaskLength is the length below which a secret is only masked where it
+// is a whole field value: a short secret is likely to occur by chance in
+// messages and would be masked in unrelated words.
+const minMaskLength = 4
+
+// maskingFormatter wraps a formatter and replaces registered secret values
+// in the message and field values of entries, including errors. Field
+// names, timestamps and levels are never rewritten.
+type maskingFormatter struct {
+	logrus.Formatter
+	mu     sync.RWMutex
+	values []string
+}
+
+func (f *maskingFormatter) add(values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			f.values = append(f.values, v)
+		}
+	}
+	// Replace longer values first so a secret containing another one is
+	// not partially revealed.
+	sort.Slice(f.values, func(i, j int) bool {
+		return len(f.values[i]) > len(f.values[j])
+	})
+}
+
+func (f *maskingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.values) == 0 {
+		return f.Formatter.Format(entry)
+	}
+
+	masked := *entry
+	masked.Message = f.mask(entry.Message)
+	masked.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		// The run ID is generated and never holds a secret
+		if k == "run_id" {
+			masked.Data[k] = v
+			continue
+		}
+		switch t := v.(type) {
+		case string:
+			masked.Data[k] = f.mask(t)
+		case error:
+			if s := f.mask(t.Error()); s != t.Error() {
+				masked.Data[k] = s
+			} else {
+				masked.Data[k] = v
+			}
+		default:
+			masked.Data[k] = v
+		}
+	}
+	return f.Formatter.Format(&masked)
+}
+
+// mask replaces the secrets in s. The caller holds f.mu.
+func (f *maskingFormatter) mask(s string) string {
+	for _, v := range f.values {
+		if s == v {
+			return Masked
+		}
+		if len(v) >= minMaskLength {
+			s = strings.ReplaceAll(s, v, Masked)
+		}
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Entry is a log entry captured by a TestLogger
+type Entry struct {
+	Level   string
+	Message string
+	Fields  map[string]interface{}
+}
+
+// TestLogger is a Log that captures entries so tests can assert on them
+type TestLogger struct {
+	fields map[string]interface{}
+	// log is shared with the loggers returned by WithField
+	log *capture
+}
+
+type capture struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewTestLogger returns a TestLogger without entries
+func NewTestLogger() *TestLogger {
+	return &TestLogger{log: &capture{}}
+}
+
+func (t *TestLogger) Debugf(format string, args ...interface{}) { t.add("debug", format, args) }
+func (t *TestLogger) Infof(format string, args ...interface{})  { t.add("info", format, args) }
+func (t *TestLogger) Warnf(format string, args ...interface{})  { t.add("warning", format, args) }
+func (t *TestLogger) Errorf(format string, args ...interface{}) { t.add("error", format, args) }
+
+func (t *TestLogger) WithField(key string, value interface{}) Log {
+	fields := make(map[string]interface{}, len(t.fields)+1)
+	for k, v := range t.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &TestLogger{fields: fields, log: t.log}
+}
+
+// Entries returns the captured entries, oldest first
+func (t *TestLogger) Entries() []Entry {
+	t.log.mu.Lock()
+	defer t.log.mu.Unlock()
+	return append([]Entry(nil), t.log.entries...)
+}
+
+// Contains reports whether an entry of the level contains text, any level
+// when level is empty
+func (t *TestLogger) Contains(level, text string) bool {
+	for _, e := range t.Entries() {
+		if (level == "" || e.Level == level) && strings.Contains(e.Message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset drops the captured entries
+func (t *TestLogger) Reset() {
+	t.log.mu.Lock()
+	defer t.log.mu.Unlock()
+	t.log.entries = nil
+}
+
+func (t *TestLogger) add(level, format string, args []interface{}) {
+	t.log.mu.Lock()
+	defer t.log.mu.Unlock()
+	t.log.entries = append(t.log.entries, Entry{
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+		Fields:  t.fields,
+	})
+}
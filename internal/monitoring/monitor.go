@@ -1,66 +1,83 @@
 package monitoring
 
 import (
-    "sync"
-    "time"
+	"sync"
+	"time"
+
+	"github.com/yahao333/gort/internal/logging"
 )
 
 type ResourceMetric struct {
-    Name      string
-    Type      string
-    Status    string
-    Timestamp time.Time
-    Metrics   map[string]float64
+	Name      string
+	Type      string
+	Status    string
+	Timestamp time.Time
+	Metrics   map[string]float64
 }
 
 type Monitor struct {
-    metrics map[string]*ResourceMetric
-    mu      sync.RWMutex
-    logger  *Logger
+	metrics map[string]*ResourceMetric
+	mu      sync.RWMutex
+	logger  logging.Log
 }
 
-func NewMonitor(logger *Logger) *Monitor {
-    return &Monitor{
-        metrics: make(map[string]*ResourceMetric),
-        logger:  logger,
-    }
+// NewMonitor creates a monitor; a nil logger discards its logs
+func NewMonitor(logger logging.Log) *Monitor {
+	if logger == nil {
+		logger = logging.Discard
+	}
+	return &Monitor{
+		metrics: make(map[string]*ResourceMetric),
+		logger:  logger,
+	}
 }
 
 func (m *Monitor) RecordMetric(resourceName string, metricType string, value float64) {
-    m.mu.Lock()
-    defer m.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-    metric, exists := m.metrics[resourceName]
-    if !exists {
-        metric = &ResourceMetric{
-            Name:      resourceName,
-            Timestamp: time.Now(),
-            Metrics:   make(map[string]float64),
-        }
-        m.metrics[resourceName] = metric
-    }
+	metric, exists := m.metrics[resourceName]
+	if !exists {
+		metric = &ResourceMetric{
+			Name:      resourceName,
+			Timestamp: time.Now(),
+			Metrics:   make(map[string]float64),
+		}
+		m.metrics[resourceName] = metric
+	}
 
-    metric.Metrics[metricType] = value
-    metric.Timestamp = time.Now()
+	metric.Metrics[metricType] = value
+	metric.Timestamp = time.Now()
 }
 
 func (m *Monitor) GetMetrics(resourceName string) *ResourceMetric {
-    m.mu.RLock()
-    defer m.mu.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-    return m.metrics[resourceName]
+	return m.metrics[resourceName]
 }
 
 func (m *Monitor) StartHealthCheck(interval time.Duration) {
-    go func() {
-        ticker := time.NewTicker(interval)
-        defer ticker.Stop()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 
-        for range ticker.C {
-            m.performHealthCheck()
-        }
-    }()
+		for range ticker.C {
+			m.performHealthCheck()
+		}
+	}()
 }
 
 func (m *Monitor) performHealthCheck() {
-    m.mu.RLock()
\ No newline at end of file
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, metric := range m.metrics {
+		if metric.Status != "" && metric.Status != "healthy" {
+			m.logger.WithField("resource", name).Warnf("Resource %s is %s", name, metric.Status)
+			continue
+		}
+		m.logger.WithField("resource", name).Debugf("Resource %s reported %d metric(s) at %s",
+			name, len(metric.Metrics), metric.Timestamp.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,40 @@
+package output
+
+import "strings"
+
+type Color string
+
+const (
+	ColorNone   Color = ""
+	ColorRed    Color = "\033[31m"
+	ColorGreen  Color = "\033[32m"
+	ColorYellow Color = "\033[33m"
+	ColorCyan   Color = "\033[36m"
+	ColorBold   Color = "\033[1m"
+	colorReset        = "\033[0m"
+)
+
+// Colorize wraps s in the given ANSI colour
+func Colorize(s string, c Color) string {
+	if c == ColorNone || s == "" {
+		return s
+	}
+	return string(c) + s + colorReset
+}
+
+// StatusColor picks a colour for a status or action value
+func StatusColor(status string) Color {
+	switch strings.ToLower(status) {
+	case "ok", "running", "healthy", "ready", "success", "succeeded", "valid", "true",
+		"add", "create", "created", "available", "active":
+		return ColorGreen
+	case "pending", "creating", "updating", "deleting", "in_progress", "update", "updated",
+		"replace", "warning", "advisory":
+		return ColorYellow
+	case "failed", "error", "unhealthy", "invalid", "false", "delete", "deleted",
+		"destroy", "mandatory", "denied":
+		return ColorRed
+	default:
+		return ColorNone
+	}
+}
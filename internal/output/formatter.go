@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"text/tabwriter"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,16 +14,40 @@ const (
 	OutputFormatJSON  OutputFormat = "json"
 	OutputFormatYAML  OutputFormat = "yaml"
 	OutputFormatTable OutputFormat = "table"
+	// OutputFormatMarkdown renders results as Markdown, e.g. for PR comments
+	OutputFormatMarkdown OutputFormat = "markdown"
+	// OutputFormatJUnit and OutputFormatCheckstyle render check results as
+	// XML reports for CI dashboards
+	OutputFormatJUnit      OutputFormat = "junit"
+	OutputFormatCheckstyle OutputFormat = "checkstyle"
 )
 
 type Formatter struct {
 	format OutputFormat
+	table  TableOptions
+}
+
+// ParseFormat validates an output format name
+func ParseFormat(name string) (OutputFormat, error) {
+	switch f := OutputFormat(name); f {
+	case OutputFormatJSON, OutputFormatYAML, OutputFormatTable,
+		OutputFormatMarkdown, OutputFormatJUnit, OutputFormatCheckstyle:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s (expected json, yaml, table, markdown, junit or checkstyle)", name)
+	}
 }
 
 func NewFormatter(format OutputFormat) *Formatter {
 	return &Formatter{format: format}
 }
 
+// SetTableOptions configures column selection, sorting, width and colour
+// for the table format
+func (f *Formatter) SetTableOptions(opts TableOptions) {
+	f.table = opts
+}
+
 func (f *Formatter) Format(data interface{}) error {
 	switch f.format {
 	case OutputFormatJSON:
@@ -33,6 +56,12 @@ func (f *Formatter) Format(data interface{}) error {
 		return f.formatYAML(data)
 	case OutputFormatTable:
 		return f.formatTable(data)
+	case OutputFormatMarkdown:
+		return renderMarkdown(os.Stdout, data, f.table)
+	case OutputFormatJUnit:
+		return renderJUnit(os.Stdout, data)
+	case OutputFormatCheckstyle:
+		return renderCheckstyle(os.Stdout, data)
 	default:
 		return fmt.Errorf("unsupported output format: %s", f.format)
 	}
@@ -50,21 +79,5 @@ func (f *Formatter) formatYAML(data interface{}) error {
 }
 
 func (f *Formatter) formatTable(data interface{}) error {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	defer w.Flush()
-
-	// Handle different types of data
-	switch v := data.(type) {
-	case map[string]interface{}:
-		for k, val := range v {
-			fmt.Fprintf(w, "%s\t%v\n", k, val)
-		}
-	case []interface{}:
-		// Handle slice data
-		// Implementation depends on the structure of your data
-	default:
-		return fmt.Errorf("unsupported data type for table format")
-	}
-
-	return nil
+	return renderTable(os.Stdout, data, f.table)
 }
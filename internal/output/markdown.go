@@ -0,0 +1,63 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Markdowner is implemented by results with a dedicated Markdown rendering,
+// such as a plan summary meant for a pull request comment
+type Markdowner interface {
+	Markdown() string
+}
+
+func renderMarkdown(w io.Writer, data interface{}, opts TableOptions) error {
+	if md, ok := data.(Markdowner); ok {
+		_, err := io.WriteString(w, md.Markdown())
+		return err
+	}
+
+	// Everything else is rendered as a Markdown table
+	if src, ok := data.(TableSource); ok {
+		data = src.TableRows()
+	}
+	t, err := buildTable(data)
+	if err != nil {
+		return err
+	}
+	opts.Wide = true
+	if err := t.selectColumns(opts); err != nil {
+		return err
+	}
+	if err := t.sort(opts.SortBy); err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, MarkdownTable(t.headers(), t.rows))
+	return nil
+}
+
+// MarkdownTable renders a GitHub flavoured Markdown table
+func MarkdownTable(headers []string, rows [][]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(escapeCells(headers), " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(headers)) + "\n")
+	for _, row := range rows {
+		b.WriteString("| " + strings.Join(escapeCells(row), " | ") + " |\n")
+	}
+	return b.String()
+}
+
+func escapeCells(cells []string) []string {
+	out := make([]string, len(cells))
+	for i, c := range cells {
+		c = strings.ReplaceAll(c, "|", "\\|")
+		out[i] = strings.ReplaceAll(c, "\n", "<br>")
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testSummary struct{}
+
+func (testSummary) Markdown() string { return "### Plan for `prod`\n\n1 to add\n" }
+
+type testRows struct{ rows []testResource }
+
+func (r testRows) TableRows() interface{} { return r.rows }
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		opts TableOptions
+	}{
+		// Markdown tables are always wide, and cells are escaped
+		{name: "markdown", data: []map[string]string{
+			{"name": "web", "command": "a | b"},
+			{"name": "db", "command": "line 1\nline 2"},
+		}},
+		{name: "markdown_columns", data: testRows{testResources}, opts: TableOptions{Columns: []string{"name", "id"}, SortBy: "-name"}},
+		{name: "markdown_summary", data: testSummary{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := renderMarkdown(&out, tt.data, tt.opts); err != nil {
+				t.Fatalf("renderMarkdown: %v", err)
+			}
+			assertGolden(t, tt.name, out.Bytes())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressHeartbeat is how often an unchanged status is printed again
+const progressHeartbeat = 10 * time.Second
+
+// Progress prints the status of concurrent tasks as they report it. A
+// status is printed when it changes, and repeated while a task keeps
+// waiting so long operations visibly make progress.
+type Progress struct {
+	w     io.Writer
+	color bool
+
+	mu   sync.Mutex
+	last map[string]printedStatus
+}
+
+type printedStatus struct {
+	status string
+	at     time.Time
+}
+
+// NewProgress returns a Progress printing to w
+func NewProgress(w io.Writer, color bool) *Progress {
+	return &Progress{w: w, color: color, last: make(map[string]printedStatus)}
+}
+
+// Update reports the current status of a task
+func (p *Progress) Update(task, status string, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last, printed := p.last[task]
+	if printed && last.status == status && time.Since(last.at) < progressHeartbeat {
+		return
+	}
+	p.last[task] = printedStatus{status: status, at: time.Now()}
+	p.print(task, status, elapsed, ColorYellow)
+}
+
+// Done reports the final status of a task
+func (p *Progress) Done(task, status string, elapsed time.Duration, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.last, task)
+	c := ColorGreen
+	if failed {
+		c = ColorRed
+	}
+	p.print(task, status, elapsed, c)
+}
+
+func (p *Progress) print(task, status string, elapsed time.Duration, c Color) {
+	if p.color {
+		task = Colorize(task, ColorBold)
+		status = Colorize(status, c)
+	}
+	fmt.Fprintf(p.w, "%s: %s [%s]\n", task, status, elapsed.Round(time.Second))
+}
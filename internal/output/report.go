@@ -0,0 +1,200 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Finding is a single result of a check, such as a validation error
+type Finding struct {
+	// Check names the check, used as the test case name in JUnit reports
+	Check    string
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+// Reporter is implemented by results that can be rendered as JUnit or
+// checkstyle reports for CI dashboards
+type Reporter interface {
+	// ReportName names the suite of checks
+	ReportName() string
+	// Checks lists every check that ran, so passing ones are reported too
+	Checks() []string
+	Findings() []Finding
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	File      string         `xml:"file,attr,omitempty"`
+	Line      int            `xml:"line,attr,omitempty"`
+	Failures  []junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func renderJUnit(w io.Writer, data interface{}) error {
+	r, ok := data.(Reporter)
+	if !ok {
+		return fmt.Errorf("output format %s is not supported for this command", OutputFormatJUnit)
+	}
+
+	// Every finding is a failed test case, and checks without findings
+	// are reported as passed
+	failed := make(map[string]bool)
+	checks := append([]string(nil), r.Checks()...)
+	for _, f := range r.Findings() {
+		if !failed[f.Check] && !contains(checks, f.Check) {
+			checks = append(checks, f.Check)
+		}
+		failed[f.Check] = true
+	}
+	sort.Strings(checks)
+
+	suite := junitTestSuite{Name: r.ReportName()}
+	for _, check := range checks {
+		if !failed[check] {
+			suite.Cases = append(suite.Cases, junitTestCase{Name: check, ClassName: r.ReportName()})
+		}
+	}
+	for _, f := range r.Findings() {
+		name := f.Check
+		if f.File != "" {
+			name = f.Check + " " + strings.TrimSuffix(location(f), ": ")
+		}
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      name,
+			ClassName: r.ReportName(),
+			File:      f.File,
+			Line:      f.Line,
+			Failures: []junitFailure{{
+				Message: f.Message,
+				Type:    severity(f),
+				Text:    location(f) + f.Message,
+			}},
+		})
+		suite.Failures++
+	}
+	suite.Tests = len(suite.Cases)
+
+	doc := junitTestSuites{
+		Name:     r.ReportName(),
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}
+	return writeXML(w, doc)
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+func renderCheckstyle(w io.Writer, data interface{}) error {
+	r, ok := data.(Reporter)
+	if !ok {
+		return fmt.Errorf("output format %s is not supported for this command", OutputFormatCheckstyle)
+	}
+
+	byFile := make(map[string][]checkstyleError)
+	var files []string
+	for _, f := range r.Findings() {
+		if _, seen := byFile[f.File]; !seen {
+			files = append(files, f.File)
+		}
+		byFile[f.File] = append(byFile[f.File], checkstyleError{
+			Line:     f.Line,
+			Column:   f.Column,
+			Severity: severity(f),
+			Message:  f.Message,
+			Source:   "gort." + f.Check,
+		})
+	}
+	sort.Strings(files)
+
+	doc := checkstyleReport{Version: "4.3"}
+	for _, file := range files {
+		doc.Files = append(doc.Files, checkstyleFile{Name: file, Errors: byFile[file]})
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// severity defaults findings without one to errors
+func severity(f Finding) string {
+	if f.Severity == "" {
+		return "error"
+	}
+	return f.Severity
+}
+
+func location(f Finding) string {
+	switch {
+	case f.File == "":
+		return ""
+	case f.Line == 0:
+		return f.File + ": "
+	}
+	return fmt.Sprintf("%s:%d:%d: ", f.File, f.Line, f.Column)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
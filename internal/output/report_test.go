@@ -0,0 +1,57 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testReport struct {
+	checks   []string
+	findings []Finding
+}
+
+func (r testReport) ReportName() string  { return "gort validate" }
+func (r testReport) Checks() []string    { return r.checks }
+func (r testReport) Findings() []Finding { return r.findings }
+
+var reportWithFindings = testReport{
+	checks: []string{"schema", "references", "policies"},
+	findings: []Finding{
+		{Check: "schema", File: "gort.yaml", Line: 12, Column: 5, Severity: "error", Message: `unknown field "replica"`},
+		{Check: "references", File: "envs/prod.yaml", Line: 3, Column: 14, Severity: "error", Message: `undefined variable "region" & <more>`},
+		{Check: "references", File: "gort.yaml", Line: 20, Column: 9, Message: "undefined output shared.url"},
+		// Findings of checks that were not listed are reported too
+		{Check: "provider", Severity: "warning", Message: "provider cloud is not installed"},
+	},
+}
+
+func TestRenderReports(t *testing.T) {
+	tests := []struct {
+		name   string
+		render func(*bytes.Buffer, interface{}) error
+		report testReport
+	}{
+		{name: "junit", report: reportWithFindings, render: func(w *bytes.Buffer, data interface{}) error { return renderJUnit(w, data) }},
+		{name: "junit_passed", report: testReport{checks: []string{"schema", "references"}}, render: func(w *bytes.Buffer, data interface{}) error { return renderJUnit(w, data) }},
+		{name: "checkstyle", report: reportWithFindings, render: func(w *bytes.Buffer, data interface{}) error { return renderCheckstyle(w, data) }},
+		{name: "checkstyle_passed", report: testReport{checks: []string{"schema", "references"}}, render: func(w *bytes.Buffer, data interface{}) error { return renderCheckstyle(w, data) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tt.render(&out, tt.report); err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			assertGolden(t, tt.name, out.Bytes())
+		})
+	}
+}
+
+func TestRenderReportsRequireReporter(t *testing.T) {
+	if err := renderJUnit(&bytes.Buffer{}, testResources); err == nil || err.Error() != "output format junit is not supported for this command" {
+		t.Errorf("renderJUnit error = %v", err)
+	}
+	if err := renderCheckstyle(&bytes.Buffer{}, testResources); err == nil || err.Error() != "output format checkstyle is not supported for this command" {
+		t.Errorf("renderCheckstyle error = %v", err)
+	}
+}
@@ -0,0 +1,461 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TableOptions controls table rendering
+type TableOptions struct {
+	// Columns selects and orders columns by header name
+	Columns []string
+	// SortBy sorts rows by a column; prefix with "-" for descending order
+	SortBy string
+	// Wide shows columns tagged wide and disables cell truncation
+	Wide bool
+	// Color highlights status columns with ANSI colours
+	Color bool
+}
+
+// TableSource lets a result choose what is shown as a table, for example
+// the rows of a report rather than its envelope, while JSON and YAML still
+// encode the result itself.
+type TableSource interface {
+	TableRows() interface{}
+}
+
+// Struct fields are turned into columns. The header defaults to the json
+// tag name in upper case and can be customized with a table tag:
+//
+//	Name   string `table:"NAME"`
+//	ID     string `table:",wide"`          only shown with --wide
+//	Status string `table:"STATUS,status"`  coloured by value
+//	Secret string `table:"-"`              never shown
+
+// narrowWidth is the maximum width of a cell unless wide mode is enabled
+const narrowWidth = 48
+
+type column struct {
+	header string
+	index  []int
+	key    string
+	wide   bool
+	status bool
+}
+
+type table struct {
+	columns []column
+	rows    [][]string
+}
+
+func renderTable(w io.Writer, data interface{}, opts TableOptions) error {
+	if src, ok := data.(TableSource); ok {
+		data = src.TableRows()
+	}
+
+	t, err := buildTable(data)
+	if err != nil {
+		return err
+	}
+
+	if err := t.selectColumns(opts); err != nil {
+		return err
+	}
+	if err := t.sort(opts.SortBy); err != nil {
+		return err
+	}
+
+	t.write(w, opts)
+	return nil
+}
+
+func buildTable(data interface{}) (*table, error) {
+	v := indirect(reflect.ValueOf(data))
+	if !v.IsValid() {
+		return &table{}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return sliceTable(v)
+	case reflect.Struct:
+		return keyValueTable(structColumns(v.Type()), func(c column) reflect.Value {
+			return v.FieldByIndex(c.index)
+		}), nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported data type for table format: %s", v.Type())
+		}
+		entries := mapEntries(v)
+		cols := make([]column, len(entries))
+		for i, e := range entries {
+			cols[i] = column{header: e.key, key: e.key}
+		}
+		return keyValueTable(cols, func(c column) reflect.Value {
+			return v.MapIndex(reflect.ValueOf(c.key).Convert(v.Type().Key()))
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported data type for table format: %s", v.Type())
+	}
+}
+
+// sliceTable renders one row per element, with columns taken from the
+// struct fields or the union of map keys of the elements
+func sliceTable(v reflect.Value) (*table, error) {
+	t := &table{}
+	elems := make([]reflect.Value, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if e := indirect(v.Index(i)); e.IsValid() {
+			elems = append(elems, e)
+		}
+	}
+	if len(elems) == 0 {
+		return t, nil
+	}
+
+	switch elems[0].Kind() {
+	case reflect.Struct:
+		t.columns = structColumns(elems[0].Type())
+		for _, e := range elems {
+			if e.Type() != elems[0].Type() {
+				return nil, fmt.Errorf("unsupported data type for table format: mixed element types")
+			}
+			row := make([]string, len(t.columns))
+			for i, c := range t.columns {
+				row[i] = formatCell(e.FieldByIndex(c.index))
+			}
+			t.rows = append(t.rows, row)
+		}
+	case reflect.Map:
+		seen := make(map[string]bool)
+		var keys []string
+		for _, e := range elems {
+			if e.Kind() != reflect.Map {
+				return nil, fmt.Errorf("unsupported data type for table format: mixed element types")
+			}
+			if e.Type().Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("unsupported data type for table format: %s", e.Type())
+			}
+			for _, entry := range mapEntries(e) {
+				if !seen[entry.key] {
+					seen[entry.key] = true
+					keys = append(keys, entry.key)
+				}
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			t.columns = append(t.columns, column{header: strings.ToUpper(k), key: k})
+		}
+		for _, e := range elems {
+			row := make([]string, len(t.columns))
+			for i, c := range t.columns {
+				row[i] = formatCell(e.MapIndex(reflect.ValueOf(c.key).Convert(e.Type().Key())))
+			}
+			t.rows = append(t.rows, row)
+		}
+	default:
+		t.columns = []column{{header: "VALUE"}}
+		for _, e := range elems {
+			t.rows = append(t.rows, []string{formatCell(e)})
+		}
+	}
+
+	return t, nil
+}
+
+// keyValueTable renders a single value vertically, one row per column
+func keyValueTable(cols []column, get func(column) reflect.Value) *table {
+	t := &table{
+		columns: []column{{header: "KEY"}, {header: "VALUE"}},
+	}
+	for _, c := range cols {
+		// Wide-only fields are still shown, there is room for them
+		t.rows = append(t.rows, []string{c.header, formatCell(get(c))})
+	}
+	return t
+}
+
+func structColumns(t reflect.Type) []column {
+	var cols []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("table")
+		if tag == "-" {
+			continue
+		}
+
+		// Promote the fields of embedded structs
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && tag == "" {
+			for _, c := range structColumns(f.Type) {
+				c.index = append([]int{i}, c.index...)
+				cols = append(cols, c)
+			}
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		c := column{header: parts[0], index: []int{i}}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "wide":
+				c.wide = true
+			case "status":
+				c.status = true
+			}
+		}
+		if c.header == "" {
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				name = f.Name
+			}
+			c.header = strings.ToUpper(strings.ReplaceAll(name, "_", " "))
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+// selectColumns applies --columns, or hides wide columns in narrow mode
+func (t *table) selectColumns(opts TableOptions) error {
+	if len(opts.Columns) == 0 {
+		if opts.Wide {
+			return nil
+		}
+		var keep []int
+		for i, c := range t.columns {
+			if !c.wide {
+				keep = append(keep, i)
+			}
+		}
+		t.project(keep)
+		return nil
+	}
+
+	var keep []int
+	for _, name := range opts.Columns {
+		i := t.columnIndex(name)
+		if i < 0 {
+			return fmt.Errorf("unknown column %q, available columns: %s", name, strings.Join(t.headers(), ", "))
+		}
+		keep = append(keep, i)
+	}
+	t.project(keep)
+	return nil
+}
+
+func (t *table) project(keep []int) {
+	cols := make([]column, len(keep))
+	for i, k := range keep {
+		cols[i] = t.columns[k]
+	}
+	for r, row := range t.rows {
+		cells := make([]string, len(keep))
+		for i, k := range keep {
+			cells[i] = row[k]
+		}
+		t.rows[r] = cells
+	}
+	t.columns = cols
+}
+
+func (t *table) sort(by string) error {
+	if by == "" {
+		return nil
+	}
+
+	desc := strings.HasPrefix(by, "-")
+	i := t.columnIndex(strings.TrimPrefix(by, "-"))
+	if i < 0 {
+		return fmt.Errorf("unknown sort column %q, available columns: %s", by, strings.Join(t.headers(), ", "))
+	}
+
+	sort.SliceStable(t.rows, func(a, b int) bool {
+		if desc {
+			return less(t.rows[b][i], t.rows[a][i])
+		}
+		return less(t.rows[a][i], t.rows[b][i])
+	})
+	return nil
+}
+
+// less compares numerically when both cells are numbers
+func less(a, b string) bool {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return fa < fb
+	}
+	return a < b
+}
+
+func (t *table) columnIndex(name string) int {
+	for i, c := range t.columns {
+		if strings.EqualFold(c.header, name) || strings.EqualFold(strings.ReplaceAll(c.header, " ", "_"), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *table) headers() []string {
+	headers := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		headers[i] = c.header
+	}
+	return headers
+}
+
+func (t *table) write(w io.Writer, opts TableOptions) {
+	if len(t.columns) == 0 {
+		return
+	}
+
+	cells := func(row []string) []string {
+		out := make([]string, len(row))
+		for i, c := range row {
+			if !opts.Wide && utf8.RuneCountInString(c) > narrowWidth {
+				c = string([]rune(c)[:narrowWidth-1]) + "…"
+			}
+			out[i] = c
+		}
+		return out
+	}
+
+	header := t.headers()
+	rows := make([][]string, len(t.rows))
+	widths := make([]int, len(t.columns))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for r, row := range t.rows {
+		rows[r] = cells(row)
+		for i, c := range rows[r] {
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	writeRow := func(row []string, colour bool) {
+		var b strings.Builder
+		for i, c := range row {
+			pad := ""
+			if i < len(row)-1 {
+				pad = strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)+2)
+			}
+			if colour && t.columns[i].status {
+				c = Colorize(c, StatusColor(c))
+			}
+			b.WriteString(c)
+			b.WriteString(pad)
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
+
+	writeRow(header, false)
+	for _, row := range rows {
+		writeRow(row, opts.Color)
+	}
+}
+
+func formatCell(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format(time.RFC3339)
+	case time.Duration:
+		return x.String()
+	case fmt.Stringer:
+		return x.String()
+	case error:
+		return x.Error()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes())
+		}
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = formatCell(v.Index(i))
+		}
+		return strings.Join(parts, ",")
+	case reflect.Map:
+		var parts []string
+		for _, e := range mapEntries(v) {
+			parts = append(parts, e.key+"="+formatCell(e.value))
+		}
+		return strings.Join(parts, ",")
+	case reflect.Struct:
+		var parts []string
+		for _, c := range structColumns(v.Type()) {
+			if s := formatCell(v.FieldByIndex(c.index)); s != "" {
+				parts = append(parts, strings.ToLower(c.header)+"="+s)
+			}
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+type mapEntry struct {
+	key   string
+	value reflect.Value
+}
+
+// mapEntries returns the entries of a map sorted by key
+func mapEntries(v reflect.Value) []mapEntry {
+	entries := make([]mapEntry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries = append(entries, mapEntry{key: fmt.Sprint(iter.Key().Interface()), value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// IsTerminal reports whether f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled reports whether colour output should be used for f,
+// honouring the NO_COLOR convention
+func ColorEnabled(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && IsTerminal(f)
+}
@@ -0,0 +1,114 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// assertGolden compares got with testdata/<name>.golden, rewriting the file
+// when the tests run with -update
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+type testResource struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Status   string        `json:"status" table:"STATUS,status"`
+	Replicas int           `json:"replicas"`
+	ID       string        `json:"id" table:",wide"`
+	Uptime   time.Duration `json:"uptime" table:"UP TIME"`
+	Token    string        `json:"token" table:"-"`
+}
+
+var testResources = []testResource{
+	{Name: "web", Type: "instance", Status: "running", Replicas: 10, ID: "i-0a1b2c", Uptime: 90 * time.Minute, Token: "hunter2"},
+	{Name: "db", Type: "database", Status: "failed", Replicas: 2, ID: "db-" + strings.Repeat("x", 60), Uptime: time.Hour},
+	{Name: "cache", Type: "cache", Status: "pending", Replicas: 3, ID: "c-1", Token: "hunter2"},
+}
+
+func TestRenderTable(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		opts TableOptions
+	}{
+		{name: "table", data: testResources},
+		{name: "table_wide", data: testResources, opts: TableOptions{Wide: true}},
+		{name: "table_columns", data: testResources, opts: TableOptions{Columns: []string{"status", "name", "id"}}},
+		{name: "table_sort", data: testResources, opts: TableOptions{SortBy: "name"}},
+		// Numbers sort numerically, so 10 comes after 3
+		{name: "table_sort_desc", data: testResources, opts: TableOptions{SortBy: "-replicas", Columns: []string{"name", "replicas"}}},
+		{name: "table_sort_by_header", data: testResources, opts: TableOptions{SortBy: "-up_time"}},
+		{name: "table_color", data: testResources, opts: TableOptions{Color: true, Columns: []string{"name", "status"}}},
+		{name: "table_struct", data: testResources[1]},
+		{name: "table_maps", data: []map[string]interface{}{
+			{"name": "web", "port": 8080},
+			{"name": "db", "tags": []string{"prod", "eu"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := renderTable(&out, tt.data, tt.opts); err != nil {
+				t.Fatalf("renderTable: %v", err)
+			}
+			assertGolden(t, tt.name, out.Bytes())
+		})
+	}
+}
+
+func TestRenderTableErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    interface{}
+		opts    TableOptions
+		wantErr string
+	}{
+		{
+			name:    "unknown column",
+			data:    testResources,
+			opts:    TableOptions{Columns: []string{"name", "token"}},
+			wantErr: `unknown column "token", available columns: NAME, TYPE, STATUS, REPLICAS, ID, UP TIME`,
+		},
+		{
+			name:    "unknown sort column",
+			data:    testResources,
+			opts:    TableOptions{SortBy: "-age"},
+			wantErr: `unknown sort column "-age", available columns: NAME, TYPE, STATUS, REPLICAS, UP TIME`,
+		},
+		{
+			name:    "unsupported type",
+			data:    42,
+			wantErr: "unsupported data type for table format: int",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := renderTable(&bytes.Buffer{}, tt.data, tt.opts)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("renderTable error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"sort"
+	"sync"
+)
+
+type builtin struct {
+	metadata    PluginMetadata
+	constructor func() Plugin
+}
+
+var (
+	builtinsMu sync.RWMutex
+	builtins   = make(map[string]builtin)
+)
+
+// Register makes a plugin compiled into the gort binary available under
+// name. It is meant to be called from the init function of the plugin's
+// package and panics when the name is registered twice.
+func Register(name string, metadata PluginMetadata, constructor func() Plugin) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+
+	if constructor == nil {
+		panic("plugin: Register constructor is nil for " + name)
+	}
+	if _, dup := builtins[name]; dup {
+		panic("plugin: Register called twice for " + name)
+	}
+
+	// Built-ins are compiled against this version of the API
+	metadata.Name = name
+	metadata.APIVersion = APIVersion
+	builtins[name] = builtin{metadata: metadata, constructor: constructor}
+}
+
+// Builtins returns the names of the registered built-in plugins, sorted
+func Builtins() []string {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"sort"
+)
+
+// AttributeChange is the planned change of a single resource attribute
+type AttributeChange struct {
+	Attribute string      `json:"attribute"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+	// RequiresReplace is set when the change cannot be applied in place
+	RequiresReplace bool `json:"requires_replace,omitempty"`
+}
+
+// ResourceDiff lists the attribute changes an update of a resource makes
+type ResourceDiff struct {
+	Changes []AttributeChange `json:"changes"`
+}
+
+// Differ is implemented by providers that work out the changes of an
+// update themselves, declared with InterfaceDiff. Diff is called on an
+// initialized plugin with the resource as recorded in state.
+type Differ interface {
+	Diff(ctx context.Context, current Resource, desired ResourceSpec) (*ResourceDiff, error)
+}
+
+// HasChanges reports whether applying the spec would change anything
+func (d *ResourceDiff) HasChanges() bool {
+	return d != nil && len(d.Changes) > 0
+}
+
+// ReplaceAttributes returns the changed attributes that require a
+// replacement, or nil when the update can be applied in place
+func (d *ResourceDiff) ReplaceAttributes() []string {
+	if d == nil {
+		return nil
+	}
+	var attrs []string
+	for _, c := range d.Changes {
+		if c.RequiresReplace {
+			attrs = append(attrs, c.Attribute)
+		}
+	}
+	return attrs
+}
+
+// StructuralDiff compares the properties of a resource with a spec. With a
+// schema, changes of ForceNew attributes require a replacement.
+func StructuralDiff(current Resource, desired ResourceSpec, schema *ResourceSchema) *ResourceDiff {
+	names := make(map[string]bool)
+	for k := range current.Properties {
+		names[k] = true
+	}
+	for k := range desired.Properties {
+		names[k] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	diff := &ResourceDiff{}
+	for _, name := range sorted {
+		before, after := current.Properties[name], desired.Properties[name]
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		change := AttributeChange{Attribute: name, Before: before, After: after}
+		if schema != nil {
+			change.RequiresReplace = schema.Attributes[name].ForceNew
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+	return diff
+}
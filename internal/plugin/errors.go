@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryableError marks a transient provider error, such as a throttled or
+// unavailable API, after which the call may be retried
+type RetryableError struct {
+	Err error
+	// RetryAfter is the minimum delay before retrying, when the provider
+	// knows it
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// PermanentError marks a provider error that retrying cannot fix, such as
+// invalid credentials, even if it matches a configured retry pattern
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Retryable marks err as retryable
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// RetryableAfter marks err as retryable no sooner than after d
+func RetryableAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err, RetryAfter: d}
+}
+
+// Permanent marks err as permanent
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsRetryable reports whether err, or an error it wraps, is retryable
+func IsRetryable(err error) bool {
+	var retryable *RetryableError
+	return errors.As(err, &retryable)
+}
+
+// IsPermanent reports whether err, or an error it wraps, is permanent
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryAfter returns the delay a retryable error asks for, or 0
+func RetryAfter(err error) time.Duration {
+	var retryable *RetryableError
+	if errors.As(err, &retryable) {
+		return retryable.RetryAfter
+	}
+	return 0
+}
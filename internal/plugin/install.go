@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ManifestFile holds the metadata of an installed plugin, so that it
+	// can be listed without opening the binary
+	ManifestFile = "plugin.json"
+	binaryFile   = "plugin.so"
+)
+
+// Installed is a plugin version installed in <plugin dir>/<name>/<version>
+type Installed struct {
+	Metadata PluginMetadata
+	// Path of the plugin binary
+	Path string
+}
+
+// ListInstalled returns the installed plugins, sorted by name and version
+func ListInstalled(dir string) ([]Installed, error) {
+	manifests, err := filepath.Glob(filepath.Join(dir, "*", "*", ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan plugin directory: %w", err)
+	}
+
+	var installed []Installed
+	for _, manifest := range manifests {
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plugin manifest: %w", err)
+		}
+		var metadata PluginMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse plugin manifest %s: %w", manifest, err)
+		}
+		installed = append(installed, Installed{
+			Metadata: metadata,
+			Path:     filepath.Join(filepath.Dir(manifest), binaryFile),
+		})
+	}
+
+	sort.Slice(installed, func(i, j int) bool {
+		a, b := installed[i].Metadata, installed[j].Metadata
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return compareVersions(a.Version, b.Version) < 0
+	})
+	return installed, nil
+}
+
+// Installer installs plugins from a registry and pins them in a lock file
+type Installer struct {
+	Dir  string
+	Lock *Lock
+	// TrustedKeys are base64 ed25519 public keys; when set, only releases
+	// signed by one of them are installed
+	TrustedKeys []string
+	// Upgrade installs the latest matching release even when an older
+	// matching one is locked
+	Upgrade bool
+}
+
+// Install installs the latest release of a plugin matching the constraint
+// and locks it. The locked version is kept while it matches the constraint,
+// unless upgrading, and must still have the locked checksum.
+func (in *Installer) Install(ctx context.Context, index *Index, name, constraint string) (*Installed, error) {
+	locked, isLocked := in.Lock.Plugins[name]
+	if isLocked && !in.Upgrade && matchVersion(constraint, locked.Version) {
+		constraint = locked.Version
+	}
+
+	release, err := index.Resolve(name, constraint)
+	if err != nil {
+		return nil, err
+	}
+	if isLocked && locked.Version == release.Version && locked.SHA256 != release.SHA256 {
+		return nil, fmt.Errorf("checksum of plugin %s %s differs from the lock file: expected %s, registry has %s",
+			name, release.Version, locked.SHA256, release.SHA256)
+	}
+
+	if release.Version == "" {
+		return nil, fmt.Errorf("release of plugin %s has no version", name)
+	}
+	dir, err := installDir(in.Dir, name, release.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := index.Download(ctx, release, in.TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	installed := Installed{
+		Metadata: PluginMetadata{
+			Name:        name,
+			Version:     release.Version,
+			APIVersion:  release.APIVersion,
+			Description: release.Description,
+			Interfaces:  release.Interfaces,
+		},
+		Path: filepath.Join(dir, binaryFile),
+	}
+	if err := writeInstalled(installed, data); err != nil {
+		return nil, err
+	}
+
+	in.Lock.Plugins[name] = LockedPlugin{
+		Version: release.Version,
+		SHA256:  Checksum(data),
+		Source:  index.location,
+	}
+	return &installed, nil
+}
+
+// Remove deletes the installed versions of a plugin, all of them when
+// version is empty, and unlocks it
+func (in *Installer) Remove(name, version string) error {
+	path, err := installDir(in.Dir, name, version)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("plugin %s is not installed", joinVersion(name, version))
+		}
+		return fmt.Errorf("failed to remove plugin: %w", err)
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove plugin: %w", err)
+	}
+
+	if locked, ok := in.Lock.Plugins[name]; ok && (version == "" || locked.Version == version) {
+		delete(in.Lock.Plugins, name)
+	}
+	return nil
+}
+
+// installDir returns the directory of a plugin, or of one of its versions
+// when version is not empty. Names and versions come from the command line
+// and from registries, so they must not escape dir.
+func installDir(dir, name, version string) (string, error) {
+	if !validPathElem(name) {
+		return "", fmt.Errorf("invalid plugin name %q", name)
+	}
+	path := filepath.Join(dir, name)
+	if version != "" {
+		if !validPathElem(version) {
+			return "", fmt.Errorf("invalid version %q of plugin %s", version, name)
+		}
+		path = filepath.Join(path, version)
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid plugin %s", joinVersion(name, version))
+	}
+	return path, nil
+}
+
+// validPathElem reports whether s can be used as a single path element
+func validPathElem(s string) bool {
+	return s != "" && s != "." && !strings.Contains(s, "..") && !strings.ContainsAny(s, `/\`) && filepath.Base(s) == s
+}
+
+func writeInstalled(installed Installed, data []byte) error {
+	dir := filepath.Dir(installed.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+	if err := os.WriteFile(installed.Path, data, 0755); err != nil {
+		return fmt.Errorf("failed to write plugin: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(installed.Metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), append(manifest, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write plugin manifest: %w", err)
+	}
+	return nil
+}
+
+func joinVersion(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
@@ -0,0 +1,297 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRegistry serves an index and plugin binaries over HTTP
+type testRegistry struct {
+	server   *httptest.Server
+	index    Index
+	binaries map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	r := &testRegistry{
+		index:    Index{Plugins: make(map[string][]Release)},
+		binaries: make(map[string][]byte),
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/"+IndexFile {
+			json.NewEncoder(w).Encode(r.index)
+			return
+		}
+		data, ok := r.binaries[strings.TrimPrefix(req.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// publish adds a release of name with the given binary, returning it so
+// tests can tamper with the published checksum or signature
+func (r *testRegistry) publish(name, version string, data []byte, key ed25519.PrivateKey) *Release {
+	file := name + "-" + version + ".so"
+	r.binaries[file] = data
+	release := Release{
+		Version:    version,
+		APIVersion: APIVersion,
+		Interfaces: []string{InterfaceProvider},
+		URL:        file,
+		SHA256:     Checksum(data),
+	}
+	if key != nil {
+		release.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	}
+	r.index.Plugins[name] = append(r.index.Plugins[name], release)
+	return &r.index.Plugins[name][len(r.index.Plugins[name])-1]
+}
+
+func (r *testRegistry) fetch(t *testing.T) *Index {
+	t.Helper()
+	index, err := FetchIndex(context.Background(), r.server.URL)
+	if err != nil {
+		t.Fatalf("FetchIndex: %v", err)
+	}
+	return index
+}
+
+func newKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(pub), priv
+}
+
+func newInstaller(t *testing.T) *Installer {
+	return &Installer{Dir: t.TempDir(), Lock: &Lock{Plugins: make(map[string]LockedPlugin)}}
+}
+
+func TestInstallLocksRelease(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish("demo", "1.0.0", []byte("v1"), nil)
+	reg.publish("demo", "1.2.0", []byte("v1.2"), nil)
+	reg.publish("demo", "2.0.0", []byte("v2"), nil)
+	in := newInstaller(t)
+
+	installed, err := in.Install(context.Background(), reg.fetch(t), "demo", "1")
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if installed.Metadata.Version != "1.2.0" {
+		t.Errorf("installed version = %s, want 1.2.0", installed.Metadata.Version)
+	}
+	if want := filepath.Join(in.Dir, "demo", "1.2.0", binaryFile); installed.Path != want {
+		t.Errorf("installed path = %s, want %s", installed.Path, want)
+	}
+	if data, err := os.ReadFile(installed.Path); err != nil || string(data) != "v1.2" {
+		t.Errorf("installed binary = %q, %v", data, err)
+	}
+
+	locked := in.Lock.Plugins["demo"]
+	if locked.Version != "1.2.0" || locked.SHA256 != Checksum([]byte("v1.2")) {
+		t.Errorf("lock = %+v", locked)
+	}
+
+	list, err := ListInstalled(in.Dir)
+	if err != nil || len(list) != 1 || list[0].Metadata.Name != "demo" {
+		t.Errorf("ListInstalled = %+v, %v", list, err)
+	}
+}
+
+func TestInstallKeepsLockedVersion(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish("demo", "1.0.0", []byte("v1"), nil)
+	reg.publish("demo", "1.2.0", []byte("v1.2"), nil)
+	in := newInstaller(t)
+	in.Lock.Plugins["demo"] = LockedPlugin{Version: "1.0.0", SHA256: Checksum([]byte("v1"))}
+
+	installed, err := in.Install(context.Background(), reg.fetch(t), "demo", "1")
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if installed.Metadata.Version != "1.0.0" {
+		t.Errorf("installed version = %s, want the locked 1.0.0", installed.Metadata.Version)
+	}
+
+	in.Upgrade = true
+	installed, err = in.Install(context.Background(), reg.fetch(t), "demo", "1")
+	if err != nil {
+		t.Fatalf("Install with upgrade: %v", err)
+	}
+	if installed.Metadata.Version != "1.2.0" || in.Lock.Plugins["demo"].Version != "1.2.0" {
+		t.Errorf("upgrade installed %s, locked %s", installed.Metadata.Version, in.Lock.Plugins["demo"].Version)
+	}
+}
+
+func TestInstallRejectsLockMismatch(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish("demo", "1.0.0", []byte("rebuilt"), nil)
+	in := newInstaller(t)
+	in.Lock.Plugins["demo"] = LockedPlugin{Version: "1.0.0", SHA256: Checksum([]byte("original"))}
+
+	_, err := in.Install(context.Background(), reg.fetch(t), "demo", "1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "differs from the lock file") {
+		t.Fatalf("Install error = %v, want a lock file mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(in.Dir, "demo")); !os.IsNotExist(err) {
+		t.Errorf("plugin was written despite the lock mismatch")
+	}
+}
+
+func TestInstallRejectsBadChecksum(t *testing.T) {
+	reg := newTestRegistry(t)
+	release := reg.publish("demo", "1.0.0", []byte("v1"), nil)
+	release.SHA256 = Checksum([]byte("something else"))
+	in := newInstaller(t)
+
+	_, err := in.Install(context.Background(), reg.fetch(t), "demo", "")
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Install error = %v, want a checksum mismatch", err)
+	}
+	if len(in.Lock.Plugins) != 0 {
+		t.Errorf("plugin was locked despite the bad checksum")
+	}
+}
+
+func TestInstallVerifiesSignature(t *testing.T) {
+	trusted, key := newKey(t)
+	_, otherKey := newKey(t)
+
+	tests := []struct {
+		name    string
+		key     ed25519.PrivateKey
+		trusted []string
+		wantErr string
+	}{
+		{name: "trusted key", key: key},
+		{name: "untrusted key", key: otherKey, wantErr: "does not match any trusted key"},
+		{name: "unsigned", wantErr: "release is not signed"},
+		// Invalid keys are skipped
+		{name: "trusted key after invalid key", key: key, trusted: []string{"not-a-key", trusted}},
+		{
+			name:    "only invalid keys",
+			key:     key,
+			trusted: []string{"not-a-key", "c2hvcnQ="},
+			wantErr: `does not match any trusted key (invalid trusted keys: "not-a-key", "c2hvcnQ=")`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newTestRegistry(t)
+			reg.publish("demo", "1.0.0", []byte("v1"), tt.key)
+			in := newInstaller(t)
+			in.TrustedKeys = []string{trusted}
+			if tt.trusted != nil {
+				in.TrustedKeys = tt.trusted
+			}
+
+			_, err := in.Install(context.Background(), reg.fetch(t), "demo", "")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Install: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Install error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstallRejectsBadSignatureOfTamperedBinary(t *testing.T) {
+	trusted, key := newKey(t)
+	reg := newTestRegistry(t)
+	release := reg.publish("demo", "1.0.0", []byte("v1"), key)
+	// The binary and checksum are replaced but the signature is not
+	reg.binaries[release.URL] = []byte("tampered")
+	release.SHA256 = Checksum([]byte("tampered"))
+	in := newInstaller(t)
+	in.TrustedKeys = []string{trusted}
+
+	_, err := in.Install(context.Background(), reg.fetch(t), "demo", "")
+	if err == nil || !strings.Contains(err.Error(), "does not match any trusted key") {
+		t.Fatalf("Install error = %v, want a bad signature", err)
+	}
+}
+
+func TestInstallRejectsUnsafeVersion(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish("demo", "1.0.0", []byte("v1"), nil)
+	reg.index.Plugins["demo"][0].Version = "../../escape"
+	in := newInstaller(t)
+
+	_, err := in.Install(context.Background(), reg.fetch(t), "demo", "")
+	if err == nil || !strings.Contains(err.Error(), "invalid version") {
+		t.Fatalf("Install error = %v, want an invalid version", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(in.Dir), "escape")); !os.IsNotExist(err) {
+		t.Errorf("plugin was written outside the plugin directory")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish("demo", "1.0.0", []byte("v1"), nil)
+	in := newInstaller(t)
+	if _, err := in.Install(context.Background(), reg.fetch(t), "demo", ""); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+
+	if err := in.Remove("demo", "1.0.0"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, ok := in.Lock.Plugins["demo"]; ok {
+		t.Error("removed plugin is still locked")
+	}
+	if err := in.Remove("demo", "1.0.0"); err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("second Remove error = %v, want not installed", err)
+	}
+}
+
+func TestRemoveRejectsPathsOutsideDir(t *testing.T) {
+	parent := t.TempDir()
+	in := &Installer{Dir: filepath.Join(parent, "plugins"), Lock: &Lock{Plugins: make(map[string]LockedPlugin)}}
+	if err := os.MkdirAll(in.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	keep := filepath.Join(parent, "keep")
+	if err := os.WriteFile(keep, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ name, version string }{
+		{"..", ""},
+		{".", ""},
+		{"", ""},
+		{"demo", ".."},
+		{"demo", "../.."},
+		{"../keep", ""},
+		{"demo/1.0.0", ""},
+	} {
+		if err := in.Remove(tc.name, tc.version); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("Remove(%q, %q) error = %v, want invalid", tc.name, tc.version, err)
+		}
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("file outside the plugin directory was removed: %v", err)
+	}
+}
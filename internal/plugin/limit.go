@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Provider properties limiting the calls gort makes to a provider
+const (
+	// PropertyRateLimit is the number of calls per second
+	PropertyRateLimit = "rate_limit"
+	// PropertyRateBurst is the number of calls that may be made at once
+	// before the rate limit applies, 1 by default
+	PropertyRateBurst = "rate_burst"
+	// PropertyMaxConcurrent is the number of resource operations that may
+	// run at the same time
+	PropertyMaxConcurrent = "max_concurrent"
+)
+
+// Limits bound the calls to a provider; zero values mean no limit
+type Limits struct {
+	Rate          float64
+	Burst         int
+	MaxConcurrent int
+}
+
+// ParseLimits reads the limit properties of a provider configuration
+func ParseLimits(config map[string]interface{}) (Limits, error) {
+	var limits Limits
+	rate, err := number(config, PropertyRateLimit)
+	if err != nil {
+		return limits, err
+	}
+	burst, err := number(config, PropertyRateBurst)
+	if err != nil {
+		return limits, err
+	}
+	concurrent, err := number(config, PropertyMaxConcurrent)
+	if err != nil {
+		return limits, err
+	}
+
+	limits.Rate, limits.Burst, limits.MaxConcurrent = rate, int(burst), int(concurrent)
+	if limits.Rate > 0 && limits.Burst < 1 {
+		limits.Burst = 1
+	}
+	return limits, nil
+}
+
+func number(config map[string]interface{}, key string) (float64, error) {
+	var n float64
+	switch v := config[key].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		n = float64(v)
+	case float64:
+		n = v
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a number", key)
+		}
+		n = parsed
+	default:
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return n, nil
+}
+
+// Limiter enforces the Limits of a provider for every caller sharing it: a
+// token bucket for calls and a cap on concurrent operations. A nil Limiter
+// does not limit anything.
+type Limiter struct {
+	limits Limits
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter enforcing limits, or nil when there are none
+func NewLimiter(limits Limits) *Limiter {
+	if limits.Rate <= 0 && limits.MaxConcurrent <= 0 {
+		return nil
+	}
+	l := &Limiter{limits: limits, tokens: float64(limits.Burst), last: time.Now()}
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return l
+}
+
+// Wait blocks until the rate limit allows another call and returns how long
+// it waited
+func (l *Limiter) Wait(ctx context.Context) (time.Duration, error) {
+	if l == nil || l.limits.Rate <= 0 {
+		return 0, nil
+	}
+
+	// Take a token now, going into debt when there is none, and sleep
+	// until the debt is repaid
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.limits.Rate
+	if max := float64(l.limits.Burst); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.limits.Rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// Acquire blocks until fewer than MaxConcurrent operations run. It returns
+// a function ending the operation and how long it waited.
+func (l *Limiter) Acquire(ctx context.Context) (func(), time.Duration, error) {
+	if l == nil || l.slots == nil {
+		return func() {}, 0, nil
+	}
+
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	return func() { <-l.slots }, time.Since(start), nil
+}
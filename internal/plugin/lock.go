@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LockFile is the name of the lock file kept next to the configuration
+const LockFile = "gort.lock.json"
+
+// Lock pins the installed version of every plugin, so that all users and CI
+// load the same plugin builds
+type Lock struct {
+	Plugins map[string]LockedPlugin `json:"plugins"`
+}
+
+// LockedPlugin is the pinned release of a plugin
+type LockedPlugin struct {
+	Version string `json:"version"`
+	// SHA256 is the hex checksum of the plugin binary
+	SHA256 string `json:"sha256"`
+	Source string `json:"source,omitempty"`
+}
+
+// LockPath returns the path of the lock file for a configuration file
+func LockPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), LockFile)
+}
+
+// LoadLock reads a lock file; a missing file is an empty lock
+func LoadLock(path string) (*Lock, error) {
+	lock := &Lock{Plugins: make(map[string]LockedPlugin)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", path, err)
+	}
+	if lock.Plugins == nil {
+		lock.Plugins = make(map[string]LockedPlugin)
+	}
+	return lock, nil
+}
+
+// Save writes the lock file
+func (l *Lock) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
+
+// Names returns the locked plugin names, sorted
+func (l *Lock) Names() []string {
+	names := make([]string, 0, len(l.Plugins))
+	for name := range l.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
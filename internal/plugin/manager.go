@@ -3,18 +3,71 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"plugin"
+	"sort"
 	"sync"
+
+	"github.com/yahao333/gort/internal/logging"
+)
+
+// APIVersion is the version of the plugin API implemented by this build.
+// Plugins declare the version they were built against in their metadata and
+// are refused when it differs.
+const APIVersion = 1
+
+// Interfaces a plugin can declare in PluginMetadata.Interfaces
+const (
+	InterfaceProvider = "provider"
+	InterfaceHook     = "hook"
+	// InterfaceSchema plugins describe their resources, see SchemaProvider
+	InterfaceSchema = "schema"
+	// InterfaceDiff plugins plan their own updates, see Differ
+	InterfaceDiff = "diff"
+	// InterfaceAsync plugins start operations and report their progress,
+	// see AsyncProvider
+	InterfaceAsync = "async"
 )
 
+// supportedInterfaces maps the interfaces this build can use to a check that
+// an instance implements them
+var supportedInterfaces = map[string]func(Plugin) bool{
+	InterfaceProvider: func(p Plugin) bool { _, ok := p.(ProviderPlugin); return ok },
+	InterfaceHook:     func(p Plugin) bool { _, ok := p.(HookPlugin); return ok },
+	InterfaceSchema:   func(p Plugin) bool { _, ok := p.(SchemaProvider); return ok },
+	InterfaceDiff:     func(p Plugin) bool { _, ok := p.(Differ); return ok },
+	InterfaceAsync:    func(p Plugin) bool { _, ok := p.(AsyncProvider); return ok },
+}
+
+// IncompatibleError is returned when loading a plugin built against another
+// version of the plugin API
+type IncompatibleError struct {
+	Plugin     string
+	APIVersion int
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("plugin %s targets plugin API v%d, but this version of gort supports v%d; install a release of the plugin built for v%d",
+		e.Plugin, e.APIVersion, APIVersion, APIVersion)
+}
+
 // PluginManager handles plugin lifecycle and management
 type PluginManager struct {
-	mu          sync.RWMutex
-	pluginDir   string
-	plugins     map[string]*PluginInfo
-	logger      *Logger
+	mu        sync.RWMutex
+	pluginDir string
+	// plugins holds the available versions of every plugin by name
+	plugins map[string][]*PluginInfo
+	// active is the version of each plugin selected by LoadPlugin
+	active      map[string]*PluginInfo
+	required    map[string]string
+	configs     map[string]map[string]interface{}
+	lock        *Lock
+	logger      logging.Log
 	initialized bool
+	// limiters are shared by every caller of a plugin, see Limiter
+	limiters  map[string]*Limiter
+	limitErrs map[string]error
 }
 
 // PluginInfo stores plugin metadata and instance
@@ -23,28 +76,122 @@ type PluginInfo struct {
 	Instance Plugin
 	Path     string
 	Loaded   bool
+	// Builtin plugins are compiled into gort and registered with Register
+	Builtin     bool
+	constructor func() Plugin
+	// schema caches the resource schema of the plugin
+	schema *Schema
+	// err is why the plugin cannot be loaded, reported by LoadPlugin
+	err error
 }
 
 // PluginMetadata contains plugin metadata
 type PluginMetadata struct {
-	Name        string            `json:"name"`
-	Version     string            `json:"version"`
-	Type        string            `json:"type"`
-	Author      string            `json:"author"`
-	Description string            `json:"description"`
-	Properties  map[string]string `json:"properties"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// APIVersion is the plugin API the plugin was built against
+	APIVersion  int    `json:"api_version"`
+	Author      string `json:"author"`
+	Description string `json:"description"`
+	// Interfaces lists the capabilities the plugin implements, such as
+	// InterfaceProvider
+	Interfaces []string          `json:"interfaces"`
+	Properties map[string]string `json:"properties"`
 }
 
-// NewPluginManager creates a new plugin manager
-func NewPluginManager(pluginDir string, logger *Logger) *PluginManager {
+// Implements reports whether the plugin declares an interface
+func (m *PluginMetadata) Implements(iface string) bool {
+	for _, i := range m.Interfaces {
+		if i == iface {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCompatible verifies that the plugin targets this API version and only
+// declares interfaces this build supports
+func (m *PluginMetadata) checkCompatible() error {
+	if m.APIVersion != APIVersion {
+		return &IncompatibleError{Plugin: m.Name, APIVersion: m.APIVersion}
+	}
+	if len(m.Interfaces) == 0 {
+		return fmt.Errorf("plugin %s declares no interfaces", m.Name)
+	}
+	for _, iface := range m.Interfaces {
+		if _, ok := supportedInterfaces[iface]; !ok {
+			return fmt.Errorf("plugin %s requires interface %q, which this version of gort does not support", m.Name, iface)
+		}
+	}
+	return nil
+}
+
+// checkImplements verifies that an instance implements the interfaces the
+// plugin declares
+func (m *PluginMetadata) checkImplements(instance Plugin) error {
+	for _, iface := range m.Interfaces {
+		if check, ok := supportedInterfaces[iface]; !ok || !check(instance) {
+			return fmt.Errorf("plugin %s declares interface %q but does not implement it", m.Name, iface)
+		}
+	}
+	return nil
+}
+
+// NewPluginManager creates a new plugin manager; a nil logger discards its
+// logs
+func NewPluginManager(pluginDir string, logger logging.Log) *PluginManager {
+	if logger == nil {
+		logger = logging.Discard
+	}
 	return &PluginManager{
 		pluginDir: pluginDir,
-		plugins:   make(map[string]*PluginInfo),
+		plugins:   make(map[string][]*PluginInfo),
+		active:    make(map[string]*PluginInfo),
+		required:  make(map[string]string),
+		configs:   make(map[string]map[string]interface{}),
+		limiters:  make(map[string]*Limiter),
+		limitErrs: make(map[string]error),
 		logger:    logger,
 	}
 }
 
-// Initialize scans plugin directory and loads plugin metadata
+// Require restricts the versions of a plugin that can be loaded, see
+// matchVersion
+func (pm *PluginManager) Require(name, constraint string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.required[name] = constraint
+}
+
+// Configure sets the configuration a plugin is initialized with, including
+// the limits of its Limiter
+func (pm *PluginManager) Configure(name string, config map[string]interface{}) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.configs[name] = config
+
+	limits, err := ParseLimits(config)
+	pm.limiters[name] = NewLimiter(limits)
+	pm.limitErrs[name] = err
+}
+
+// Limiter returns the limiter shared by the callers of a plugin, or nil
+// when its calls are not limited
+func (pm *PluginManager) Limiter(name string) *Limiter {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.limiters[name]
+}
+
+// SetLock pins plugins to the versions and checksums of a lock file
+func (pm *PluginManager) SetLock(lock *Lock) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.lock = lock
+}
+
+// Initialize makes the built-in plugins available and scans the plugin
+// directory for installed plugins and plugin binaries copied into it
 func (pm *PluginManager) Initialize(ctx context.Context) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -53,6 +200,27 @@ func (pm *PluginManager) Initialize(ctx context.Context) error {
 		return nil
 	}
 
+	builtinsMu.RLock()
+	for _, b := range builtins {
+		metadata := b.metadata
+		pm.plugins[metadata.Name] = append(pm.plugins[metadata.Name], &PluginInfo{
+			Metadata:    &metadata,
+			Builtin:     true,
+			constructor: b.constructor,
+		})
+	}
+	builtinsMu.RUnlock()
+
+	// External plugins override built-ins of the same name and version
+	installed, err := ListInstalled(pm.pluginDir)
+	if err != nil {
+		return err
+	}
+	for _, in := range installed {
+		metadata := in.Metadata
+		pm.addPlugin(&metadata, in.Path)
+	}
+
 	// Scan plugin directory
 	files, err := filepath.Glob(filepath.Join(pm.pluginDir, "*.so"))
 	if err != nil {
@@ -70,47 +238,132 @@ func (pm *PluginManager) Initialize(ctx context.Context) error {
 	return nil
 }
 
-// LoadPlugin loads a specific plugin
+// LoadPlugin loads the selected version of a plugin
 func (pm *PluginManager) LoadPlugin(ctx context.Context, name string) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
-	info, exists := pm.plugins[name]
-	if !exists {
-		return fmt.Errorf("plugin %s not found", name)
+	if _, loaded := pm.active[name]; loaded {
+		return nil
+	}
+	if err := pm.limitErrs[name]; err != nil {
+		return fmt.Errorf("invalid limits for plugin %s: %w", name, err)
 	}
 
-	if info.Loaded {
-		return nil
+	info, err := pm.selectVersion(name)
+	if err != nil {
+		return err
+	}
+	if info.err != nil {
+		return info.err
+	}
+
+	metadata, instance, err := info.instantiate()
+	if err != nil {
+		return err
+	}
+
+	// Initialize plugin; it only becomes active once initialized so a
+	// failed plugin is not handed out and is retried on the next load
+	if err := instance.Init(pm.configs[name]); err != nil {
+		return fmt.Errorf("failed to initialize plugin: %w", err)
+	}
+	info.Metadata = metadata
+	info.Instance = instance
+	info.Loaded = true
+	pm.active[name] = info
+
+	pm.logger.Infof("Loaded plugin: %s v%s", info.Metadata.Name, info.Metadata.Version)
+	return nil
+}
+
+// instantiate creates an instance of the plugin, opening its binary unless
+// it is built in
+func (info *PluginInfo) instantiate() (*PluginMetadata, Plugin, error) {
+	if info.Builtin {
+		instance := info.constructor()
+		if err := info.Metadata.checkImplements(instance); err != nil {
+			return nil, nil, err
+		}
+		return info.Metadata, instance, nil
 	}
 
 	p, err := plugin.Open(info.Path)
 	if err != nil {
-		return fmt.Errorf("failed to open plugin: %w", err)
+		return nil, nil, fmt.Errorf("failed to open plugin: %w", err)
+	}
+
+	// The binary must be the plugin its manifest describes
+	metadata, err := lookupMetadata(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata.Name != info.Metadata.Name || metadata.Version != info.Metadata.Version {
+		return nil, nil, fmt.Errorf("plugin binary %s is %s %s, expected %s %s", info.Path,
+			metadata.Name, metadata.Version, info.Metadata.Name, info.Metadata.Version)
+	}
+	if err := metadata.checkCompatible(); err != nil {
+		return nil, nil, err
 	}
 
 	// Load plugin instance
 	newSymbol, err := p.Lookup("New")
 	if err != nil {
-		return fmt.Errorf("plugin constructor not found: %w", err)
+		return nil, nil, fmt.Errorf("plugin constructor not found: %w", err)
 	}
 
 	constructor, ok := newSymbol.(func() Plugin)
 	if !ok {
-		return fmt.Errorf("invalid plugin constructor type")
+		return nil, nil, fmt.Errorf("invalid plugin constructor type")
 	}
-
 	instance := constructor()
-	info.Instance = instance
-	info.Loaded = true
+	if err := metadata.checkImplements(instance); err != nil {
+		return nil, nil, err
+	}
+	return metadata, instance, nil
+}
 
-	// Initialize plugin
-	if err := instance.Init(nil); err != nil {
-		return fmt.Errorf("failed to initialize plugin: %w", err)
+// selectVersion picks the version of a plugin to load: the locked one when
+// the plugin is locked, otherwise the latest matching the required version
+func (pm *PluginManager) selectVersion(name string) (*PluginInfo, error) {
+	infos, exists := pm.plugins[name]
+	if !exists {
+		return nil, fmt.Errorf("plugin %s not found", name)
+	}
+	constraint := pm.required[name]
+
+	if pm.lock != nil {
+		if locked, ok := pm.lock.Plugins[name]; ok {
+			if !matchVersion(constraint, locked.Version) {
+				return nil, fmt.Errorf("plugin %s is locked to %s, which does not match the required version %q; run 'gort plugin install %s@%s'",
+					name, locked.Version, constraint, name, constraint)
+			}
+			for _, info := range infos {
+				if info.Metadata.Version == locked.Version {
+					if info.Builtin {
+						return info, nil
+					}
+					if err := verifyFile(info.Path, locked.SHA256); err != nil {
+						return nil, fmt.Errorf("plugin %s %s does not match the lock file: %w", name, locked.Version, err)
+					}
+					return info, nil
+				}
+			}
+			return nil, fmt.Errorf("plugin %s %s from the lock file is not installed; run 'gort plugin install'", name, locked.Version)
+		}
 	}
 
-	pm.logger.Infof("Loaded plugin: %s v%s", info.Metadata.Name, info.Metadata.Version)
-	return nil
+	versions := make([]string, len(infos))
+	for i, info := range infos {
+		versions[i] = info.Metadata.Version
+	}
+	version := latestVersion(constraint, versions)
+	for _, info := range infos {
+		if info.Metadata.Version == version {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("no installed version of plugin %s matches %q", name, constraint)
 }
 
 // UnloadPlugin unloads a specific plugin
@@ -118,12 +371,8 @@ func (pm *PluginManager) UnloadPlugin(ctx context.Context, name string) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
-	info, exists := pm.plugins[name]
-	if !exists {
-		return fmt.Errorf("plugin %s not found", name)
-	}
-
-	if !info.Loaded {
+	info, loaded := pm.active[name]
+	if !loaded {
 		return nil
 	}
 
@@ -133,6 +382,7 @@ func (pm *PluginManager) UnloadPlugin(ctx context.Context, name string) error {
 
 	info.Instance = nil
 	info.Loaded = false
+	delete(pm.active, name)
 	return nil
 }
 
@@ -141,18 +391,130 @@ func (pm *PluginManager) GetPlugin(name string) (Plugin, error) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
-	info, exists := pm.plugins[name]
-	if !exists {
-		return nil, fmt.Errorf("plugin %s not found", name)
-	}
-
-	if !info.Loaded {
+	info, loaded := pm.active[name]
+	if !loaded {
+		if _, exists := pm.plugins[name]; !exists {
+			return nil, fmt.Errorf("plugin %s not found", name)
+		}
 		return nil, fmt.Errorf("plugin %s is not loaded", name)
 	}
 
 	return info.Instance, nil
 }
 
+// GetProvider returns a loaded plugin that declares InterfaceProvider
+func (pm *PluginManager) GetProvider(name string) (ProviderPlugin, error) {
+	p, err := pm.GetPlugin(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	metadata := pm.active[name].Metadata
+	pm.mu.RUnlock()
+	if !metadata.Implements(InterfaceProvider) {
+		return nil, fmt.Errorf("plugin %s is not a provider", name)
+	}
+	return p.(ProviderPlugin), nil
+}
+
+// Schema returns the resource schema of the plugin version LoadPlugin
+// selects, or nil when the plugin does not declare InterfaceSchema. The
+// plugin does not need to be loaded and is not initialized for it.
+func (pm *PluginManager) Schema(ctx context.Context, name string) (*Schema, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	info, loaded := pm.active[name]
+	if !loaded {
+		var err error
+		if info, err = pm.selectVersion(name); err != nil {
+			return nil, err
+		}
+		if info.err != nil {
+			return nil, info.err
+		}
+	}
+	if info.schema != nil || !info.Metadata.Implements(InterfaceSchema) {
+		return info.schema, nil
+	}
+
+	instance := info.Instance
+	if !loaded {
+		var err error
+		if _, instance, err = info.instantiate(); err != nil {
+			return nil, err
+		}
+	}
+	info.schema = instance.(SchemaProvider).Schema()
+	return info.schema, nil
+}
+
+// GetAsync returns a loaded provider that declares InterfaceAsync, or nil
+// when the plugin only has the synchronous calls of ProviderPlugin
+func (pm *PluginManager) GetAsync(name string) (AsyncProvider, error) {
+	p, err := pm.GetPlugin(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.RLock()
+	metadata := pm.active[name].Metadata
+	pm.mu.RUnlock()
+	if !metadata.Implements(InterfaceAsync) {
+		return nil, nil
+	}
+	return p.(AsyncProvider), nil
+}
+
+// Differ loads a plugin that declares InterfaceDiff and returns it, or nil
+// when the plugin leaves diffs to StructuralDiff
+func (pm *PluginManager) Differ(ctx context.Context, name string) (Differ, error) {
+	pm.mu.Lock()
+	info, loaded := pm.active[name]
+	if !loaded {
+		var err error
+		if info, err = pm.selectVersion(name); err != nil {
+			pm.mu.Unlock()
+			return nil, err
+		}
+	}
+	pm.mu.Unlock()
+	if !info.Metadata.Implements(InterfaceDiff) {
+		return nil, nil
+	}
+
+	if err := pm.LoadPlugin(ctx, name); err != nil {
+		return nil, err
+	}
+	p, err := pm.GetPlugin(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.(Differ), nil
+}
+
+// List returns the available plugin versions, sorted by name and version
+func (pm *PluginManager) List() []PluginInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	var list []PluginInfo
+	for _, infos := range pm.plugins {
+		for _, info := range infos {
+			list = append(list, *info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].Metadata, list[j].Metadata
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return compareVersions(a.Version, b.Version) < 0
+	})
+	return list
+}
+
 // loadPluginMetadata loads plugin metadata without fully loading the plugin
 func (pm *PluginManager) loadPluginMetadata(path string) error {
 	p, err := plugin.Open(path)
@@ -160,21 +522,54 @@ func (pm *PluginManager) loadPluginMetadata(path string) error {
 		return fmt.Errorf("failed to open plugin: %w", err)
 	}
 
-	metadataSymbol, err := p.Lookup("Metadata")
+	metadata, err := lookupMetadata(p)
 	if err != nil {
-		return fmt.Errorf("plugin metadata not found: %w", err)
-	}
-
-	metadata, ok := metadataSymbol.(*PluginMetadata)
-	if !ok {
-		return fmt.Errorf("invalid plugin metadata type")
+		return err
 	}
+	pm.addPlugin(metadata, path)
+	return nil
+}
 
-	pm.plugins[metadata.Name] = &PluginInfo{
+// addPlugin makes a plugin version available
+func (pm *PluginManager) addPlugin(metadata *PluginMetadata, path string) {
+	info := &PluginInfo{
 		Metadata: metadata,
 		Path:     path,
 		Loaded:   false,
 	}
+	// Keep incompatible plugins so that loading them reports why
+	if err := metadata.checkCompatible(); err != nil {
+		info.err = err
+		pm.logger.Warnf("Skipping plugin %s: %v", metadata.Name, err)
+	}
+	for i, other := range pm.plugins[metadata.Name] {
+		if other.Builtin && other.Metadata.Version == metadata.Version {
+			pm.logger.Debugf("Plugin %s %s overrides the built-in plugin", metadata.Name, metadata.Version)
+			pm.plugins[metadata.Name][i] = info
+			return
+		}
+	}
+	pm.plugins[metadata.Name] = append(pm.plugins[metadata.Name], info)
+}
 
-	return nil
+func lookupMetadata(p *plugin.Plugin) (*PluginMetadata, error) {
+	metadataSymbol, err := p.Lookup("Metadata")
+	if err != nil {
+		return nil, fmt.Errorf("plugin metadata not found: %w", err)
+	}
+
+	metadata, ok := metadataSymbol.(**PluginMetadata)
+	if !ok {
+		return nil, fmt.Errorf("invalid plugin metadata type")
+	}
+	return *metadata, nil
+}
+
+// verifyFile checks the checksum of a plugin binary
+func verifyFile(path, expected string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin: %w", err)
+	}
+	return VerifyChecksum(data, expected)
 }
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yahao333/gort/internal/logging"
+)
+
+// flakyPlugin fails to initialize until ready is set
+type flakyPlugin struct {
+	ready *bool
+}
+
+func (p *flakyPlugin) Init(config map[string]interface{}) error {
+	if !*p.ready {
+		return errors.New("not ready")
+	}
+	return nil
+}
+func (p *flakyPlugin) Name() string                       { return "test-flaky" }
+func (p *flakyPlugin) Version() string                    { return "1.0.0" }
+func (p *flakyPlugin) Shutdown(ctx context.Context) error { return nil }
+
+var flakyReady bool
+
+func init() {
+	Register("test-flaky", PluginMetadata{Version: "1.0.0"}, func() Plugin {
+		return &flakyPlugin{ready: &flakyReady}
+	})
+}
+
+func TestLoadPluginFailedInitIsNotActive(t *testing.T) {
+	logger := logging.NewTestLogger()
+	pm := NewPluginManager(t.TempDir(), logger)
+	if err := pm.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	flakyReady = false
+	defer func() { flakyReady = false }()
+	if err := pm.LoadPlugin(context.Background(), "test-flaky"); err == nil {
+		t.Fatal("LoadPlugin succeeded although Init failed")
+	}
+	if _, err := pm.GetPlugin("test-flaky"); err == nil {
+		t.Fatal("GetPlugin returned a plugin whose Init failed")
+	}
+	if logger.Contains("info", "Loaded plugin") {
+		t.Error("a plugin whose Init failed was logged as loaded")
+	}
+
+	// The next load retries Init
+	flakyReady = true
+	if err := pm.LoadPlugin(context.Background(), "test-flaky"); err != nil {
+		t.Fatalf("LoadPlugin after Init recovers: %v", err)
+	}
+	if _, err := pm.GetPlugin("test-flaky"); err != nil {
+		t.Fatalf("GetPlugin: %v", err)
+	}
+}
+
+func TestLoadPluginRejectsLockMismatch(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish("demo", "1.0.0", []byte("v1"), nil)
+	in := newInstaller(t)
+	installed, err := in.Install(context.Background(), reg.fetch(t), "demo", "")
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+
+	// The installed binary no longer matches its locked checksum
+	if err := os.WriteFile(installed.Path, []byte("replaced"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pm := NewPluginManager(in.Dir, nil)
+	pm.SetLock(in.Lock)
+	if err := pm.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	err = pm.LoadPlugin(context.Background(), "demo")
+	if err == nil || !strings.Contains(err.Error(), "does not match the lock file") {
+		t.Fatalf("LoadPlugin error = %v, want a lock file mismatch", err)
+	}
+}
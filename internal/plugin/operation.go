@@ -0,0 +1,38 @@
+package plugin
+
+import "context"
+
+// Operation is a handle on a provider operation that completes in the
+// background
+type Operation struct {
+	ID string `json:"id"`
+	// ResourceID is the resource the operation acts on, when known
+	ResourceID string `json:"resource_id,omitempty"`
+}
+
+// OperationStatus is the progress of an Operation
+type OperationStatus struct {
+	Done bool `json:"done"`
+	// Message describes the current step, shown as progress
+	Message string `json:"message,omitempty"`
+	// Resource is the created or updated resource once the operation is done
+	Resource *Resource `json:"resource,omitempty"`
+	// Error is set when the operation is done and failed
+	Error string `json:"error,omitempty"`
+	// Retryable is set when the failed operation may succeed if started
+	// again
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+// AsyncProvider is implemented by providers whose operations return before
+// they complete, declared with InterfaceAsync. The deployer starts
+// operations with it instead of the calls of ProviderPlugin and polls them
+// until they are done.
+type AsyncProvider interface {
+	StartCreate(ctx context.Context, spec ResourceSpec) (*Operation, error)
+	StartUpdate(ctx context.Context, id string, spec ResourceSpec) (*Operation, error)
+	StartDelete(ctx context.Context, id string) (*Operation, error)
+	// PollOperation reports the progress of an operation. An error means
+	// the status could not be read, not that the operation failed.
+	PollOperation(ctx context.Context, op Operation) (*OperationStatus, error)
+}
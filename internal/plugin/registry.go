@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IndexFile is the name of the index in a plugin registry directory
+const IndexFile = "index.json"
+
+// Index lists the releases of the plugins in a registry
+type Index struct {
+	Plugins map[string][]Release `json:"plugins"`
+
+	// location is where the index was read from, release URLs are relative
+	// to it
+	location string
+}
+
+// Release is a published build of a plugin
+type Release struct {
+	Version     string   `json:"version"`
+	APIVersion  int      `json:"api_version"`
+	Interfaces  []string `json:"interfaces"`
+	Description string   `json:"description,omitempty"`
+	// URL of the plugin binary, absolute or relative to the index
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Signature is an optional base64 ed25519 signature of the binary
+	Signature string `json:"signature,omitempty"`
+}
+
+// FetchIndex reads the index of a registry, which is either an HTTP(S) URL
+// or a local directory. The index is <source>/index.json unless the source
+// names a .json file itself.
+func FetchIndex(ctx context.Context, source string) (*Index, error) {
+	location := source
+	if !strings.HasSuffix(location, ".json") {
+		if isURL(source) {
+			location = strings.TrimSuffix(source, "/") + "/" + IndexFile
+		} else {
+			location = filepath.Join(source, IndexFile)
+		}
+	}
+
+	data, err := fetch(ctx, location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plugin index: %w", err)
+	}
+
+	index := &Index{location: location}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin index %s: %w", location, err)
+	}
+	return index, nil
+}
+
+// Resolve returns the latest release of a plugin matching the version
+// constraint and built for this plugin API version
+func (idx *Index) Resolve(name, constraint string) (*Release, error) {
+	releases, ok := idx.Plugins[name]
+	if !ok {
+		return nil, fmt.Errorf("plugin %s not found in %s", name, idx.location)
+	}
+
+	var latest *Release
+	incompatible := 0
+	for i := range releases {
+		r := &releases[i]
+		if !matchVersion(constraint, r.Version) {
+			continue
+		}
+		if r.APIVersion != APIVersion {
+			incompatible++
+			continue
+		}
+		if latest == nil || compareVersions(r.Version, latest.Version) > 0 {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		if incompatible > 0 {
+			return nil, fmt.Errorf("no release of plugin %s matching %q targets plugin API v%d", name, constraint, APIVersion)
+		}
+		return nil, fmt.Errorf("no release of plugin %s matches version %q", name, constraint)
+	}
+	return latest, nil
+}
+
+// Download fetches the binary of a release and verifies its checksum and,
+// when trusted keys are given, its signature
+func (idx *Index) Download(ctx context.Context, r *Release, trustedKeys []string) ([]byte, error) {
+	location, err := idx.resolveURL(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetch(ctx, location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download plugin: %w", err)
+	}
+
+	if err := VerifyChecksum(data, r.SHA256); err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	if len(trustedKeys) > 0 {
+		if err := VerifySignature(data, r.Signature, trustedKeys); err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+	}
+	return data, nil
+}
+
+// resolveURL makes a release URL absolute against the index location
+func (idx *Index) resolveURL(ref string) (string, error) {
+	if isURL(ref) || filepath.IsAbs(ref) {
+		return ref, nil
+	}
+	if !isURL(idx.location) {
+		return filepath.Join(filepath.Dir(idx.location), ref), nil
+	}
+
+	base, err := url.Parse(idx.location)
+	if err != nil {
+		return "", fmt.Errorf("invalid index URL: %w", err)
+	}
+	rel, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid release URL %q: %w", ref, err)
+	}
+	return base.ResolveReference(rel).String(), nil
+}
+
+// Checksum returns the hex SHA-256 checksum of a plugin binary
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChecksum checks a plugin binary against its expected checksum
+func VerifyChecksum(data []byte, expected string) error {
+	if expected == "" {
+		return fmt.Errorf("no checksum published")
+	}
+	if actual := Checksum(data); !strings.EqualFold(actual, strings.TrimPrefix(expected, "sha256:")) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// VerifySignature checks that a plugin binary was signed by one of the
+// trusted base64 ed25519 public keys. Invalid keys are skipped, so one bad
+// entry does not reject releases signed with another key.
+func VerifySignature(data []byte, signature string, trustedKeys []string) error {
+	if signature == "" {
+		return fmt.Errorf("release is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+
+	var invalid []string
+	for _, k := range trustedKeys {
+		pub, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			invalid = append(invalid, fmt.Sprintf("%q", k))
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(pub), data, sig) {
+			return nil
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("signature does not match any trusted key (invalid trusted keys: %s)", strings.Join(invalid, ", "))
+	}
+	return fmt.Errorf("signature does not match any trusted key")
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// fetch reads a local file or an HTTP(S) URL
+func fetch(ctx context.Context, location string) ([]byte, error) {
+	if !isURL(location) {
+		return os.ReadFile(location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,196 @@
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AttributeType is the type of a resource property value
+type AttributeType string
+
+const (
+	TypeString AttributeType = "string"
+	TypeNumber AttributeType = "number"
+	TypeBool   AttributeType = "bool"
+	TypeList   AttributeType = "list"
+	TypeMap    AttributeType = "map"
+	// TypeAny accepts any value
+	TypeAny AttributeType = "any"
+)
+
+// Attribute describes a property of a resource type
+type Attribute struct {
+	Type        AttributeType `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	// Computed attributes are set by the provider and cannot be configured
+	Computed bool `json:"computed,omitempty"`
+	// Sensitive values are never shown in plans
+	Sensitive bool `json:"sensitive,omitempty"`
+	// ForceNew attributes cannot be changed in place, the resource is
+	// replaced instead
+	ForceNew bool        `json:"force_new,omitempty"`
+	Default  interface{} `json:"default,omitempty"`
+}
+
+// ResourceSchema describes the properties of a resource type
+type ResourceSchema struct {
+	Description string               `json:"description,omitempty"`
+	Attributes  map[string]Attribute `json:"attributes"`
+	// Open schemas accept properties that are not described, which are
+	// neither type checked nor force a replacement
+	Open bool `json:"open,omitempty"`
+}
+
+// Schema describes the resource types of a provider
+type Schema struct {
+	Resources map[string]ResourceSchema `json:"resources"`
+}
+
+// SchemaProvider is implemented by plugins that describe their resources,
+// declared with InterfaceSchema. Schema must work before Init is called.
+type SchemaProvider interface {
+	Schema() *Schema
+}
+
+// PropertyError is a property that does not match the schema of its
+// resource type. Attribute is empty for errors about the resource type.
+type PropertyError struct {
+	Attribute string
+	Message   string
+}
+
+func (e PropertyError) Error() string {
+	if e.Attribute == "" {
+		return e.Message
+	}
+	return e.Attribute + ": " + e.Message
+}
+
+// Resource returns the schema of a resource type
+func (s *Schema) Resource(resourceType string) (ResourceSchema, bool) {
+	rs, ok := s.Resources[resourceType]
+	return rs, ok
+}
+
+// Types returns the resource types of the schema, sorted
+func (s *Schema) Types() []string {
+	types := make([]string, 0, len(s.Resources))
+	for t := range s.Resources {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Validate checks the properties of a resource against the schema of its
+// type. Strings referencing secrets or variables, such as ${secret.token},
+// are resolved later and match any type.
+func (s *Schema) Validate(resourceType string, props map[string]interface{}) []PropertyError {
+	rs, ok := s.Resource(resourceType)
+	if !ok {
+		return []PropertyError{{Message: fmt.Sprintf("unknown resource type %q (supported: %s)",
+			resourceType, strings.Join(s.Types(), ", "))}}
+	}
+
+	var errs []PropertyError
+	for _, name := range rs.names() {
+		attr := rs.Attributes[name]
+		v, set := props[name]
+		switch {
+		case set && attr.Computed:
+			errs = append(errs, PropertyError{name, "is computed by the provider and cannot be set"})
+		case !set && attr.Required && attr.Default == nil:
+			errs = append(errs, PropertyError{name, "is required"})
+		case set && !attr.Type.matches(v):
+			errs = append(errs, PropertyError{name, fmt.Sprintf("must be a %s", attr.Type)})
+		}
+	}
+
+	if !rs.Open {
+		for _, name := range sortedKeys(props) {
+			if _, known := rs.Attributes[name]; !known {
+				errs = append(errs, PropertyError{name, "is not a property of " + resourceType})
+			}
+		}
+	}
+	return errs
+}
+
+// ApplyDefaults returns a copy of props with the defaults of unset
+// attributes filled in
+func (rs ResourceSchema) ApplyDefaults(props map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		out[k] = v
+	}
+	for name, attr := range rs.Attributes {
+		if _, set := out[name]; !set && attr.Default != nil {
+			out[name] = attr.Default
+		}
+	}
+	if len(out) == 0 {
+		return props
+	}
+	return out
+}
+
+// Sensitive returns the sensitive attributes, sorted
+func (rs ResourceSchema) Sensitive() []string {
+	var attrs []string
+	for _, name := range rs.names() {
+		if rs.Attributes[name].Sensitive {
+			attrs = append(attrs, name)
+		}
+	}
+	return attrs
+}
+
+func (t AttributeType) matches(v interface{}) bool {
+	if s, ok := v.(string); ok && strings.Contains(s, "${") {
+		return true
+	}
+	switch t {
+	case TypeAny, "":
+		return true
+	case TypeString:
+		_, ok := v.(string)
+		return ok
+	case TypeBool:
+		_, ok := v.(bool)
+		return ok
+	case TypeNumber:
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	case TypeList:
+		return v != nil && reflect.ValueOf(v).Kind() == reflect.Slice
+	case TypeMap:
+		return v != nil && reflect.ValueOf(v).Kind() == reflect.Map
+	}
+	return false
+}
+
+// names returns the attribute names, sorted
+func (rs ResourceSchema) names() []string {
+	names := make([]string, 0, len(rs.Attributes))
+	for name := range rs.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -32,6 +32,8 @@ type ResourceSpec struct {
 	Type       string                 `json:"type"`
 	Name       string                 `json:"name"`
 	Properties map[string]interface{} `json:"properties"`
+	// Version is the version being deployed, if any
+	Version string `json:"version,omitempty"`
 }
 
 // Resource represents a managed resource
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersions orders dotted versions numerically, e.g. 1.10.0 after
+// 1.9.2. A leading "v" and pre-release or build suffixes are ignored.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, s := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// matchVersion reports whether a version satisfies a constraint. An empty
+// constraint matches any version, otherwise the constraint is a version
+// prefix: "1.2" matches 1.2.0 and 1.2.7 but not 1.20.0.
+func matchVersion(constraint, version string) bool {
+	constraint = strings.TrimPrefix(constraint, "v")
+	version = strings.TrimPrefix(version, "v")
+	if constraint == "" || constraint == version {
+		return true
+	}
+	return strings.HasPrefix(version, constraint+".")
+}
+
+// latestVersion returns the highest of the versions matching the
+// constraint, or "" when none does
+func latestVersion(constraint string, versions []string) string {
+	latest := ""
+	for _, v := range versions {
+		if matchVersion(constraint, v) && (latest == "" || compareVersions(v, latest) > 0) {
+			latest = v
+		}
+	}
+	return latest
+}
@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+var testVars = map[string]interface{}{
+	"environment": "prod",
+	"summary":     map[string]interface{}{"add": 1.0, "delete": 0.0},
+	"changes":     []interface{}{"db", "web"},
+	"change": map[string]interface{}{
+		"action":   "update",
+		"resource": "tmp-cache",
+		"after": map[string]interface{}{
+			"properties": map[string]interface{}{"size": "large", "tags": map[string]interface{}{"team": "web"}},
+		},
+	},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// && binds tighter than ||, ! tighter than both
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!false && false`, false},
+		{`!(false && false)`, true},
+		{`environment == "prod" && summary.delete == 0 || summary.add > 5`, true},
+		// || and && short-circuit, so the type error is never evaluated
+		{`true || 1`, true},
+		{`false && "x" < 1`, false},
+
+		{`environment in ["dev", "prod"]`, true},
+		{`environment in ["dev", "staging"]`, false},
+		{`"team" in change.after.properties.tags`, true},
+		{`"ro" in environment`, true},
+		{`"db" in missing`, false},
+
+		{`len(changes) == 2`, true},
+		{`len(environment) == 4`, true},
+		{`len(change.after.properties.tags) == 1`, true},
+		{`len(missing) == 0`, true},
+
+		{`contains(changes, "web")`, true},
+		{`contains(changes, "cache")`, false},
+		{`contains(change.resource, "cache")`, true},
+		{`matches(change.resource, "^tmp-")`, true},
+		{`matches(environment, "^tmp-")`, false},
+		{`matches(missing, ".*")`, false},
+		{`startswith(change.resource, 'tmp')`, true},
+		{`startswith(summary, "tmp")`, false},
+
+		// Missing fields are null, and ordering against null is false
+		{`missing.field == null`, true},
+		{`change.after.properties.missing != null`, false},
+		{`missing > 3 || missing <= 3`, false},
+		{`summary.add >= 1 && "a" < "b"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			got, err := e.Eval(testVars)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`environment < 1`, "cannot compare a string with a number"},
+		{`changes > 1`, "cannot compare a list"},
+		{`1 && true`, "&& expects booleans, got a number"},
+		{`false || "yes"`, "|| expects booleans, got a string"},
+		{`!environment`, "! expects a boolean, got a string"},
+		{`len(1) == 0`, "len: expects a string, list or mapping, got a number"},
+		{`"x" in 2`, "cannot look up values in a number"},
+		{`contains(true, "x")`, "contains: cannot look up values in a boolean"},
+		{`matches(environment, 1)`, "matches: expects a pattern string, got a number"},
+		{`matches(environment, "(")`, "matches: error parsing regexp"},
+		{`environment`, "expression evaluated to a string, not a boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			_, err = e.Eval(testVars)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Eval error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`(true`, `expected ")" at end of expression`},
+		{`true false`, `unexpected "false" at 5`},
+		{`size(changes) > 1`, "unknown function size at 0"},
+		{`len(changes, 1) > 1`, "len expects 1 argument(s), got 2"},
+		{`environment == "prod`, "unterminated string at 15"},
+		{`environment = "prod"`, `unexpected character '=' at 12`},
+		{`environment ==`, "unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Compile error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
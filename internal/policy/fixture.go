@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Test checks the policies against a fixture plan. Plan is either the path
+// of a plan document saved with `gort plan -o json`, relative to the policy
+// file, or the document inline.
+type Test struct {
+	Name   string             `yaml:"name"`
+	Plan   yaml.Node          `yaml:"plan"`
+	Config config.Environment `yaml:"config"`
+	// Expect lists the policies the plan must violate; none when empty
+	Expect []string `yaml:"expect"`
+
+	file string
+}
+
+// TestResult is the outcome of a policy test
+type TestResult struct {
+	Name    string `json:"name" yaml:"name" table:"TEST"`
+	File    string `json:"file" yaml:"file" table:",wide"`
+	Result  string `json:"result" yaml:"result" table:"RESULT,status"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+const (
+	TestPassed = "passed"
+	TestFailed = "failed"
+)
+
+// RunTests runs every test defined next to the policies
+func (s *Set) RunTests() []TestResult {
+	results := make([]TestResult, 0, len(s.Tests))
+	for _, t := range s.Tests {
+		result := TestResult{Name: t.Name, File: t.file, Result: TestPassed}
+		if err := s.run(t); err != nil {
+			result.Result = TestFailed
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s *Set) run(t Test) error {
+	plan, err := t.plan()
+	if err != nil {
+		return err
+	}
+
+	violations, err := s.Evaluate(Input{Plan: plan, Config: t.Config})
+	if err != nil {
+		return err
+	}
+
+	got := make(map[string]bool)
+	for _, v := range violations {
+		got[v.Policy] = true
+	}
+	want := make(map[string]bool)
+	for _, name := range t.Expect {
+		want[name] = true
+	}
+
+	var problems []string
+	for _, name := range sortedKeys(want) {
+		if !got[name] {
+			problems = append(problems, fmt.Sprintf("expected policy %s to be violated", name))
+		}
+	}
+	for _, name := range sortedKeys(got) {
+		if !want[name] {
+			problems = append(problems, fmt.Sprintf("unexpected violation of policy %s", name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (t Test) plan() (*core.PlanDocument, error) {
+	var doc core.PlanDocument
+	switch t.Plan.Kind {
+	case 0:
+		return nil, fmt.Errorf("plan is required")
+	case yaml.ScalarNode:
+		path := t.Plan.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(t.file), path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plan fixture: %w", err)
+		}
+		// YAML is a superset of JSON, so both formats are accepted
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse plan fixture %s: %w", path, err)
+		}
+	default:
+		if err := t.Plan.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to parse plan: %w", err)
+		}
+	}
+
+	if doc.FormatVersion > core.PlanFormatVersion {
+		return nil, fmt.Errorf("plan format version %d is newer than supported version %d",
+			doc.FormatVersion, core.PlanFormatVersion)
+	}
+	return &doc, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
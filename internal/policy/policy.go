@@ -0,0 +1,282 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/yahao333/gort/internal/config"
+	"github.com/yahao333/gort/internal/core"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDir is where policies are kept, relative to the configuration
+const DefaultDir = "policies"
+
+type Level string
+
+const (
+	// LevelAdvisory violations are reported as warnings
+	LevelAdvisory Level = "advisory"
+	// LevelMandatory violations block the deployment
+	LevelMandatory Level = "mandatory"
+)
+
+const (
+	// ScopePlan policies are evaluated once per plan
+	ScopePlan = "plan"
+	// ScopeChange policies are evaluated for every change, with the change
+	// available as `change`
+	ScopeChange = "change"
+)
+
+// Policy is a rule checked against a deployment plan. When the optional
+// When condition holds, Assert must hold too.
+type Policy struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Level       Level  `yaml:"level" json:"level"`
+	Scope       string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	When        string `yaml:"when,omitempty" json:"when,omitempty"`
+	Assert      string `yaml:"assert" json:"assert"`
+	Message     string `yaml:"message,omitempty" json:"message,omitempty"`
+
+	when, assert *Expr
+	file         string
+}
+
+// File is the format of a policy file
+type File struct {
+	Policies []Policy `yaml:"policies"`
+	Tests    []Test   `yaml:"tests"`
+}
+
+// Set is a compiled set of policies
+type Set struct {
+	Policies []*Policy
+	Tests    []Test
+	dir      string
+}
+
+// Load reads and compiles every *.yaml file in dir. A missing directory is
+// an empty set.
+func Load(dir string) (*Set, error) {
+	set := &Set{dir: dir}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+	sort.Strings(files)
+
+	names := make(map[string]string)
+	for _, file := range files {
+		f, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for i := range f.Policies {
+			p := &f.Policies[i]
+			p.file = file
+			if err := p.compile(); err != nil {
+				return nil, fmt.Errorf("%s: policy %s: %w", file, p.Name, err)
+			}
+			if other, exists := names[p.Name]; exists {
+				return nil, fmt.Errorf("%s: policy %s is already defined in %s", file, p.Name, other)
+			}
+			names[p.Name] = file
+			set.Policies = append(set.Policies, p)
+		}
+		for _, t := range f.Tests {
+			t.file = file
+			set.Tests = append(set.Tests, t)
+		}
+	}
+
+	return set, nil
+}
+
+func readFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var f File
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+func (p *Policy) compile() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch p.Level {
+	case "":
+		p.Level = LevelAdvisory
+	case LevelAdvisory, LevelMandatory:
+	default:
+		return fmt.Errorf("invalid level %q (expected advisory or mandatory)", p.Level)
+	}
+	switch p.Scope {
+	case "":
+		p.Scope = ScopePlan
+	case ScopePlan, ScopeChange:
+	default:
+		return fmt.Errorf("invalid scope %q (expected plan or change)", p.Scope)
+	}
+	if p.Assert == "" {
+		return fmt.Errorf("assert is required")
+	}
+
+	var err error
+	if p.When != "" {
+		if p.when, err = Compile(p.When); err != nil {
+			return fmt.Errorf("invalid when: %w", err)
+		}
+	}
+	if p.assert, err = Compile(p.Assert); err != nil {
+		return fmt.Errorf("invalid assert: %w", err)
+	}
+	return nil
+}
+
+// Input is what policies are evaluated against
+type Input struct {
+	Plan *core.PlanDocument
+	// Config is the configuration of the planned environment
+	Config config.Environment
+}
+
+// Violation is a policy that did not hold
+type Violation struct {
+	Policy   string `json:"policy" yaml:"policy"`
+	Level    Level  `json:"level" yaml:"level" table:"LEVEL,status"`
+	Resource string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// Results are the violations found by an evaluation
+type Results []Violation
+
+// Blocking reports whether any mandatory policy was violated
+func (r Results) Blocking() bool {
+	for _, v := range r {
+		if v.Level == LevelMandatory {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate checks every policy against the input
+func (s *Set) Evaluate(in Input) (Results, error) {
+	vars, err := variables(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var results Results
+	for _, p := range s.Policies {
+		if p.Scope == ScopePlan {
+			ok, err := p.check(vars)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				results = append(results, p.violation(""))
+			}
+			continue
+		}
+
+		changes, _ := vars["changes"].([]interface{})
+		for _, c := range changes {
+			scoped := make(map[string]interface{}, len(vars)+1)
+			for k, v := range vars {
+				scoped[k] = v
+			}
+			scoped["change"] = c
+			ok, err := p.check(scoped)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				resource, _ := c.(map[string]interface{})["resource"].(string)
+				results = append(results, p.violation(resource))
+			}
+		}
+	}
+	return results, nil
+}
+
+// check reports whether the policy holds
+func (p *Policy) check(vars map[string]interface{}) (bool, error) {
+	if p.when != nil {
+		applies, err := p.when.Eval(vars)
+		if err != nil {
+			return false, fmt.Errorf("policy %s: when: %w", p.Name, err)
+		}
+		if !applies {
+			return true, nil
+		}
+	}
+	ok, err := p.assert.Eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("policy %s: assert: %w", p.Name, err)
+	}
+	return ok, nil
+}
+
+func (p *Policy) violation(resource string) Violation {
+	msg := p.Message
+	if msg == "" {
+		msg = p.Description
+	}
+	if msg == "" {
+		msg = "assertion failed: " + p.Assert
+	}
+	return Violation{Policy: p.Name, Level: p.Level, Resource: resource, Message: msg}
+}
+
+// variables converts the input to the generic values expressions work on:
+// the plan document fields at the top level and the environment
+// configuration as `config`
+func variables(in Input) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	if in.Plan != nil {
+		data, err := json.Marshal(in.Plan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode plan: %w", err)
+		}
+		if err := json.Unmarshal(data, &vars); err != nil {
+			return nil, fmt.Errorf("failed to encode plan: %w", err)
+		}
+	}
+
+	// The configuration uses YAML field names, as in gort.yaml
+	data, err := yaml.Marshal(in.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	normalized, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(normalized, &generic); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	vars["config"] = generic
+	return vars, nil
+}
@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// DefaultHost is the Docker daemon socket used when neither the host
+// property nor DOCKER_HOST is set
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// client calls the Docker Engine HTTP API
+type client struct {
+	http *http.Client
+	// base is the URL API paths are appended to
+	base string
+}
+
+// APIError is an error response of the Docker daemon
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// transient reports whether a status means the daemon may succeed later
+func transient(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent reports whether sending a request twice has the effect of
+// sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// dialFailed reports whether err is a failure to connect, before anything
+// was sent to the daemon
+func dialFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isNotFound reports whether err, or an error it wraps, is a 404 of the
+// daemon
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// newClient returns a client for a daemon address: unix:///path/to.sock,
+// tcp://host:port or http(s)://host:port
+func newClient(host, apiVersion string) (*client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	c := &client{http: &http.Client{}}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		// The host name is ignored when dialing the socket
+		c.base = "http://docker"
+	case "tcp":
+		c.base = "http://" + u.Host
+	case "http", "https":
+		c.base = u.Scheme + "://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q (expected unix://, tcp:// or http(s)://)", host)
+	}
+
+	if apiVersion != "" {
+		c.base += "/" + strings.TrimPrefix(apiVersion, "/")
+	}
+	return c, nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out, if not nil
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode docker response: %w", err)
+	}
+	return nil
+}
+
+// stream sends a request whose response is a stream of JSON messages, such
+// as an image pull, and fails on the first error message
+func (c *client) stream(ctx context.Context, method, path string, query url.Values) error {
+	resp, err := c.send(ctx, method, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil && msg.Error != "" {
+			return &APIError{StatusCode: resp.StatusCode, Message: msg.Error}
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *client) send(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode docker request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to reach docker daemon: %w", err)
+		// A request that may have reached the daemon, such as a container
+		// create, is only sent again when repeating it is harmless
+		if idempotent(method) || dialFailed(err) {
+			return nil, plugin.Retryable(err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: msg.Message}
+		if transient(resp.StatusCode) {
+			return nil, plugin.Retryable(apiErr)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,568 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// Name is the name the provider is registered under
+const Name = "docker"
+
+const version = "1.0.0"
+
+// Resource types
+const (
+	TypeContainer = "container"
+	TypeNetwork   = "network"
+	TypeVolume    = "volume"
+)
+
+// resourceLabel marks the Docker objects managed by gort with the resource
+// name
+const resourceLabel = "io.gort.resource"
+
+const defaultHealthTimeout = 60 * time.Second
+
+func init() {
+	plugin.Register(Name, plugin.PluginMetadata{
+		Version:     version,
+		Author:      "gort",
+		Description: "Containers, networks and volumes of a Docker daemon",
+		Interfaces:  []string{plugin.InterfaceProvider, plugin.InterfaceSchema, plugin.InterfaceDiff},
+		Properties: map[string]string{
+			"host":        "Daemon address, default DOCKER_HOST or " + DefaultHost,
+			"api_version": "Engine API version, e.g. v1.43, default the daemon's",
+		},
+	}, New)
+}
+
+var (
+	nameAttribute = plugin.Attribute{
+		Type:        plugin.TypeString,
+		Description: "Docker name, default the resource name",
+		ForceNew:    true,
+	}
+	labelsAttribute = plugin.Attribute{
+		Type:        plugin.TypeMap,
+		Description: "Labels besides " + resourceLabel,
+	}
+)
+
+var schema = &plugin.Schema{
+	Resources: map[string]plugin.ResourceSchema{
+		TypeContainer: {
+			Description: "A container, recreated on every change",
+			Attributes: map[string]plugin.Attribute{
+				"image":          {Type: plugin.TypeString, Description: "Image to run", Required: true},
+				"pull":           {Type: plugin.TypeString, Description: "Image pull policy: missing, always or never", Default: "missing"},
+				"command":        {Type: plugin.TypeAny, Description: "Command, as a string or a list"},
+				"env":            {Type: plugin.TypeMap, Description: "Environment variables"},
+				"ports":          {Type: plugin.TypeMap, Description: "Host ports by container port, e.g. \"80/tcp\": 8080"},
+				"volumes":        {Type: plugin.TypeAny, Description: "Binds such as data:/var/lib/data, as a string or a list"},
+				"network":        {Type: plugin.TypeString, Description: "Network mode or network name"},
+				"restart":        {Type: plugin.TypeString, Description: "Restart policy, e.g. unless-stopped"},
+				"health_timeout": {Type: plugin.TypeString, Description: "How long to wait for the container to become healthy", Default: defaultHealthTimeout.String()},
+				"name":           nameAttribute,
+				"labels":         labelsAttribute,
+			},
+		},
+		TypeNetwork: {
+			Description: "A network, recreated on every change",
+			Attributes: map[string]plugin.Attribute{
+				"driver": {Type: plugin.TypeString, Description: "Network driver", Default: "bridge", ForceNew: true},
+				"name":   nameAttribute,
+				"labels": labelsAttribute,
+			},
+		},
+		TypeVolume: {
+			Description: "A volume, whose data survives updates",
+			Attributes: map[string]plugin.Attribute{
+				"driver": {Type: plugin.TypeString, Description: "Volume driver", Default: "local", ForceNew: true},
+				"name":   nameAttribute,
+				"labels": labelsAttribute,
+			},
+		},
+	},
+}
+
+// Provider manages Docker objects through the Engine API. Resource IDs are
+// <type>/<docker id>.
+type Provider struct {
+	client *client
+	// poll is the interval of health checks
+	poll time.Duration
+}
+
+// New creates the provider
+func New() plugin.Plugin {
+	return &Provider{poll: 500 * time.Millisecond}
+}
+
+func (p *Provider) Init(config map[string]interface{}) error {
+	host, _ := config["host"].(string)
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	apiVersion, _ := config["api_version"].(string)
+
+	c, err := newClient(host, apiVersion)
+	if err != nil {
+		return err
+	}
+	p.client = c
+	return nil
+}
+
+func (p *Provider) Name() string    { return Name }
+func (p *Provider) Version() string { return version }
+
+func (p *Provider) Schema() *plugin.Schema { return schema }
+
+func (p *Provider) Shutdown(ctx context.Context) error { return nil }
+
+func (p *Provider) CreateResource(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	switch spec.Type {
+	case TypeContainer:
+		return p.createContainer(ctx, spec)
+	case TypeNetwork:
+		return p.createNetwork(ctx, spec)
+	case TypeVolume:
+		return p.createVolume(ctx, spec)
+	default:
+		return nil, fmt.Errorf("unsupported resource type %q (expected %s, %s or %s)", spec.Type, TypeContainer, TypeNetwork, TypeVolume)
+	}
+}
+
+// UpdateResource recreates containers and networks, which Docker cannot
+// change in place. Volumes keep their data and cannot change.
+func (p *Provider) UpdateResource(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	typ, _, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if typ != spec.Type {
+		return nil, fmt.Errorf("cannot change resource %s from %s to %s", spec.Name, typ, spec.Type)
+	}
+
+	if typ == TypeVolume {
+		current, err := p.GetResource(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if driver := stringProperty(spec.Properties, "driver", "local"); current.Properties["driver"] != driver {
+			return nil, fmt.Errorf("cannot change the driver of volume %s, remove the resource and add it again", spec.Name)
+		}
+		return current, nil
+	}
+
+	if err := p.DeleteResource(ctx, id); err != nil {
+		return nil, err
+	}
+	return p.CreateResource(ctx, spec)
+}
+
+// Diff plans every change of a container or network as a replacement,
+// since Docker cannot change them in place
+func (p *Provider) Diff(ctx context.Context, current plugin.Resource, desired plugin.ResourceSpec) (*plugin.ResourceDiff, error) {
+	rs := schema.Resources[desired.Type]
+	diff := plugin.StructuralDiff(current, desired, &rs)
+	if desired.Type != TypeVolume {
+		for i := range diff.Changes {
+			diff.Changes[i].RequiresReplace = true
+		}
+	}
+	return diff, nil
+}
+
+func (p *Provider) DeleteResource(ctx context.Context, id string) error {
+	typ, dockerID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	ref := url.PathEscape(dockerID)
+
+	switch typ {
+	case TypeContainer:
+		// Stopping a stopped container answers 304
+		err = p.client.do(ctx, http.MethodPost, "/containers/"+ref+"/stop", nil, nil, nil)
+		if err == nil || isNotFound(err) {
+			err = p.client.do(ctx, http.MethodDelete, "/containers/"+ref, url.Values{"force": {"true"}}, nil, nil)
+		}
+	case TypeNetwork:
+		err = p.client.do(ctx, http.MethodDelete, "/networks/"+ref, nil, nil, nil)
+	case TypeVolume:
+		err = p.client.do(ctx, http.MethodDelete, "/volumes/"+ref, nil, nil, nil)
+	default:
+		return fmt.Errorf("unsupported resource type %q", typ)
+	}
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", id, err)
+	}
+	return nil
+}
+
+func (p *Provider) GetResource(ctx context.Context, id string) (*plugin.Resource, error) {
+	typ, dockerID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	ref := url.PathEscape(dockerID)
+
+	switch typ {
+	case TypeContainer:
+		c, err := p.inspectContainer(ctx, dockerID)
+		if err != nil {
+			return nil, err
+		}
+		return c.resource(), nil
+
+	case TypeNetwork:
+		var n networkInfo
+		if err := p.client.do(ctx, http.MethodGet, "/networks/"+ref, nil, nil, &n); err != nil {
+			return nil, fmt.Errorf("failed to inspect network %s: %w", dockerID, err)
+		}
+		return n.resource(), nil
+
+	case TypeVolume:
+		var v volumeInfo
+		if err := p.client.do(ctx, http.MethodGet, "/volumes/"+ref, nil, nil, &v); err != nil {
+			return nil, fmt.Errorf("failed to inspect volume %s: %w", dockerID, err)
+		}
+		return v.resource(), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported resource type %q", typ)
+	}
+}
+
+func (p *Provider) createContainer(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	image := stringProperty(spec.Properties, "image", "")
+	if image == "" {
+		return nil, fmt.Errorf("container %s needs an image", spec.Name)
+	}
+	timeout := defaultHealthTimeout
+	if s := stringProperty(spec.Properties, "health_timeout", ""); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health_timeout %q", s)
+		}
+		timeout = d
+	}
+	if err := p.pullImage(ctx, image, stringProperty(spec.Properties, "pull", "missing")); err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"Image":  image,
+		"Labels": labels(spec),
+	}
+	if cmd := stringList(spec.Properties["command"]); len(cmd) > 0 {
+		body["Cmd"] = cmd
+	}
+	if env, ok := spec.Properties["env"].(map[string]interface{}); ok {
+		vars := make([]string, 0, len(env))
+		for k, v := range env {
+			vars = append(vars, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(vars)
+		body["Env"] = vars
+	}
+
+	hostConfig := map[string]interface{}{}
+	if ports, ok := spec.Properties["ports"].(map[string]interface{}); ok {
+		exposed := make(map[string]struct{})
+		bindings := make(map[string][]map[string]string)
+		for containerPort, hostPort := range ports {
+			if !strings.Contains(containerPort, "/") {
+				containerPort += "/tcp"
+			}
+			exposed[containerPort] = struct{}{}
+			bindings[containerPort] = []map[string]string{{"HostPort": fmt.Sprint(hostPort)}}
+		}
+		body["ExposedPorts"] = exposed
+		hostConfig["PortBindings"] = bindings
+	}
+	if binds := stringList(spec.Properties["volumes"]); len(binds) > 0 {
+		hostConfig["Binds"] = binds
+	}
+	if network := stringProperty(spec.Properties, "network", ""); network != "" {
+		hostConfig["NetworkMode"] = network
+	}
+	if restart := stringProperty(spec.Properties, "restart", ""); restart != "" {
+		hostConfig["RestartPolicy"] = map[string]string{"Name": restart}
+	}
+	body["HostConfig"] = hostConfig
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	name := stringProperty(spec.Properties, "name", spec.Name)
+	if err := p.client.do(ctx, http.MethodPost, "/containers/create", url.Values{"name": {name}}, body, &created); err != nil {
+		return nil, fmt.Errorf("failed to create container %s: %w", name, err)
+	}
+	if err := p.client.do(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil); err != nil {
+		return nil, p.removeFailed(ctx, created.ID, fmt.Errorf("failed to start container %s: %w", name, err))
+	}
+
+	c, err := p.waitHealthy(ctx, created.ID, timeout)
+	if err != nil {
+		return nil, p.removeFailed(ctx, created.ID, fmt.Errorf("container %s did not become healthy: %w", name, err))
+	}
+	return c.resource(), nil
+}
+
+// removeFailed force-removes a container that was created but failed to
+// start or become healthy, so that it is neither left running untracked nor
+// blocks its name on the next attempt. It returns err, noting a failed
+// removal, after which the create is not retried.
+func (p *Provider) removeFailed(ctx context.Context, id string, err error) error {
+	// The create may have failed because ctx was cancelled or timed out
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	query := url.Values{"force": {"true"}}
+	if rmErr := p.client.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), query, nil, nil); rmErr != nil && !isNotFound(rmErr) {
+		// Creating the container again would fail on its name
+		return plugin.Permanent(fmt.Errorf("%w (failed to remove container %s: %v)", err, id, rmErr))
+	}
+	return err
+}
+
+// pullImage pulls an image according to the pull policy: always, missing
+// or never
+func (p *Provider) pullImage(ctx context.Context, image, policy string) error {
+	switch policy {
+	case "never":
+		return nil
+	case "missing":
+		err := p.client.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+		if err == nil {
+			return nil
+		}
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to inspect image %s: %w", image, err)
+		}
+	case "always":
+	default:
+		return fmt.Errorf("invalid pull policy %q (expected always, missing or never)", policy)
+	}
+
+	query := url.Values{"fromImage": {image}}
+	if repo, tag, ok := splitTag(image); ok {
+		query = url.Values{"fromImage": {repo}, "tag": {tag}}
+	}
+	if err := p.client.stream(ctx, http.MethodPost, "/images/create", query); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	return nil
+}
+
+// waitHealthy polls a started container until its health check passes, or
+// until it runs when it has none
+func (p *Provider) waitHealthy(ctx context.Context, id string, timeout time.Duration) (*containerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		c, err := p.inspectContainer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c.State.Health != nil && c.State.Health.Status == "healthy":
+			return c, nil
+		case c.State.Health != nil && c.State.Health.Status == "unhealthy":
+			return nil, fmt.Errorf("health check failed")
+		case c.State.Health == nil && c.State.Running:
+			return c, nil
+		case c.State.Status == "exited" || c.State.Status == "dead":
+			return nil, fmt.Errorf("container %s with exit code %d", c.State.Status, c.State.ExitCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out after %s", timeout)
+		case <-time.After(p.poll):
+		}
+	}
+}
+
+func (p *Provider) inspectContainer(ctx context.Context, id string) (*containerInfo, error) {
+	var c containerInfo
+	if err := p.client.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, &c); err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+	return &c, nil
+}
+
+func (p *Provider) createNetwork(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	name := stringProperty(spec.Properties, "name", spec.Name)
+	body := map[string]interface{}{
+		"Name":           name,
+		"Driver":         stringProperty(spec.Properties, "driver", "bridge"),
+		"Labels":         labels(spec),
+		"CheckDuplicate": true,
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := p.client.do(ctx, http.MethodPost, "/networks/create", nil, body, &created); err != nil {
+		return nil, fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+	return p.GetResource(ctx, TypeNetwork+"/"+created.ID)
+}
+
+func (p *Provider) createVolume(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	name := stringProperty(spec.Properties, "name", spec.Name)
+	body := map[string]interface{}{
+		"Name":   name,
+		"Driver": stringProperty(spec.Properties, "driver", "local"),
+		"Labels": labels(spec),
+	}
+
+	var v volumeInfo
+	if err := p.client.do(ctx, http.MethodPost, "/volumes/create", nil, body, &v); err != nil {
+		return nil, fmt.Errorf("failed to create volume %s: %w", name, err)
+	}
+	return v.resource(), nil
+}
+
+type containerInfo struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Image  string `json:"Image"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status   string `json:"Status"`
+		Running  bool   `json:"Running"`
+		ExitCode int    `json:"ExitCode"`
+		Health   *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+func (c *containerInfo) resource() *plugin.Resource {
+	status := c.State.Status
+	if c.State.Health != nil {
+		status = c.State.Health.Status
+	}
+	return &plugin.Resource{
+		ID:   TypeContainer + "/" + c.ID,
+		Type: TypeContainer,
+		Name: c.Config.Labels[resourceLabel],
+		Properties: map[string]interface{}{
+			"name":  strings.TrimPrefix(c.Name, "/"),
+			"image": c.Config.Image,
+		},
+		Status: status,
+	}
+}
+
+type networkInfo struct {
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver"`
+	Labels map[string]string `json:"Labels"`
+}
+
+func (n *networkInfo) resource() *plugin.Resource {
+	return &plugin.Resource{
+		ID:   TypeNetwork + "/" + n.ID,
+		Type: TypeNetwork,
+		Name: n.Labels[resourceLabel],
+		Properties: map[string]interface{}{
+			"name":   n.Name,
+			"driver": n.Driver,
+		},
+		Status: "available",
+	}
+}
+
+type volumeInfo struct {
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	Mountpoint string            `json:"Mountpoint"`
+	Labels     map[string]string `json:"Labels"`
+}
+
+func (v *volumeInfo) resource() *plugin.Resource {
+	return &plugin.Resource{
+		ID:   TypeVolume + "/" + v.Name,
+		Type: TypeVolume,
+		Name: v.Labels[resourceLabel],
+		Properties: map[string]interface{}{
+			"name":       v.Name,
+			"driver":     v.Driver,
+			"mountpoint": v.Mountpoint,
+		},
+		Status: "available",
+	}
+}
+
+func parseID(id string) (typ, dockerID string, err error) {
+	typ, dockerID, ok := strings.Cut(id, "/")
+	if !ok || dockerID == "" {
+		return "", "", fmt.Errorf("invalid resource ID %q", id)
+	}
+	return typ, dockerID, nil
+}
+
+// labels returns the user labels of a resource with the gort label
+func labels(spec plugin.ResourceSpec) map[string]string {
+	out := map[string]string{resourceLabel: spec.Name}
+	if l, ok := spec.Properties["labels"].(map[string]interface{}); ok {
+		for k, v := range l {
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+// splitTag splits repo:tag, leaving registry ports and digests alone
+func splitTag(image string) (repo, tag string, ok bool) {
+	if strings.Contains(image, "@") {
+		return "", "", false
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return "", "", false
+	}
+	return image[:i], image[i+1:], true
+}
+
+func stringProperty(props map[string]interface{}, key, def string) string {
+	if s, ok := props[key].(string); ok && s != "" {
+		return s
+	}
+	return def
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			out = append(out, fmt.Sprint(e))
+		}
+		return out
+	}
+	return nil
+}
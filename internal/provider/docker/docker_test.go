@@ -0,0 +1,267 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// fakeDaemon answers the subset of the Engine API used by the provider on a
+// unix socket
+type fakeDaemon struct {
+	mu sync.Mutex
+	// containers holds the state of each container by ID
+	containers map[string]string
+	// startStatus, when set, is the status answered to container starts
+	startStatus int
+	// health is the health status reported for containers, or empty when
+	// they have no health check
+	health string
+	// requests lists the requests received, as "METHOD /path"
+	requests []string
+	nextID   int
+}
+
+func newFakeDaemon(t *testing.T) (*fakeDaemon, *Provider) {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, which the test's own
+	// temporary directory may exceed
+	dir, err := os.MkdirTemp("", "gort-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDaemon{containers: make(map[string]string)}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(d.serve))
+	server.Listener = l
+	server.Start()
+	t.Cleanup(server.Close)
+
+	p := New().(*Provider)
+	if err := p.Init(map[string]interface{}{"host": "unix://" + socket, "api_version": "v1.43"}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	p.poll = time.Millisecond
+	return d, p
+}
+
+func (d *fakeDaemon) serve(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests = append(d.requests, r.Method+" "+r.URL.Path)
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1.43")
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/images/"):
+		w.Write([]byte("{}"))
+
+	case r.Method == http.MethodPost && path == "/containers/create":
+		d.nextID++
+		id := fmt.Sprintf("c%d", d.nextID)
+		d.containers[id] = "created"
+		json.NewEncoder(w).Encode(map[string]string{"Id": id})
+
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/start"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/start")
+		if d.startStatus != 0 {
+			w.WriteHeader(d.startStatus)
+			json.NewEncoder(w).Encode(map[string]string{"message": "port is already allocated"})
+			return
+		}
+		d.containers[id] = "running"
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+		status, ok := d.containers[id]
+		if !ok {
+			d.notFound(w, id)
+			return
+		}
+		state := map[string]interface{}{"Status": status, "Running": status == "running"}
+		if d.health != "" {
+			state["Health"] = map[string]string{"Status": d.health}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":     id,
+			"Name":   "/" + id,
+			"Config": map[string]interface{}{"Image": "nginx", "Labels": map[string]string{resourceLabel: "web"}},
+			"State":  state,
+		})
+
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/stop"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/stop")
+		if _, ok := d.containers[id]; !ok {
+			d.notFound(w, id)
+			return
+		}
+		d.containers[id] = "exited"
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/containers/"):
+		id := strings.TrimPrefix(path, "/containers/")
+		if _, ok := d.containers[id]; !ok {
+			d.notFound(w, id)
+			return
+		}
+		delete(d.containers, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"message": "unexpected request"}`, http.StatusBadRequest)
+	}
+}
+
+func (d *fakeDaemon) notFound(w http.ResponseWriter, id string) {
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{"message": "No such container: " + id})
+}
+
+func (d *fakeDaemon) remaining() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.containers)
+}
+
+func containerSpec() plugin.ResourceSpec {
+	return plugin.ResourceSpec{
+		Name:       "web",
+		Type:       TypeContainer,
+		Properties: map[string]interface{}{"image": "nginx", "health_timeout": "200ms"},
+	}
+}
+
+func TestCreateContainer(t *testing.T) {
+	d, p := newFakeDaemon(t)
+	d.health = "healthy"
+
+	res, err := p.CreateResource(context.Background(), containerSpec())
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	if res.ID != "container/c1" || res.Name != "web" || res.Status != "healthy" {
+		t.Errorf("resource = %+v", res)
+	}
+
+	if err := p.DeleteResource(context.Background(), res.ID); err != nil {
+		t.Fatalf("DeleteResource: %v", err)
+	}
+	if n := d.remaining(); n != 0 {
+		t.Errorf("%d container(s) left after delete", n)
+	}
+}
+
+func TestCreateContainerRemovesFailedContainer(t *testing.T) {
+	tests := []struct {
+		name        string
+		startStatus int
+		health      string
+		wantErr     string
+	}{
+		{name: "start fails", startStatus: http.StatusInternalServerError, wantErr: "failed to start container web"},
+		{name: "unhealthy", health: "unhealthy", wantErr: "did not become healthy"},
+		{name: "never healthy", health: "starting", wantErr: "did not become healthy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, p := newFakeDaemon(t)
+			d.startStatus = tt.startStatus
+			d.health = tt.health
+
+			_, err := p.CreateResource(context.Background(), containerSpec())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CreateResource error = %v, want %q", err, tt.wantErr)
+			}
+			if n := d.remaining(); n != 0 {
+				t.Errorf("%d failed container(s) were left behind", n)
+			}
+		})
+	}
+}
+
+func TestCreateContainerRejectsBadTimeoutBeforeCreating(t *testing.T) {
+	d, p := newFakeDaemon(t)
+	spec := containerSpec()
+	spec.Properties["health_timeout"] = "soon"
+
+	if _, err := p.CreateResource(context.Background(), spec); err == nil || !strings.Contains(err.Error(), "invalid health_timeout") {
+		t.Fatalf("CreateResource error = %v, want an invalid health_timeout", err)
+	}
+	if len(d.requests) != 0 {
+		t.Errorf("daemon received %v", d.requests)
+	}
+}
+
+func TestDeleteMissingContainer(t *testing.T) {
+	_, p := newFakeDaemon(t)
+	if err := p.DeleteResource(context.Background(), "container/gone"); err != nil {
+		t.Errorf("DeleteResource of a missing container: %v", err)
+	}
+}
+
+func TestGetMissingContainerIsNotFound(t *testing.T) {
+	_, p := newFakeDaemon(t)
+	_, err := p.GetResource(context.Background(), "container/gone")
+	if err == nil || !isNotFound(err) {
+		t.Errorf("GetResource error = %v, want a wrapped 404", err)
+	}
+}
+
+func TestTransportFailureRetryable(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gort-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+
+	// Nothing listens on the socket, so no request reaches a daemon
+	c, err := newClient("unix://"+socket, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.do(context.Background(), http.MethodPost, "/containers/create", nil, nil, nil)
+	if err == nil || !plugin.IsRetryable(err) {
+		t.Errorf("create without a daemon: error = %v, want retryable", err)
+	}
+
+	// The daemon drops the connection after reading the request, which
+	// may have created the container
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	server.Listener = l
+	server.Start()
+	defer server.Close()
+
+	err = c.do(context.Background(), http.MethodPost, "/containers/create", nil, nil, nil)
+	if err == nil || plugin.IsRetryable(err) {
+		t.Errorf("create with a dropped connection: error = %v, want not retryable", err)
+	}
+	err = c.do(context.Background(), http.MethodGet, "/containers/c1/json", nil, nil, nil)
+	if err == nil || !plugin.IsRetryable(err) {
+		t.Errorf("inspect with a dropped connection: error = %v, want retryable", err)
+	}
+}
@@ -0,0 +1,207 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// In-cluster service account credentials
+const (
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// client calls the Kubernetes API
+type client struct {
+	http   *http.Client
+	server string
+	token  string
+
+	mu sync.Mutex
+	// resources caches the API resources of every group version
+	resources map[string][]apiResource
+}
+
+// APIError is a failure status returned by the API server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("kubernetes: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type apiResource struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Namespaced bool   `json:"namespaced"`
+}
+
+// clientConfig holds the connection settings of the provider
+type clientConfig struct {
+	Server    string
+	Token     string
+	TokenFile string
+	CAFile    string
+	Insecure  bool
+}
+
+// newClient connects to the configured server, or to the cluster gort runs
+// in when no server is configured
+func newClient(cfg clientConfig) (*client, error) {
+	if cfg.Server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("no server configured and not running in a cluster")
+		}
+		cfg.Server = "https://" + host + ":" + port
+		if cfg.TokenFile == "" {
+			cfg.TokenFile = serviceAccountToken
+		}
+		if cfg.CAFile == "" {
+			cfg.CAFile = serviceAccountCA
+		}
+	}
+
+	token := cfg.Token
+	if token == "" && cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &client{
+		http:      &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		server:    strings.TrimSuffix(cfg.Server, "/"),
+		token:     token,
+		resources: make(map[string][]apiResource),
+	}, nil
+}
+
+// do sends a request and decodes the JSON response into out, if not nil
+func (c *client) do(ctx context.Context, method, path string, query url.Values, contentType string, body []byte, out interface{}) error {
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return plugin.Retryable(fmt.Errorf("failed to reach the API server: %w", err))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read API response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: status.Message}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			// The API server asks throttled clients to wait with Retry-After
+			seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			return plugin.RetryableAfter(apiErr, time.Duration(seconds)*time.Second)
+		}
+		return apiErr
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode API response: %w", err)
+		}
+	}
+	return nil
+}
+
+// resourceFor finds the API resource serving a kind through discovery
+func (c *client) resourceFor(ctx context.Context, apiVersion, kind string) (*apiResource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resources, cached := c.resources[apiVersion]
+	if !cached {
+		var list struct {
+			Resources []apiResource `json:"resources"`
+		}
+		if err := c.do(ctx, http.MethodGet, groupVersionPath(apiVersion), nil, "", nil, &list); err != nil {
+			return nil, fmt.Errorf("failed to discover %s: %w", apiVersion, err)
+		}
+		resources = list.Resources
+		c.resources[apiVersion] = resources
+	}
+
+	for i := range resources {
+		// Subresources such as deployments/status share the kind
+		if resources[i].Kind == kind && !strings.Contains(resources[i].Name, "/") {
+			return &resources[i], nil
+		}
+	}
+	return nil, fmt.Errorf("kind %s is not served by %s", kind, apiVersion)
+}
+
+// groupVersionPath is the API path of a group version: /api/v1 for the
+// core group, /apis/<group>/<version> otherwise
+func groupVersionPath(apiVersion string) string {
+	if !strings.Contains(apiVersion, "/") {
+		return "/api/" + apiVersion
+	}
+	return "/apis/" + apiVersion
+}
@@ -0,0 +1,453 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/template"
+	"gopkg.in/yaml.v3"
+)
+
+// Name is the name the provider is registered under
+const Name = "kubernetes"
+
+const version = "1.0.0"
+
+// TypeManifest is a resource made of the objects of a YAML manifest
+const TypeManifest = "manifest"
+
+// FieldManager owns the fields applied by gort
+const FieldManager = "gort"
+
+const defaultWaitTimeout = 5 * time.Minute
+
+func init() {
+	plugin.Register(Name, plugin.PluginMetadata{
+		Version:     version,
+		Author:      "gort",
+		Description: "Kubernetes manifests applied with server-side apply",
+		Interfaces:  []string{plugin.InterfaceProvider, plugin.InterfaceSchema},
+		Properties: map[string]string{
+			"server":     "API server URL, default the cluster gort runs in",
+			"token":      "Bearer token",
+			"token_file": "File holding the bearer token",
+			"ca_file":    "CA certificate of the API server",
+			"insecure":   "Skip verifying the API server certificate",
+			"namespace":  "Namespace of namespaced objects without one, default \"default\"",
+		},
+	}, New)
+}
+
+var schema = &plugin.Schema{
+	Resources: map[string]plugin.ResourceSchema{
+		TypeManifest: {
+			Description: "The objects of a YAML manifest, pruned when removed from it",
+			Attributes: map[string]plugin.Attribute{
+				"manifest":     {Type: plugin.TypeAny, Description: "Inline manifest, as YAML text or a single object"},
+				"file":         {Type: plugin.TypeString, Description: "Manifest file, when manifest is not set"},
+				"vars":         {Type: plugin.TypeMap, Description: "Template variables; the manifest is rendered when set"},
+				"template":     {Type: plugin.TypeBool, Description: "Render the manifest as a template without variables"},
+				"wait":         {Type: plugin.TypeBool, Description: "Wait for workloads to roll out", Default: true},
+				"wait_timeout": {Type: plugin.TypeString, Description: "How long to wait for the rollout", Default: defaultWaitTimeout.String()},
+				"objects":      {Type: plugin.TypeList, Description: "Applied objects as apiVersion:kind:namespace:name", Computed: true},
+			},
+		},
+	},
+}
+
+// Provider applies the objects of manifests with server-side apply. A
+// resource ID lists its objects as apiVersion:kind:namespace:name, comma
+// separated.
+type Provider struct {
+	client    *client
+	namespace string
+	// poll is the interval of rollout checks
+	poll time.Duration
+}
+
+// New creates the provider
+func New() plugin.Plugin {
+	return &Provider{namespace: "default", poll: 2 * time.Second}
+}
+
+func (p *Provider) Init(config map[string]interface{}) error {
+	cfg := clientConfig{
+		Server:    stringProperty(config, "server", ""),
+		Token:     stringProperty(config, "token", ""),
+		TokenFile: stringProperty(config, "token_file", ""),
+		CAFile:    stringProperty(config, "ca_file", ""),
+	}
+	cfg.Insecure, _ = config["insecure"].(bool)
+	p.namespace = stringProperty(config, "namespace", p.namespace)
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	p.client = c
+	return nil
+}
+
+func (p *Provider) Name() string    { return Name }
+func (p *Provider) Version() string { return version }
+
+func (p *Provider) Schema() *plugin.Schema { return schema }
+
+func (p *Provider) Shutdown(ctx context.Context) error { return nil }
+
+func (p *Provider) CreateResource(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	return p.apply(ctx, spec, nil)
+}
+
+// UpdateResource applies the manifest and prunes the objects that were
+// removed from it
+func (p *Provider) UpdateResource(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	previous, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.apply(ctx, spec, previous)
+}
+
+func (p *Provider) DeleteResource(ctx context.Context, id string) error {
+	refs, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	// Delete in reverse order, so namespaces go last
+	for i := len(refs) - 1; i >= 0; i-- {
+		if err := p.delete(ctx, refs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Provider) GetResource(ctx context.Context, id string) (*plugin.Resource, error) {
+	refs, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &plugin.Resource{ID: id, Type: TypeManifest, Status: "ready"}
+	objects := make([]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		obj, err := p.get(ctx, ref)
+		if isNotFound(err) {
+			res.Status = "missing"
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if res.Status == "ready" && !rolledOut(obj) {
+			res.Status = "progressing"
+		}
+		objects = append(objects, obj)
+	}
+	res.Properties = map[string]interface{}{"objects": objects}
+	return res, nil
+}
+
+// apply applies every object of the manifest, prunes the previous objects
+// missing from it and waits for rollouts
+func (p *Provider) apply(ctx context.Context, spec plugin.ResourceSpec, previous []objectRef) (*plugin.Resource, error) {
+	if spec.Type != TypeManifest {
+		return nil, fmt.Errorf("unsupported resource type %q (expected %s)", spec.Type, TypeManifest)
+	}
+	objects, err := p.manifest(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s: %w", spec.Name, err)
+	}
+
+	refs := make([]objectRef, 0, len(objects))
+	applied := make(map[objectRef]bool, len(objects))
+	for _, obj := range objects {
+		ref, err := p.applyObject(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+		applied[ref] = true
+	}
+
+	for i := len(previous) - 1; i >= 0; i-- {
+		if !applied[previous[i]] {
+			if err := p.delete(ctx, previous[i]); err != nil {
+				return nil, fmt.Errorf("failed to prune %s: %w", previous[i], err)
+			}
+		}
+	}
+
+	if wait, ok := spec.Properties["wait"].(bool); !ok || wait {
+		timeout := defaultWaitTimeout
+		if s := stringProperty(spec.Properties, "wait_timeout", ""); s != "" {
+			if timeout, err = time.ParseDuration(s); err != nil {
+				return nil, fmt.Errorf("invalid wait_timeout %q", s)
+			}
+		}
+		if err := p.waitRollout(ctx, refs, timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, len(refs))
+	for i, ref := range refs {
+		ids[i] = ref.String()
+	}
+	return &plugin.Resource{
+		ID:         strings.Join(ids, ","),
+		Type:       TypeManifest,
+		Name:       spec.Name,
+		Properties: map[string]interface{}{"objects": ids},
+		Status:     "ready",
+	}, nil
+}
+
+// manifest returns the objects of the resource's manifest, inline or read
+// from a file, rendered as a template when vars are set or template is true
+func (p *Provider) manifest(spec plugin.ResourceSpec) ([]map[string]interface{}, error) {
+	vars, hasVars := spec.Properties["vars"].(map[string]interface{})
+	render, _ := spec.Properties["template"].(bool)
+	render = render || hasVars
+	data := &template.TemplateData{Variables: vars}
+
+	var text string
+	switch m := spec.Properties["manifest"].(type) {
+	case string:
+		text = m
+		if render {
+			var err error
+			if text, err = template.Render(spec.Name, text, data); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		return []map[string]interface{}{m}, nil
+	case nil:
+		file := stringProperty(spec.Properties, "file", "")
+		if file == "" {
+			return nil, fmt.Errorf("a manifest or file property is required")
+		}
+		var err error
+		if render {
+			if text, err = template.RenderTemplate(file, data); err != nil {
+				return nil, err
+			}
+		} else {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read manifest: %w", err)
+			}
+			text = string(content)
+		}
+	default:
+		return nil, fmt.Errorf("manifest must be YAML text or an object")
+	}
+
+	var objects []map[string]interface{}
+	decoder := yaml.NewDecoder(strings.NewReader(text))
+	for {
+		var obj map[string]interface{}
+		err := decoder.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(obj) > 0 {
+			objects = append(objects, obj)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no objects found")
+	}
+	return objects, nil
+}
+
+// applyObject applies an object with server-side apply
+func (p *Provider) applyObject(ctx context.Context, obj map[string]interface{}) (objectRef, error) {
+	ref := objectRef{}
+	ref.APIVersion, _ = obj["apiVersion"].(string)
+	ref.Kind, _ = obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	ref.Name, _ = metadata["name"].(string)
+	ref.Namespace, _ = metadata["namespace"].(string)
+	if ref.APIVersion == "" || ref.Kind == "" || ref.Name == "" {
+		return ref, fmt.Errorf("object needs apiVersion, kind and metadata.name")
+	}
+
+	res, err := p.client.resourceFor(ctx, ref.APIVersion, ref.Kind)
+	if err != nil {
+		return ref, err
+	}
+	if res.Namespaced && ref.Namespace == "" {
+		ref.Namespace = p.namespace
+		metadata["namespace"] = ref.Namespace
+	}
+	if !res.Namespaced {
+		ref.Namespace = ""
+	}
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return ref, fmt.Errorf("failed to encode %s: %w", ref, err)
+	}
+	query := url.Values{"fieldManager": {FieldManager}, "force": {"true"}}
+	if err := p.client.do(ctx, http.MethodPatch, objectPath(res, ref), query, "application/apply-patch+yaml", body, nil); err != nil {
+		return ref, fmt.Errorf("failed to apply %s: %w", ref, err)
+	}
+	return ref, nil
+}
+
+func (p *Provider) get(ctx context.Context, ref objectRef) (map[string]interface{}, error) {
+	res, err := p.client.resourceFor(ctx, ref.APIVersion, ref.Kind)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := p.client.do(ctx, http.MethodGet, objectPath(res, ref), nil, "", nil, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (p *Provider) delete(ctx context.Context, ref objectRef) error {
+	res, err := p.client.resourceFor(ctx, ref.APIVersion, ref.Kind)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"propagationPolicy": {"Background"}}
+	if err := p.client.do(ctx, http.MethodDelete, objectPath(res, ref), query, "", nil, nil); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", ref, err)
+	}
+	return nil
+}
+
+// waitRollout polls the workloads among the objects until they are rolled
+// out
+func (p *Provider) waitRollout(ctx context.Context, refs []objectRef, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, ref := range refs {
+		if !workloadKinds[ref.Kind] {
+			continue
+		}
+		for {
+			obj, err := p.get(ctx, ref)
+			if err != nil {
+				return fmt.Errorf("failed to check rollout of %s: %w", ref, err)
+			}
+			if rolledOut(obj) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("timed out after %s waiting for the rollout of %s", timeout, ref)
+			case <-time.After(p.poll):
+			}
+		}
+	}
+	return nil
+}
+
+// workloadKinds have a rollout to wait for
+var workloadKinds = map[string]bool{"Deployment": true, "StatefulSet": true, "DaemonSet": true}
+
+// rolledOut reports whether the controller observed the latest generation
+// of a workload and all its replicas are updated and available. Other
+// objects are ready once applied.
+func rolledOut(obj map[string]interface{}) bool {
+	kind, _ := obj["kind"].(string)
+	if !workloadKinds[kind] {
+		return true
+	}
+
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	spec, _ := obj["spec"].(map[string]interface{})
+	status, _ := obj["status"].(map[string]interface{})
+	if number(status, "observedGeneration") < number(metadata, "generation") {
+		return false
+	}
+
+	switch kind {
+	case "DaemonSet":
+		desired := number(status, "desiredNumberScheduled")
+		return number(status, "updatedNumberScheduled") == desired && number(status, "numberAvailable") == desired
+	case "StatefulSet":
+		replicas := replicasOf(spec)
+		return number(status, "updatedReplicas") == replicas && number(status, "readyReplicas") == replicas
+	default:
+		replicas := replicasOf(spec)
+		return number(status, "updatedReplicas") == replicas && number(status, "availableReplicas") == replicas
+	}
+}
+
+func replicasOf(spec map[string]interface{}) int64 {
+	if _, ok := spec["replicas"]; !ok {
+		return 1
+	}
+	return number(spec, "replicas")
+}
+
+func number(m map[string]interface{}, key string) int64 {
+	switch v := m[key].(type) {
+	case float64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+// objectRef identifies an applied object
+type objectRef struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+func (r objectRef) String() string {
+	return strings.Join([]string{r.APIVersion, r.Kind, r.Namespace, r.Name}, ":")
+}
+
+func parseID(id string) ([]objectRef, error) {
+	var refs []objectRef
+	for _, s := range strings.Split(id, ",") {
+		parts := strings.Split(s, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid resource ID %q", id)
+		}
+		refs = append(refs, objectRef{APIVersion: parts[0], Kind: parts[1], Namespace: parts[2], Name: parts[3]})
+	}
+	return refs, nil
+}
+
+func objectPath(res *apiResource, ref objectRef) string {
+	path := groupVersionPath(ref.APIVersion)
+	if res.Namespaced {
+		path += "/namespaces/" + url.PathEscape(ref.Namespace)
+	}
+	return path + "/" + res.Name + "/" + url.PathEscape(ref.Name)
+}
+
+func stringProperty(props map[string]interface{}, key, def string) string {
+	if s, ok := props[key].(string); ok && s != "" {
+		return s
+	}
+	return def
+}
@@ -0,0 +1,322 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+const testToken = "secret-token"
+
+// fakeAPIServer serves discovery and stores applied objects by path
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	// applies and deletes list the object paths patched and deleted, in
+	// order
+	applies []string
+	deletes []string
+	// rolloutPolls is the number of reads after which an applied workload
+	// reports its rollout as done, or -1 for never
+	rolloutPolls int
+	reads        map[string]int
+}
+
+var discovery = map[string]string{
+	"/api/v1":       `{"resources": [{"name": "namespaces", "kind": "Namespace", "namespaced": false}, {"name": "configmaps", "kind": "ConfigMap", "namespaced": true}]}`,
+	"/apis/apps/v1": `{"resources": [{"name": "deployments", "kind": "Deployment", "namespaced": true}, {"name": "deployments/status", "kind": "Deployment", "namespaced": true}]}`,
+}
+
+func newFakeAPIServer(t *testing.T) (*fakeAPIServer, *Provider) {
+	t.Helper()
+	s := &fakeAPIServer{
+		objects: make(map[string]map[string]interface{}),
+		reads:   make(map[string]int),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, `{"message": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		s.serve(t, w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	p := New().(*Provider)
+	if err := p.Init(map[string]interface{}{"server": server.URL, "token": testToken, "namespace": "apps"}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	p.poll = time.Millisecond
+	return s, p
+}
+
+func (s *fakeAPIServer) serve(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	if doc, ok := discovery[path]; ok && r.Method == http.MethodGet {
+		w.Write([]byte(doc))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		if ct := r.Header.Get("Content-Type"); ct != "application/apply-patch+yaml" {
+			t.Errorf("PATCH %s with content type %q, want a server-side apply", path, ct)
+		}
+		if q := r.URL.Query(); q.Get("fieldManager") != FieldManager || q.Get("force") != "true" {
+			t.Errorf("PATCH %s with query %q, want fieldManager=%s and force=true", path, r.URL.RawQuery, FieldManager)
+		}
+		data, _ := io.ReadAll(r.Body)
+		var obj map[string]interface{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			http.Error(w, `{"message": "invalid body"}`, http.StatusBadRequest)
+			return
+		}
+		metadata := obj["metadata"].(map[string]interface{})
+		generation := 1.0
+		if old, ok := s.objects[path]; ok {
+			generation = old["metadata"].(map[string]interface{})["generation"].(float64) + 1
+		}
+		metadata["generation"] = generation
+		s.objects[path] = obj
+		s.reads[path] = 0
+		s.applies = append(s.applies, path)
+		json.NewEncoder(w).Encode(obj)
+
+	case http.MethodGet:
+		obj, ok := s.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "not found"}`))
+			return
+		}
+		s.reads[path]++
+		if obj["kind"] == "Deployment" && s.rolloutPolls >= 0 && s.reads[path] > s.rolloutPolls {
+			replicas := obj["spec"].(map[string]interface{})["replicas"]
+			obj["status"] = map[string]interface{}{
+				"observedGeneration": obj["metadata"].(map[string]interface{})["generation"],
+				"updatedReplicas":    replicas,
+				"availableReplicas":  replicas,
+			}
+		}
+		json.NewEncoder(w).Encode(obj)
+
+	case http.MethodDelete:
+		if r.URL.Query().Get("propagationPolicy") != "Background" {
+			t.Errorf("DELETE %s without background propagation", path)
+		}
+		if _, ok := s.objects[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "not found"}`))
+			return
+		}
+		delete(s.objects, path)
+		s.deletes = append(s.deletes, path)
+		w.Write([]byte(`{}`))
+
+	default:
+		http.Error(w, `{"message": "unexpected request"}`, http.StatusBadRequest)
+	}
+}
+
+func (s *fakeAPIServer) paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for path := range s.objects {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+const appManifest = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: apps
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  replicas: "{{ .Variables.replicas }}"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: {{ .Variables.replicas }}
+`
+
+func manifestSpec(manifest string, props map[string]interface{}) plugin.ResourceSpec {
+	spec := plugin.ResourceSpec{
+		Name:       "app",
+		Type:       TypeManifest,
+		Properties: map[string]interface{}{"manifest": manifest},
+	}
+	for k, v := range props {
+		spec.Properties[k] = v
+	}
+	return spec
+}
+
+func TestCreateAppliesManifest(t *testing.T) {
+	s, p := newFakeAPIServer(t)
+
+	res, err := p.CreateResource(context.Background(), manifestSpec(appManifest, map[string]interface{}{
+		"vars": map[string]interface{}{"replicas": 2},
+	}))
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+
+	wantApplies := []string{
+		"/api/v1/namespaces/apps",
+		"/api/v1/namespaces/apps/configmaps/web-config",
+		"/apis/apps/v1/namespaces/apps/deployments/web",
+	}
+	if !reflect.DeepEqual(s.applies, wantApplies) {
+		t.Errorf("applied %v, want %v", s.applies, wantApplies)
+	}
+	if want := "v1:Namespace::apps,v1:ConfigMap:apps:web-config,apps/v1:Deployment:apps:web"; res.ID != want {
+		t.Errorf("ID = %s, want %s", res.ID, want)
+	}
+
+	// The provider's namespace is set on namespaced objects without one
+	cm := s.objects["/api/v1/namespaces/apps/configmaps/web-config"]
+	if ns := cm["metadata"].(map[string]interface{})["namespace"]; ns != "apps" {
+		t.Errorf("config map namespace = %v, want apps", ns)
+	}
+	if v := cm["data"].(map[string]interface{})["replicas"]; v != "2" {
+		t.Errorf("rendered replicas = %v, want 2", v)
+	}
+}
+
+func TestUpdatePrunesRemovedObjects(t *testing.T) {
+	s, p := newFakeAPIServer(t)
+	vars := map[string]interface{}{"vars": map[string]interface{}{"replicas": 1}}
+
+	res, err := p.CreateResource(context.Background(), manifestSpec(appManifest, vars))
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+
+	// The config map is dropped from the manifest
+	updated := strings.Replace(appManifest, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  replicas: "{{ .Variables.replicas }}"
+---`, "", 1)
+	res, err = p.UpdateResource(context.Background(), res.ID, manifestSpec(updated, vars))
+	if err != nil {
+		t.Fatalf("UpdateResource: %v", err)
+	}
+
+	if want := []string{"/api/v1/namespaces/apps/configmaps/web-config"}; !reflect.DeepEqual(s.deletes, want) {
+		t.Errorf("pruned %v, want %v", s.deletes, want)
+	}
+	if want := "v1:Namespace::apps,apps/v1:Deployment:apps:web"; res.ID != want {
+		t.Errorf("ID = %s, want %s", res.ID, want)
+	}
+	if gen := s.objects["/apis/apps/v1/namespaces/apps/deployments/web"]["metadata"].(map[string]interface{})["generation"]; gen != 2.0 {
+		t.Errorf("deployment generation = %v, want it applied again", gen)
+	}
+}
+
+func TestDeleteResourceInReverseOrder(t *testing.T) {
+	s, p := newFakeAPIServer(t)
+	res, err := p.CreateResource(context.Background(), manifestSpec(appManifest, map[string]interface{}{
+		"vars": map[string]interface{}{"replicas": 1},
+	}))
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+
+	// An object deleted out of band does not fail the delete
+	delete(s.objects, "/api/v1/namespaces/apps/configmaps/web-config")
+
+	if err := p.DeleteResource(context.Background(), res.ID); err != nil {
+		t.Fatalf("DeleteResource: %v", err)
+	}
+	want := []string{"/apis/apps/v1/namespaces/apps/deployments/web", "/api/v1/namespaces/apps"}
+	if !reflect.DeepEqual(s.deletes, want) {
+		t.Errorf("deleted %v, want %v", s.deletes, want)
+	}
+	if paths := s.paths(); len(paths) != 0 {
+		t.Errorf("objects left after delete: %v", paths)
+	}
+}
+
+func TestCreateWaitsForRollout(t *testing.T) {
+	s, p := newFakeAPIServer(t)
+	s.rolloutPolls = 3
+	spec := manifestSpec(appManifest, map[string]interface{}{"vars": map[string]interface{}{"replicas": 3}})
+
+	if _, err := p.CreateResource(context.Background(), spec); err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	if n := s.reads["/apis/apps/v1/namespaces/apps/deployments/web"]; n != 4 {
+		t.Errorf("deployment was read %d times, want 4", n)
+	}
+}
+
+func TestCreateTimesOutWaitingForRollout(t *testing.T) {
+	s, p := newFakeAPIServer(t)
+	s.rolloutPolls = -1
+	spec := manifestSpec(appManifest, map[string]interface{}{
+		"vars":         map[string]interface{}{"replicas": 3},
+		"wait_timeout": "50ms",
+	})
+
+	_, err := p.CreateResource(context.Background(), spec)
+	if err == nil || !strings.Contains(err.Error(), "rollout of apps/v1:Deployment:apps:web") {
+		t.Fatalf("CreateResource error = %v, want a rollout timeout", err)
+	}
+}
+
+func TestGetResourceReportsMissingObjects(t *testing.T) {
+	s, p := newFakeAPIServer(t)
+	res, err := p.CreateResource(context.Background(), manifestSpec(appManifest, map[string]interface{}{
+		"vars": map[string]interface{}{"replicas": 1},
+	}))
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+
+	got, err := p.GetResource(context.Background(), res.ID)
+	if err != nil || got.Status != "ready" {
+		t.Fatalf("GetResource = %+v, %v, want ready", got, err)
+	}
+
+	delete(s.objects, "/apis/apps/v1/namespaces/apps/deployments/web")
+	got, err = p.GetResource(context.Background(), res.ID)
+	if err != nil || got.Status != "missing" {
+		t.Errorf("GetResource = %+v, %v, want missing", got, err)
+	}
+}
+
+func TestApplyRejectsUnknownKind(t *testing.T) {
+	_, p := newFakeAPIServer(t)
+	manifest := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: creds\n"
+
+	_, err := p.CreateResource(context.Background(), manifestSpec(manifest, nil))
+	if err == nil || !strings.Contains(err.Error(), "kind Secret is not served by v1") {
+		t.Errorf("CreateResource error = %v, want an unknown kind", err)
+	}
+}
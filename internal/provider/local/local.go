@@ -0,0 +1,364 @@
+package local
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yahao333/gort/internal/plugin"
+	"github.com/yahao333/gort/internal/template"
+)
+
+// Name is the name the provider is registered under
+const Name = "local"
+
+const version = "1.0.0"
+
+// Resource types
+const (
+	TypeFile      = "file"
+	TypeDirectory = "directory"
+	// TypeTemplate is a file rendered from a template and variables
+	TypeTemplate = "template"
+)
+
+func init() {
+	plugin.Register(Name, plugin.PluginMetadata{
+		Version:     version,
+		Author:      "gort",
+		Description: "Files, directories and rendered templates on the local filesystem",
+		Interfaces:  []string{plugin.InterfaceProvider, plugin.InterfaceSchema, plugin.InterfaceDiff},
+		Properties: map[string]string{
+			"root": "Directory resource paths are relative to, default the working directory",
+		},
+	}, New)
+}
+
+var (
+	pathAttribute = plugin.Attribute{
+		Type:        plugin.TypeString,
+		Description: "Path relative to the provider root, default the resource name",
+	}
+	sha256Attribute = plugin.Attribute{
+		Type:        plugin.TypeString,
+		Description: "Checksum of the written content",
+		Computed:    true,
+	}
+)
+
+func modeAttribute(def string) plugin.Attribute {
+	return plugin.Attribute{
+		Type:        plugin.TypeAny,
+		Description: "Permissions, as an octal string such as \"0600\" or a number",
+		Default:     def,
+	}
+}
+
+var schema = &plugin.Schema{
+	Resources: map[string]plugin.ResourceSchema{
+		TypeFile: {
+			Description: "A file with literal content",
+			Attributes: map[string]plugin.Attribute{
+				"path":    pathAttribute,
+				"content": {Type: plugin.TypeString, Description: "File content"},
+				"mode":    modeAttribute("0644"),
+				"sha256":  sha256Attribute,
+			},
+		},
+		TypeDirectory: {
+			Description: "A directory, removed on delete once empty",
+			Attributes: map[string]plugin.Attribute{
+				"path": pathAttribute,
+				"mode": modeAttribute("0755"),
+			},
+		},
+		TypeTemplate: {
+			Description: "A file rendered from a template and variables",
+			Attributes: map[string]plugin.Attribute{
+				"path":     pathAttribute,
+				"template": {Type: plugin.TypeString, Description: "Template text"},
+				"source":   {Type: plugin.TypeString, Description: "Template file relative to the provider root, when template is not set"},
+				"vars":     {Type: plugin.TypeMap, Description: "Variables of the template"},
+				"mode":     modeAttribute("0644"),
+				"sha256":   sha256Attribute,
+			},
+		},
+	},
+}
+
+// Provider manages files, directories and rendered templates below a root
+// directory. It needs no cloud account, so it is also used to exercise
+// deployments end to end. Resource IDs are <type>:<path>.
+type Provider struct {
+	root string
+}
+
+// New creates the provider
+func New() plugin.Plugin {
+	return &Provider{root: "."}
+}
+
+func (p *Provider) Init(config map[string]interface{}) error {
+	if root, ok := config["root"]; ok {
+		s, ok := root.(string)
+		if !ok || s == "" {
+			return fmt.Errorf("root must be a directory path")
+		}
+		p.root = s
+	}
+	return nil
+}
+
+func (p *Provider) Name() string    { return Name }
+func (p *Provider) Version() string { return version }
+
+func (p *Provider) Schema() *plugin.Schema { return schema }
+
+func (p *Provider) Shutdown(ctx context.Context) error { return nil }
+
+func (p *Provider) CreateResource(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	return p.write(spec)
+}
+
+func (p *Provider) UpdateResource(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	res, err := p.write(spec)
+	if err != nil {
+		return nil, err
+	}
+	// Moving a resource removes it from its previous path
+	if res.ID != id {
+		if err := p.DeleteResource(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Diff compares the properties and, for files and templates, the content
+// that would be written with the file on disk, so that changed template
+// sources and files edited outside gort are planned as updates
+func (p *Provider) Diff(ctx context.Context, current plugin.Resource, desired plugin.ResourceSpec) (*plugin.ResourceDiff, error) {
+	rs := schema.Resources[desired.Type]
+	diff := plugin.StructuralDiff(current, desired, &rs)
+	if desired.Type != TypeFile && desired.Type != TypeTemplate {
+		return diff, nil
+	}
+
+	content, err := p.content(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", desired.Name, err)
+	}
+	// Secrets are only substituted when the resource is applied
+	if strings.Contains(content, "${secret.") {
+		return diff, nil
+	}
+
+	_, path, err := p.parseID(current.ID)
+	if err != nil {
+		return nil, err
+	}
+	var have interface{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		have = checksum(data)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", current.ID, err)
+	}
+	if want := checksum([]byte(content)); have != want {
+		diff.Changes = append(diff.Changes, plugin.AttributeChange{Attribute: "sha256", Before: have, After: want})
+	}
+	return diff, nil
+}
+
+func (p *Provider) DeleteResource(ctx context.Context, id string) error {
+	_, path, err := p.parseID(id)
+	if err != nil {
+		return err
+	}
+	// Directories are only removed once empty
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %w", id, err)
+	}
+	return nil
+}
+
+func (p *Provider) GetResource(ctx context.Context, id string) (*plugin.Resource, error) {
+	typ, path, err := p.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &plugin.Resource{
+		ID:         id,
+		Type:       typ,
+		Name:       strings.TrimPrefix(id, typ+":"),
+		Properties: map[string]interface{}{},
+		Status:     "missing",
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return nil, fmt.Errorf("failed to stat %s: %w", id, err)
+	}
+
+	res.Status = "ready"
+	res.Properties["path"] = res.Name
+	res.Properties["mode"] = fmt.Sprintf("%04o", info.Mode().Perm())
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", id, err)
+		}
+		res.Properties["content"] = string(data)
+		res.Properties["sha256"] = checksum(data)
+	}
+	return res, nil
+}
+
+// write creates or overwrites the resource on disk
+func (p *Provider) write(spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	rel, err := stringProperty(spec.Properties, "path", spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	path, err := p.resolve(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &plugin.Resource{
+		ID:         spec.Type + ":" + filepath.ToSlash(filepath.Clean(rel)),
+		Type:       spec.Type,
+		Name:       spec.Name,
+		Properties: map[string]interface{}{"path": rel},
+		Status:     "ready",
+	}
+
+	switch spec.Type {
+	case TypeDirectory:
+		mode, err := modeProperty(spec.Properties, 0755)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(path, mode); err != nil {
+			return nil, fmt.Errorf("failed to create directory %s: %w", rel, err)
+		}
+		return res, nil
+
+	case TypeFile, TypeTemplate:
+		content, err := p.content(spec)
+		if err != nil {
+			return nil, err
+		}
+		mode, err := modeProperty(spec.Properties, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", rel, err)
+		}
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+		// WriteFile keeps the mode of existing files
+		if err := os.Chmod(path, mode); err != nil {
+			return nil, fmt.Errorf("failed to set mode of %s: %w", rel, err)
+		}
+		res.Properties["sha256"] = checksum([]byte(content))
+		return res, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported resource type %q (expected %s, %s or %s)", spec.Type, TypeFile, TypeDirectory, TypeTemplate)
+	}
+}
+
+// content returns the file contents of a file or rendered template
+func (p *Provider) content(spec plugin.ResourceSpec) (string, error) {
+	if spec.Type == TypeFile {
+		return stringProperty(spec.Properties, "content", "")
+	}
+
+	vars, _ := spec.Properties["vars"].(map[string]interface{})
+	data := &template.TemplateData{Variables: vars}
+	if text, ok := spec.Properties["template"].(string); ok {
+		return template.Render(spec.Name, text, data)
+	}
+	source, err := stringProperty(spec.Properties, "source", "")
+	if err != nil {
+		return "", err
+	}
+	if source == "" {
+		return "", fmt.Errorf("template %s needs a template or source property", spec.Name)
+	}
+	path, err := p.resolve(source)
+	if err != nil {
+		return "", err
+	}
+	return template.RenderTemplate(path, data)
+}
+
+// resolve returns the path of a resource below the root
+func (p *Provider) resolve(rel string) (string, error) {
+	if rel == "" || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("path %q must be relative to the provider root", rel)
+	}
+	clean := filepath.Clean(rel)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the provider root", rel)
+	}
+	return filepath.Join(p.root, clean), nil
+}
+
+func (p *Provider) parseID(id string) (typ, path string, err error) {
+	typ, rel, ok := strings.Cut(id, ":")
+	if !ok {
+		return "", "", fmt.Errorf("invalid resource ID %q", id)
+	}
+	path, err = p.resolve(filepath.FromSlash(rel))
+	return typ, path, err
+}
+
+func stringProperty(props map[string]interface{}, key, def string) (string, error) {
+	v, ok := props[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("property %s must be a string", key)
+	}
+	return s, nil
+}
+
+// modeProperty reads the file mode, given as an octal string such as
+// "0600" or as a number
+func modeProperty(props map[string]interface{}, def os.FileMode) (os.FileMode, error) {
+	switch v := props["mode"].(type) {
+	case nil:
+		return def, nil
+	case string:
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid mode %q", v)
+		}
+		return os.FileMode(mode), nil
+	case int:
+		return os.FileMode(v), nil
+	case float64:
+		return os.FileMode(v), nil
+	default:
+		return 0, fmt.Errorf("invalid mode %v", v)
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
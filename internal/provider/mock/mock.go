@@ -0,0 +1,377 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yahao333/gort/internal/plugin"
+)
+
+// Name is the name the provider is registered under
+const Name = "mock"
+
+const version = "1.0.0"
+
+// Operations that can be scripted to fail
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	OpGet    = "get"
+)
+
+func init() {
+	plugin.Register(Name, plugin.PluginMetadata{
+		Version:     version,
+		Author:      "gort",
+		Description: "In-memory resources with scripted latency, failures and drift, for tests",
+		Interfaces:  []string{plugin.InterfaceProvider, plugin.InterfaceAsync},
+		Properties: map[string]string{
+			"latency":        "Delay of every call, e.g. 200ms",
+			"state_file":     "File keeping resources and failure counts between runs",
+			"failures":       "List of {operation, resource, times, message, retryable} calls to fail",
+			"drift":          "Properties reported by GetResource instead of the applied ones, by resource name",
+			"operation_time": "How long started operations take to complete, e.g. 5s",
+			"ready_after":    "How long resources report status pending after they are applied",
+		},
+	}, New)
+}
+
+// Failure makes calls of an operation on a resource fail. The first Times
+// calls fail, or every call when Times is 0. Retryable failures are
+// returned as plugin.RetryableError.
+type Failure struct {
+	Operation string `json:"operation"`
+	Resource  string `json:"resource"`
+	Times     int    `json:"times"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+// Provider keeps resources in memory, and in a state file when configured
+// so that they survive between gort runs. Resource IDs are <type>/<name>.
+type Provider struct {
+	mu            sync.Mutex
+	latency       time.Duration
+	operationTime time.Duration
+	readyAfter    time.Duration
+	stateFile     string
+	failures      []Failure
+	drift         map[string]map[string]interface{}
+	state         mockState
+	// ops are the started operations by ID
+	ops    map[string]*operation
+	nextOp int
+}
+
+type mockState struct {
+	Resources map[string]*plugin.Resource `json:"resources"`
+	// Calls counts the calls per operation and resource, so failures that
+	// happen a number of times carry over between runs
+	Calls map[string]int `json:"calls"`
+	// Applied is when each resource was last created or updated
+	Applied map[string]time.Time `json:"applied,omitempty"`
+}
+
+// operation is an operation started with the AsyncProvider calls
+type operation struct {
+	op    string
+	id    string
+	spec  plugin.ResourceSpec
+	start time.Time
+}
+
+// New creates the provider
+func New() plugin.Plugin {
+	return &Provider{
+		drift: make(map[string]map[string]interface{}),
+		state: mockState{
+			Resources: make(map[string]*plugin.Resource),
+			Calls:     make(map[string]int),
+			Applied:   make(map[string]time.Time),
+		},
+		ops: make(map[string]*operation),
+	}
+}
+
+func (p *Provider) Init(config map[string]interface{}) error {
+	for key, d := range map[string]*time.Duration{
+		"latency":        &p.latency,
+		"operation_time": &p.operationTime,
+		"ready_after":    &p.readyAfter,
+	} {
+		if v, ok := config[key]; ok {
+			s, _ := v.(string)
+			duration, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid %s %v", key, v)
+			}
+			*d = duration
+		}
+	}
+
+	// Failures and drift are decoded through JSON from the generic YAML
+	// values
+	if v, ok := config["failures"]; ok {
+		if err := convert(v, &p.failures); err != nil {
+			return fmt.Errorf("invalid failures: %w", err)
+		}
+		for _, f := range p.failures {
+			switch f.Operation {
+			case OpCreate, OpUpdate, OpDelete, OpGet:
+			default:
+				return fmt.Errorf("invalid failure operation %q", f.Operation)
+			}
+		}
+	}
+	if v, ok := config["drift"]; ok {
+		if err := convert(v, &p.drift); err != nil {
+			return fmt.Errorf("invalid drift: %w", err)
+		}
+	}
+
+	if v, ok := config["state_file"]; ok {
+		p.stateFile, _ = v.(string)
+		data, err := os.ReadFile(p.stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read mock state: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &p.state); err != nil {
+				return fmt.Errorf("failed to parse mock state: %w", err)
+			}
+			if p.state.Applied == nil {
+				p.state.Applied = make(map[string]time.Time)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Provider) Name() string    { return Name }
+func (p *Provider) Version() string { return version }
+
+func (p *Provider) Shutdown(ctx context.Context) error { return nil }
+
+func (p *Provider) CreateResource(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	id := spec.Type + "/" + spec.Name
+	return p.apply(ctx, OpCreate, id, spec)
+}
+
+func (p *Provider) UpdateResource(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	return p.apply(ctx, OpUpdate, id, spec)
+}
+
+func (p *Provider) DeleteResource(ctx context.Context, id string) error {
+	if err := p.call(ctx, OpDelete, id); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.state.Resources[id]; !exists {
+		return fmt.Errorf("resource %s not found", id)
+	}
+	return p.remove(id)
+}
+
+func (p *Provider) GetResource(ctx context.Context, id string) (*plugin.Resource, error) {
+	if err := p.call(ctx, OpGet, id); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res, exists := p.state.Resources[id]
+	if !exists {
+		return nil, fmt.Errorf("resource %s not found", id)
+	}
+
+	out := *res
+	out.Properties = make(map[string]interface{}, len(res.Properties))
+	for k, v := range res.Properties {
+		out.Properties[k] = v
+	}
+	for k, v := range p.drift[res.Name] {
+		out.Properties[k] = v
+	}
+	out.Status = p.status(id)
+	return &out, nil
+}
+
+func (p *Provider) StartCreate(ctx context.Context, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	return p.start(ctx, OpCreate, spec.Type+"/"+spec.Name, spec)
+}
+
+func (p *Provider) StartUpdate(ctx context.Context, id string, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	return p.start(ctx, OpUpdate, id, spec)
+}
+
+func (p *Provider) StartDelete(ctx context.Context, id string) (*plugin.Operation, error) {
+	return p.start(ctx, OpDelete, id, plugin.ResourceSpec{})
+}
+
+// PollOperation completes operations once operation_time has passed since
+// they were started
+func (p *Provider) PollOperation(ctx context.Context, op plugin.Operation) (*plugin.OperationStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	o, exists := p.ops[op.ID]
+	if !exists {
+		return nil, fmt.Errorf("operation %s not found", op.ID)
+	}
+	if elapsed := time.Since(o.start); elapsed < p.operationTime {
+		return &plugin.OperationStatus{
+			Message: fmt.Sprintf("%s of %s %d%% done", o.op, o.id, 100*elapsed/p.operationTime),
+		}, nil
+	}
+
+	delete(p.ops, op.ID)
+	if o.op == OpDelete {
+		return &plugin.OperationStatus{Done: true}, p.remove(o.id)
+	}
+	res, err := p.store(o.id, o.spec)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.OperationStatus{Done: true, Resource: res}, nil
+}
+
+// start begins an operation, failing it right away when scripted to
+func (p *Provider) start(ctx context.Context, op, id string, spec plugin.ResourceSpec) (*plugin.Operation, error) {
+	if err := p.call(ctx, op, id); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.state.Resources[id]; op != OpCreate && !exists {
+		return nil, fmt.Errorf("resource %s not found", id)
+	}
+	p.nextOp++
+	opID := fmt.Sprintf("op-%d", p.nextOp)
+	p.ops[opID] = &operation{op: op, id: id, spec: spec, start: time.Now()}
+	return &plugin.Operation{ID: opID, ResourceID: id}, nil
+}
+
+// status reports resources as pending until ready_after has passed since
+// they were applied. The caller holds the lock.
+func (p *Provider) status(id string) string {
+	if time.Since(p.state.Applied[id]) < p.readyAfter {
+		return "pending"
+	}
+	return "ready"
+}
+
+func (p *Provider) apply(ctx context.Context, op, id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	if err := p.call(ctx, op, id); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.state.Resources[id]; op == OpUpdate && !exists {
+		return nil, fmt.Errorf("resource %s not found", id)
+	}
+	return p.store(id, spec)
+}
+
+// store records an applied resource. The caller holds the lock.
+func (p *Provider) store(id string, spec plugin.ResourceSpec) (*plugin.Resource, error) {
+	p.state.Applied[id] = time.Now()
+	res := &plugin.Resource{
+		ID:         id,
+		Type:       spec.Type,
+		Name:       spec.Name,
+		Properties: spec.Properties,
+		Status:     p.status(id),
+	}
+	p.state.Resources[id] = res
+	if err := p.save(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// remove deletes a resource. The caller holds the lock.
+func (p *Provider) remove(id string) error {
+	delete(p.state.Resources, id)
+	delete(p.state.Applied, id)
+	return p.save()
+}
+
+// call simulates the latency of an API call and fails it when scripted to
+func (p *Provider) call(ctx context.Context, op, id string) error {
+	if p.latency > 0 {
+		select {
+		case <-time.After(p.latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	name := id
+	if i := strings.Index(id, "/"); i >= 0 {
+		name = id[i+1:]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := op + " " + id
+	p.state.Calls[key]++
+	calls := p.state.Calls[key]
+	if err := p.save(); err != nil {
+		return err
+	}
+
+	for _, f := range p.failures {
+		if f.Operation != op || (f.Resource != "" && f.Resource != name) {
+			continue
+		}
+		if f.Times == 0 || calls <= f.Times {
+			msg := f.Message
+			if msg == "" {
+				msg = "injected failure"
+			}
+			err := fmt.Errorf("mock %s of %s failed: %s", op, id, msg)
+			if f.Retryable {
+				return plugin.Retryable(err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes the state file, if any. The caller holds the lock.
+func (p *Provider) save() error {
+	if p.stateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode mock state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.stateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create mock state directory: %w", err)
+	}
+	if err := os.WriteFile(p.stateFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write mock state: %w", err)
+	}
+	return nil
+}
+
+func convert(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
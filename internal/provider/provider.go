@@ -1,5 +1,7 @@
 package provider
 
+import "github.com/yahao333/gort/internal/plugin"
+
 // Provider defines the interface for infrastructure providers
 type Provider interface {
 	// Initialize sets up the provider
@@ -20,8 +22,14 @@ type PlanResult struct {
 }
 
 type Change struct {
-	Type     string // add, update, delete
+	Type     string // add, update, delete, replace
 	Resource string
 	Before   interface{}
 	After    interface{}
+	// Attributes lists the attribute changes of an update or replace
+	Attributes []plugin.AttributeChange
+	// ForcesReplacement lists the attributes whose change requires a replace
+	ForcesReplacement []string
+	// Sensitive lists the attributes whose values are not shown
+	Sensitive []string
 }
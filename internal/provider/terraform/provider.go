@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/yahao333/gort/internal/provider"
 )
@@ -52,3 +53,19 @@ func (p *TerraformProvider) Apply(plan *provider.PlanResult) error {
 
 	return cmd.Run()
 }
+
+// Validate checks the terraform files in the workspace of env, which must
+// already exist. The output of terraform is only reported when it fails.
+func (p *TerraformProvider) Validate(env string) error {
+	if err := p.SelectWorkspace(env); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(p.binPath, "validate", "-no-color")
+	cmd.Dir = p.workDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("terraform validate failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
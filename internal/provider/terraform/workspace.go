@@ -7,44 +7,64 @@ import (
 )
 
 type Workspace struct {
-    name    string
-    workDir string
+	name    string
+	workDir string
 }
 
 func (p *TerraformProvider) EnsureWorkspace(name string) error {
-    // List existing workspaces
-    cmd := exec.Command(p.binPath, "workspace", "list")
-    cmd.Dir = p.workDir
-    output, err := cmd.Output()
-    if err != nil {
-        return fmt.Errorf("failed to list workspaces: %w", err)
-    }
-
-    // Check if workspace exists
-    workspaces := strings.Split(string(output), "\n")
-    exists := false
-    for _, ws := range workspaces {
-        if strings.TrimSpace(strings.TrimPrefix(ws, "*")) == name {
-            exists = true
-            break
-        }
-    }
-
-    // Create workspace if it doesn't exist
-    if !exists {
-        cmd = exec.Command(p.binPath, "workspace", "new", name)
-        cmd.Dir = p.workDir
-        if err := cmd.Run(); err != nil {
-            return fmt.Errorf("failed to create workspace: %w", err)
-        }
-    }
-
-    // Select workspace
-    cmd = exec.Command(p.binPath, "workspace", "select", name)
-    cmd.Dir = p.workDir
-    if err := cmd.Run(); err != nil {
-        return fmt.Errorf("failed to select workspace: %w", err)
-    }
-
-    return nil
-}
\ No newline at end of file
+	exists, err := p.hasWorkspace(name)
+	if err != nil {
+		return err
+	}
+
+	// Create workspace if it doesn't exist
+	if !exists {
+		cmd := exec.Command(p.binPath, "workspace", "new", name)
+		cmd.Dir = p.workDir
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+	}
+
+	return p.selectWorkspace(name)
+}
+
+// SelectWorkspace selects an existing workspace, without creating it
+func (p *TerraformProvider) SelectWorkspace(name string) error {
+	exists, err := p.hasWorkspace(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("workspace %s does not exist", name)
+	}
+
+	return p.selectWorkspace(name)
+}
+
+func (p *TerraformProvider) hasWorkspace(name string) (bool, error) {
+	// List existing workspaces
+	cmd := exec.Command(p.binPath, "workspace", "list")
+	cmd.Dir = p.workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+
+	for _, ws := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(strings.TrimPrefix(ws, "*")) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *TerraformProvider) selectWorkspace(name string) error {
+	cmd := exec.Command(p.binPath, "workspace", "select", name)
+	cmd.Dir = p.workDir
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to select workspace: %w", err)
+	}
+
+	return nil
+}
@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/yahao333/gort/internal/logging"
 )
 
 type RemoteClient struct {
 	baseURL    string
 	token      string
 	httpClient *http.Client
-	logger     *Logger
+	logger     logging.Log
 }
 
 type RemoteOperation struct {
@@ -24,7 +26,12 @@ type RemoteOperation struct {
 	EndTime   time.Time              `json:"end_time"`
 }
 
-func NewRemoteClient(baseURL string, token string, logger *Logger) *RemoteClient {
+// NewRemoteClient creates a client of the remote API; a nil logger
+// discards its logs
+func NewRemoteClient(baseURL string, token string, logger logging.Log) *RemoteClient {
+	if logger == nil {
+		logger = logging.Discard
+	}
 	return &RemoteClient{
 		baseURL: baseURL,
 		token:   token,
@@ -70,6 +77,7 @@ func (rc *RemoteClient) ExecuteOperation(opType string, payload map[string]inter
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	rc.logger.Debugf("Started remote operation %s of type %s", result.ID, opType)
 	return &result, nil
 }
 
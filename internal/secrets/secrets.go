@@ -0,0 +1,124 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret values in the configuration are references that are resolved only
+// at runtime:
+//
+//	secret://path/to/file#key   a key of a YAML or JSON file, or the whole
+//	                            file when no key is given
+//	env:NAME                    a process environment variable
+//	enc:<base64>                an AES-GCM value encrypted with the store key
+//
+// Any other value is used as is.
+const (
+	filePrefix = "secret://"
+	envPrefix  = "env:"
+	encPrefix  = "enc:"
+)
+
+// DefaultDir is where the local secrets store and its key are kept
+const DefaultDir = ".gort/secrets"
+
+// Values holds resolved secrets by name. They must only be kept in memory.
+type Values map[string]string
+
+// Plaintext returns the distinct non-empty values, for masking
+func (v Values) Plaintext() []string {
+	seen := make(map[string]bool, len(v))
+	values := make([]string, 0, len(v))
+	for _, s := range v {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		values = append(values, s)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Resolver resolves the secrets of an environment
+type Resolver struct {
+	store *Store
+}
+
+func NewResolver(store *Store) *Resolver {
+	return &Resolver{store: store}
+}
+
+// Resolve returns the secrets stored for env with `gort secrets set`,
+// overlaid with the resolved references declared in the configuration.
+func (r *Resolver) Resolve(env string, declared map[string]string) (Values, error) {
+	values := make(Values)
+
+	names, err := r.store.Names(env)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		v, err := r.store.Get(env, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+		values[name] = v
+	}
+
+	for name, ref := range declared {
+		v, err := r.resolveRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret %s: %w", name, err)
+		}
+		values[name] = v
+	}
+
+	return values, nil
+}
+
+func (r *Resolver) resolveRef(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, filePrefix):
+		return readFile(strings.TrimPrefix(ref, filePrefix))
+	case strings.HasPrefix(ref, envPrefix):
+		name := strings.TrimPrefix(ref, envPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(ref, encPrefix):
+		return r.store.Decrypt(ref)
+	default:
+		return ref, nil
+	}
+}
+
+func readFile(ref string) (string, error) {
+	path, key, hasKey := strings.Cut(ref, "#")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	if !hasKey {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return "", fmt.Errorf("failed to parse secret file %s: %w", path, err)
+	}
+
+	v, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in %s", key, path)
+	}
+	return fmt.Sprint(v), nil
+}
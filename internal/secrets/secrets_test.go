@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	s := newTestStore(t)
+	for name, value := range map[string]string{"stored": "from-store", "overridden": "from-store"} {
+		if err := s.Set("prod", name, value); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	enc, err := s.Encrypt("inline")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	dir := t.TempDir()
+	token := filepath.Join(dir, "token")
+	creds := filepath.Join(dir, "creds.yaml")
+	if err := os.WriteFile(token, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(creds, []byte("user: admin\nport: 5432\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GORT_TEST_SECRET", "from-env")
+
+	values, err := NewResolver(s).Resolve("prod", map[string]string{
+		"overridden": "literal",
+		"file":       "secret://" + token,
+		"key":        "secret://" + creds + "#user",
+		"number":     "secret://" + creds + "#port",
+		"env":        "env:GORT_TEST_SECRET",
+		"inline":     enc,
+	})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	want := Values{
+		"stored":     "from-store",
+		"overridden": "literal",
+		"file":       "file-token",
+		"key":        "admin",
+		"number":     "5432",
+		"env":        "from-env",
+		"inline":     "inline",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	if got := (Values{"a": "x", "b": "x", "c": ""}).Plaintext(); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("Plaintext = %v, want the distinct non-empty values", got)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	s := newTestStore(t)
+	creds := filepath.Join(t.TempDir(), "creds.yaml")
+	if err := os.WriteFile(creds, []byte("user: admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		wantErr string
+	}{
+		{"unset variable", "env:GORT_TEST_UNSET", "failed to resolve secret s: environment variable GORT_TEST_UNSET is not set"},
+		{"missing key", "secret://" + creds + "#password", "key password not found in " + creds},
+		{"missing file", "secret://" + filepath.Join(filepath.Dir(creds), "missing"), "failed to read secret file"},
+		{"no store key", "enc:AAAA", "failed to read secrets key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewResolver(s).Resolve("prod", map[string]string{"s": tt.ref})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Resolve error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// KeyEnvVar holds a base64 encoded 32 byte key that takes precedence
+	// over the key file
+	KeyEnvVar = "GORT_SECRETS_KEY"
+
+	storeFile = "secrets.json"
+	keyFile   = "secrets.key"
+	keySize   = 32
+)
+
+// Store is an encrypted local secrets file. Values are encrypted with
+// AES-256-GCM, bound to their environment and name, and only decrypted on
+// demand.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+type storeData struct {
+	Version      int                          `json:"version"`
+	Environments map[string]map[string]string `json:"environments"`
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Get returns the decrypted value of a secret
+func (s *Store) Get(env, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, ok := data.Environments[env][name]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found for environment %s", name, env)
+	}
+
+	key, err := s.key(false)
+	if err != nil {
+		return "", err
+	}
+
+	return open(key, sealed, aad(env, name))
+}
+
+// Set encrypts and stores a secret, creating the key on first use
+func (s *Store) Set(env, name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	key, err := s.key(true)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := seal(key, value, aad(env, name))
+	if err != nil {
+		return err
+	}
+
+	if data.Environments[env] == nil {
+		data.Environments[env] = make(map[string]string)
+	}
+	data.Environments[env][name] = sealed
+
+	return s.save(data)
+}
+
+// Rotate replaces a secret with a freshly generated random value
+func (s *Store) Rotate(env, name string, length int) error {
+	value, err := Generate(length)
+	if err != nil {
+		return err
+	}
+	return s.Set(env, name, value)
+}
+
+// Names returns the names of the secrets stored for an environment
+func (s *Store) Names(env string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(data.Environments[env]))
+	for name := range data.Environments[env] {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Encrypt returns an inline "enc:" value that can be placed directly in
+// the configuration
+func (s *Store) Encrypt(value string) (string, error) {
+	key, err := s.key(true)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(key, value, nil)
+	if err != nil {
+		return "", err
+	}
+	return encPrefix + sealed, nil
+}
+
+// Decrypt opens an inline "enc:" value
+func (s *Store) Decrypt(value string) (string, error) {
+	key, err := s.key(false)
+	if err != nil {
+		return "", err
+	}
+	return open(key, strings.TrimPrefix(value, encPrefix), nil)
+}
+
+func (s *Store) load() (*storeData, error) {
+	data := &storeData{
+		Version:      1,
+		Environments: make(map[string]map[string]string),
+	}
+
+	raw, err := os.ReadFile(filepath.Join(s.dir, storeFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, nil
+		}
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	if data.Environments == nil {
+		data.Environments = make(map[string]map[string]string)
+	}
+
+	return data, nil
+}
+
+func (s *Store) save(data *storeData) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(s.dir, storeFile), raw, 0600)
+}
+
+// key returns the encryption key from the environment or the key file,
+// generating the key file if create is set and no key exists yet.
+func (s *Store) key(create bool) ([]byte, error) {
+	if v := os.Getenv(KeyEnvVar); v != "" {
+		return decodeKey(v)
+	}
+
+	path := filepath.Join(s.dir, keyFile)
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		return decodeKey(strings.TrimSpace(string(raw)))
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("failed to read secrets key (set %s or create %s): %w", KeyEnvVar, path, err)
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets key: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %w", err)
+	}
+
+	return key, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid secrets key: expected %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func aad(env, name string) []byte {
+	return []byte(env + "/" + name)
+}
+
+func seal(key []byte, plaintext string, aad []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), aad)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(key []byte, value string, aad []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value: too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Generate returns a random URL-safe secret of the given length
+func Generate(length int) (string, error) {
+	if length <= 0 {
+		return "", fmt.Errorf("secret length must be positive")
+	}
+
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)[:length], nil
+}
@@ -0,0 +1,171 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	t.Setenv(KeyEnvVar, "")
+	return NewStore(t.TempDir())
+}
+
+func randomKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Set("prod", "db_password", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := s.Get("prod", "db_password")
+	if err != nil || got != "hunter2" {
+		t.Fatalf("Get = %q, %v, want hunter2", got, err)
+	}
+	if names, err := s.Names("prod"); err != nil || len(names) != 1 || names[0] != "db_password" {
+		t.Errorf("Names = %v, %v", names, err)
+	}
+	if _, err := s.Get("dev", "db_password"); err == nil || !strings.Contains(err.Error(), "not found for environment dev") {
+		t.Errorf("Get from another environment: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, storeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("secrets file holds the plaintext: %s", data)
+	}
+	for _, name := range []string{storeFile, keyFile} {
+		info, err := os.Stat(filepath.Join(s.dir, name))
+		if err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, %v, want 0600", name, info.Mode().Perm(), err)
+		}
+	}
+}
+
+func TestStoreWrongKey(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Set("prod", "db_password", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// The key from the environment takes precedence over the key file
+	t.Setenv(KeyEnvVar, randomKey(t))
+	if _, err := s.Get("prod", "db_password"); err == nil || !strings.Contains(err.Error(), "failed to decrypt value") {
+		t.Errorf("Get with another key: %v", err)
+	}
+
+	t.Setenv(KeyEnvVar, "c2hvcnQ=")
+	if _, err := s.Get("prod", "db_password"); err == nil || !strings.Contains(err.Error(), "expected 32 bytes, got 5") {
+		t.Errorf("Get with a short key: %v", err)
+	}
+
+	t.Setenv(KeyEnvVar, "")
+	if err := os.Remove(filepath.Join(s.dir, keyFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("prod", "db_password"); err == nil || !strings.Contains(err.Error(), "failed to read secrets key") {
+		t.Errorf("Get without a key: %v", err)
+	}
+}
+
+func TestStoreTamperedValue(t *testing.T) {
+	s := newTestStore(t)
+	for _, name := range []string{"a", "b"} {
+		if err := s.Set("prod", name, "value-"+name); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	path := filepath.Join(s.dir, storeFile)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data storeData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(data.Environments["prod"]["a"])
+	sealed[len(sealed)-1] ^= 1
+	data.Environments["prod"]["a"] = base64.StdEncoding.EncodeToString(sealed)
+	// Values are bound to their name, so swapping them is detected too
+	data.Environments["prod"]["c"] = data.Environments["prod"]["b"]
+	raw, _ = json.Marshal(data)
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "c"} {
+		if _, err := s.Get("prod", name); err == nil || !strings.Contains(err.Error(), "failed to decrypt value") {
+			t.Errorf("Get(%s) = %v, want a decryption failure", name, err)
+		}
+	}
+	if got, err := s.Get("prod", "b"); err != nil || got != "value-b" {
+		t.Errorf("Get(b) = %q, %v, want the untouched value", got, err)
+	}
+}
+
+func TestStoreRotate(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Set("prod", "token", "old"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Rotate("prod", "token", 24); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	got, err := s.Get("prod", "token")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got == "old" || len(got) != 24 {
+		t.Errorf("rotated value = %q, want 24 new characters", got)
+	}
+	if err := s.Rotate("prod", "token", 0); err == nil {
+		t.Error("Rotate accepted a zero length")
+	}
+}
+
+func TestInlineValues(t *testing.T) {
+	s := newTestStore(t)
+	enc, err := s.Encrypt("hunter2")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(enc, encPrefix) || strings.Contains(enc, "hunter2") {
+		t.Fatalf("Encrypt = %q, want an opaque enc: value", enc)
+	}
+	if got, err := s.Decrypt(enc); err != nil || got != "hunter2" {
+		t.Errorf("Decrypt = %q, %v, want hunter2", got, err)
+	}
+
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(enc, encPrefix))
+	sealed[len(sealed)/2] ^= 1
+	tampered := encPrefix + base64.StdEncoding.EncodeToString(sealed)
+	if _, err := s.Decrypt(tampered); err == nil || !strings.Contains(err.Error(), "failed to decrypt value") {
+		t.Errorf("Decrypt of a tampered value: %v", err)
+	}
+	if _, err := s.Decrypt(encPrefix + "AAAA"); err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Errorf("Decrypt of a truncated value: %v", err)
+	}
+
+	t.Setenv(KeyEnvVar, randomKey(t))
+	if _, err := s.Decrypt(enc); err == nil || !strings.Contains(err.Error(), "failed to decrypt value") {
+		t.Errorf("Decrypt with another key: %v", err)
+	}
+}
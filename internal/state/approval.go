@@ -0,0 +1,46 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// Approval records that a user approved a saved plan. The signature covers
+// the environment, plan hash, user and time.
+type Approval struct {
+	Environment string    `json:"environment"`
+	PlanHash    string    `json:"plan_hash"`
+	User        string    `json:"user"`
+	Time        time.Time `json:"time"`
+	PublicKey   string    `json:"public_key"`
+	Signature   string    `json:"signature"`
+}
+
+// AddApproval stores an approval next to the state of its environment
+func (sm *StateManager) AddApproval(a Approval) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var approvals []Approval
+	if err := readRecords(sm.recordsFile("approvals", a.Environment), &approvals); err != nil {
+		return fmt.Errorf("failed to read approvals: %w", err)
+	}
+	approvals = append(approvals, a)
+
+	if err := writeRecords(sm.recordsFile("approvals", a.Environment), approvals); err != nil {
+		return fmt.Errorf("failed to write approvals: %w", err)
+	}
+	return nil
+}
+
+// Approvals returns the approvals recorded for env
+func (sm *StateManager) Approvals(env string) ([]Approval, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var approvals []Approval
+	if err := readRecords(sm.recordsFile("approvals", env), &approvals); err != nil {
+		return nil, fmt.Errorf("failed to read approvals: %w", err)
+	}
+	return approvals, nil
+}
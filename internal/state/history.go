@@ -0,0 +1,91 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	DeploymentSucceeded = "succeeded"
+	DeploymentFailed    = "failed"
+)
+
+// Deployment records the outcome of a deployment to an environment
+type Deployment struct {
+	Number      int           `json:"number" yaml:"number" table:"#"`
+	Environment string        `json:"environment" yaml:"environment"`
+	Version     string        `json:"version" yaml:"version"`
+	Status      string        `json:"status" yaml:"status" table:"STATUS,status"`
+	StartTime   time.Time     `json:"start_time" yaml:"start_time"`
+	Duration    time.Duration `json:"duration" yaml:"duration"`
+	Created     int           `json:"created" yaml:"created" table:",wide"`
+	Updated     int           `json:"updated" yaml:"updated" table:",wide"`
+	Deleted     int           `json:"deleted" yaml:"deleted" table:",wide"`
+	// PromotedFrom is the environment the version was promoted from
+	PromotedFrom string `json:"promoted_from,omitempty" yaml:"promoted_from,omitempty"`
+	Error        string `json:"error,omitempty" yaml:"error,omitempty" table:",wide"`
+	// RunID correlates the deployment with the logs of the run
+	RunID string `json:"run_id,omitempty" yaml:"run_id,omitempty" table:",wide"`
+}
+
+// RecordDeployment appends a deployment to the history of its environment
+// and numbers it
+func (sm *StateManager) RecordDeployment(d Deployment) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var history []Deployment
+	if err := readRecords(sm.recordsFile("history", d.Environment), &history); err != nil {
+		return fmt.Errorf("failed to read deployment history: %w", err)
+	}
+	d.Number = len(history) + 1
+	history = append(history, d)
+
+	if err := writeRecords(sm.recordsFile("history", d.Environment), history); err != nil {
+		return fmt.Errorf("failed to write deployment history: %w", err)
+	}
+	return nil
+}
+
+// History returns the deployments to env, oldest first
+func (sm *StateManager) History(env string) ([]Deployment, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var history []Deployment
+	if err := readRecords(sm.recordsFile("history", env), &history); err != nil {
+		return nil, fmt.Errorf("failed to read deployment history: %w", err)
+	}
+	return history, nil
+}
+
+// recordsFile is the path of a list of records kept for env
+func (sm *StateManager) recordsFile(kind, env string) string {
+	return filepath.Join(sm.statePath, kind, fmt.Sprintf("%s.json", env))
+}
+
+// readRecords decodes a JSON list; a missing file is an empty list
+func readRecords(path string, out interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func writeRecords(path string, records interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,93 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolver looks up outputs and resource attributes in saved state. It
+// satisfies config.Resolver so configuration references can be resolved
+// at plan time.
+type Resolver struct {
+	sm     *StateManager
+	states map[string]*State
+}
+
+func NewResolver(sm *StateManager) *Resolver {
+	return &Resolver{
+		sm:     sm,
+		states: make(map[string]*State),
+	}
+}
+
+// Output returns an output recorded for env
+func (r *Resolver) Output(env, name string) (interface{}, error) {
+	state, err := r.load(env)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := state.Outputs[name]
+	if !ok {
+		return nil, fmt.Errorf("environment %s has no output %s", env, name)
+	}
+	return v, nil
+}
+
+// ResourceAttribute returns an attribute of a resource recorded for env.
+// Nested attributes are addressed with dots; attributes not found at the
+// top level are looked up in the resource properties.
+func (r *Resolver) ResourceAttribute(env, resource, attr string) (interface{}, error) {
+	state, err := r.load(env)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := state.Resources[resource]
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found in state of environment %s", resource, env)
+	}
+
+	attrs, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resource %s has no attributes", resource)
+	}
+
+	if v, ok := lookup(attrs, attr); ok {
+		return v, nil
+	}
+	if props, ok := attrs["properties"].(map[string]interface{}); ok {
+		if v, ok := lookup(props, attr); ok {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("resource %s has no attribute %s", resource, attr)
+}
+
+func (r *Resolver) load(env string) (*State, error) {
+	if state, ok := r.states[env]; ok {
+		return state, nil
+	}
+
+	state, err := r.sm.LoadState(env)
+	if err != nil {
+		return nil, err
+	}
+	r.states[env] = state
+	return state, nil
+}
+
+func lookup(m map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = m
+	for _, key := range strings.Split(path, ".") {
+		next, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = next[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,18 +17,38 @@ type State struct {
 	LastUpdate  time.Time              `json:"last_update"`
 	Resources   map[string]interface{} `json:"resources"`
 	Outputs     map[string]interface{} `json:"outputs"`
+	// ExpiresAt is set for ephemeral environments, which `gort env gc`
+	// destroys once expired
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type StateManager struct {
 	statePath string
 	lockPath  string
 	mu        sync.Mutex
+	sensitive map[string]bool
 }
 
+// Redacted replaces sensitive values when state is saved
+const Redacted = "(sensitive)"
+
 func NewStateManager(baseDir string) *StateManager {
 	return &StateManager{
 		statePath: filepath.Join(baseDir, "states"),
 		lockPath:  filepath.Join(baseDir, "locks"),
+		sensitive: make(map[string]bool),
+	}
+}
+
+// Mask registers secret values that must never be written to state
+func (sm *StateManager) Mask(values ...string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			sm.sensitive[v] = true
+		}
 	}
 }
 
@@ -73,7 +95,12 @@ func (sm *StateManager) SaveState(env string, state *State) error {
 	}
 
 	state.LastUpdate = time.Now()
-	data, err := json.MarshalIndent(state, "", "  ")
+	redacted, err := sm.redact(state)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(redacted, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
@@ -82,6 +109,51 @@ func (sm *StateManager) SaveState(env string, state *State) error {
 	return os.WriteFile(stateFile, data, 0644)
 }
 
+// BackupState copies the current state of env to backups/<name>.json. It
+// does nothing if env has no state yet.
+func (sm *StateManager) BackupState(env string, name string) error {
+	stateFile := filepath.Join(sm.statePath, fmt.Sprintf("%s.json", env))
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	backupDir := filepath.Join(sm.statePath, "backups")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(backupDir, fmt.Sprintf("%s.json", name)), data, 0644)
+}
+
+// DeleteState removes the state of env; approvals and deployment history
+// are kept
+func (sm *StateManager) DeleteState(env string) error {
+	stateFile := filepath.Join(sm.statePath, fmt.Sprintf("%s.json", env))
+	if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete state: %w", err)
+	}
+	return nil
+}
+
+// ListEnvironments returns the environments that have saved state
+func (sm *StateManager) ListEnvironments() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(sm.statePath, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan state directory: %w", err)
+	}
+
+	envs := make([]string, 0, len(files))
+	for _, file := range files {
+		envs = append(envs, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
+
 func (sm *StateManager) LoadState(env string) (*State, error) {
 	stateFile := filepath.Join(sm.statePath, fmt.Sprintf("%s.json", env))
 	data, err := os.ReadFile(stateFile)
@@ -103,3 +175,64 @@ func (sm *StateManager) LoadState(env string) (*State, error) {
 
 	return &state, nil
 }
+
+// redact returns a copy of state with sensitive values replaced. Only
+// resource properties and outputs equal to a sensitive value are replaced:
+// the IDs, types, providers and statuses of resources are needed to manage
+// them and are never rewritten.
+func (sm *StateManager) redact(state *State) (*State, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if len(sm.sensitive) == 0 {
+		return state, nil
+	}
+
+	// Normalize typed values to plain maps so nested strings are reachable
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal state: %w", err)
+	}
+	var redacted State
+	if err := json.Unmarshal(data, &redacted); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state: %w", err)
+	}
+
+	for name, res := range redacted.Resources {
+		if rec, ok := res.(map[string]interface{}); ok && rec["properties"] != nil {
+			rec["properties"] = sm.redactValue(rec["properties"])
+			redacted.Resources[name] = rec
+		}
+	}
+	redacted.Outputs, _ = sm.redactValue(redacted.Outputs).(map[string]interface{})
+	return &redacted, nil
+}
+
+// redactValue replaces the strings of v that are equal to a sensitive
+// value. The caller holds sm.mu.
+func (sm *StateManager) redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if t == nil {
+			return t
+		}
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = sm.redactValue(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = sm.redactValue(val)
+		}
+		return s
+	case string:
+		if sm.sensitive[t] {
+			return Redacted
+		}
+		return t
+	default:
+		return v
+	}
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSaveStateRedactsOnlyWholeSecretValues(t *testing.T) {
+	sm := NewStateManager(t.TempDir())
+	sm.Mask("prod", "hunter2")
+
+	record := map[string]interface{}{
+		"id":       "db-prod-1",
+		"type":     "database",
+		"provider": "prod-cloud",
+		"status":   "running",
+		"properties": map[string]interface{}{
+			"password": "hunter2",
+			"name":     "prod-db",
+			"tags":     []interface{}{"prod", "team-prod"},
+		},
+	}
+	st := &State{
+		Environment: "prod",
+		Resources:   map[string]interface{}{"db": record},
+		Outputs:     map[string]interface{}{"password": "hunter2", "url": "https://prod.example.com"},
+	}
+	if err := sm.SaveState("prod", st); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+
+	loaded, err := sm.LoadState("prod")
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	got := loaded.Resources["db"].(map[string]interface{})
+	for _, key := range []string{"id", "type", "provider", "status"} {
+		if got[key] != record[key] {
+			t.Errorf("%s = %v, want %v", key, got[key], record[key])
+		}
+	}
+	wantProps := map[string]interface{}{
+		"password": Redacted,
+		"name":     "prod-db",
+		"tags":     []interface{}{Redacted, "team-prod"},
+	}
+	if !reflect.DeepEqual(got["properties"], wantProps) {
+		t.Errorf("properties = %v, want %v", got["properties"], wantProps)
+	}
+	wantOutputs := map[string]interface{}{"password": Redacted, "url": "https://prod.example.com"}
+	if !reflect.DeepEqual(loaded.Outputs, wantOutputs) {
+		t.Errorf("outputs = %v, want %v", loaded.Outputs, wantOutputs)
+	}
+
+	// The caller's state is left untouched
+	if record["properties"].(map[string]interface{})["password"] != "hunter2" {
+		t.Error("SaveState modified the state it was given")
+	}
+}
@@ -21,7 +21,12 @@ func RenderTemplate(templatePath string, data *TemplateData) (string, error) {
 		return "", fmt.Errorf("failed to read template file: %w", err)
 	}
 
-	tmpl, err := template.New(filepath.Base(templatePath)).Parse(string(content))
+	return Render(filepath.Base(templatePath), string(content), data)
+}
+
+// Render renders template text with data
+func Render(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}